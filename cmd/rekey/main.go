@@ -0,0 +1,125 @@
+// Command rekey encrypts the content of every snippet and draft, the
+// two-factor secret of every user and the payload of every webhook delivery
+// with the current key, after a new key has been added to the key file (see
+// the encryption package for its format). It also encrypts what was stored
+// before encryption was enabled. Old keys can be removed from the key file
+// once it's done:
+//
+//	go run ./cmd/rekey -dsn "web:pass@/snippetbox?parseTime=true" -key-file ./keys
+//
+// The web application can keep running while it works.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"log/slog"
+	"os"
+
+	"github.com/juliflorezg/lets-go/internal/encryption"
+	"github.com/juliflorezg/lets-go/internal/models"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func main() {
+	dsn := flag.String("dsn", "web:web24pass_@@/snippetbox?parseTime=true", "MySQL data source name")
+	keyFile := flag.String("key-file", "", "File with the keys snippets are encrypted with (read from $"+encryption.EnvVar+" if empty)")
+	batchSize := flag.Int("batch", 100, "Number of rows of each table to re-encrypt at a time")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	keys, err := encryption.FromConfig(*keyFile)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if keys == nil {
+		logger.Error("no encryption keys configured")
+		os.Exit(1)
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	snippets := &models.SnippetModel{DB: db, Keys: keys}
+
+	total := 0
+	for {
+		n, err := snippets.Rekey(*batchSize)
+		if err != nil {
+			logger.Error(err.Error(), "done", total)
+			os.Exit(1)
+		}
+		if n == 0 {
+			break
+		}
+
+		total += n
+		logger.Info("re-encrypted snippets", "done", total, "key_id", keys.Current())
+	}
+
+	logger.Info("every snippet is encrypted with the current key", "snippets", total, "key_id", keys.Current())
+
+	drafts := &models.DraftModel{DB: db, Keys: keys}
+
+	total = 0
+	for {
+		n, err := drafts.Rekey(*batchSize)
+		if err != nil {
+			logger.Error(err.Error(), "done", total)
+			os.Exit(1)
+		}
+		if n == 0 {
+			break
+		}
+
+		total += n
+		logger.Info("re-encrypted drafts", "done", total, "key_id", keys.Current())
+	}
+
+	logger.Info("every draft is encrypted with the current key", "drafts", total, "key_id", keys.Current())
+
+	twoFactor := &models.TwoFactorModel{DB: db, Keys: keys}
+
+	total = 0
+	for {
+		n, err := twoFactor.Rekey(*batchSize)
+		if err != nil {
+			logger.Error(err.Error(), "done", total)
+			os.Exit(1)
+		}
+		if n == 0 {
+			break
+		}
+
+		total += n
+		logger.Info("re-encrypted two-factor secrets", "done", total, "key_id", keys.Current())
+	}
+
+	logger.Info("every two-factor secret is encrypted with the current key", "secrets", total, "key_id", keys.Current())
+
+	webhooks := &models.WebhookModel{DB: db, Keys: keys}
+
+	total = 0
+	for {
+		n, err := webhooks.Rekey(*batchSize)
+		if err != nil {
+			logger.Error(err.Error(), "done", total)
+			os.Exit(1)
+		}
+		if n == 0 {
+			break
+		}
+
+		total += n
+		logger.Info("re-encrypted webhook payloads", "done", total, "key_id", keys.Current())
+	}
+
+	logger.Info("every webhook payload is encrypted with the current key", "payloads", total, "key_id", keys.Current())
+}
@@ -0,0 +1,54 @@
+// Command report prints reports about the content of a Snippetbox instance,
+// for its administrators. For now the only report is the list of contents
+// which have been posted the most times:
+//
+//	go run ./cmd/report -dsn "web:pass@/snippetbox?parseTime=true" -limit 20
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func main() {
+	dsn := flag.String("dsn", "web:web24pass_@@/snippetbox?parseTime=true", "MySQL data source name")
+	limit := flag.Int("limit", 20, "Maximum number of duplicated contents to list")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	snippets := &models.SnippetModel{DB: db}
+
+	groups, err := snippets.MostDuplicated(*limit)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if len(groups) == 0 {
+		fmt.Println("No content has been posted more than once.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "SNIPPETS\tUSERS\tFIRST SNIPPET\tTITLE\tHASH")
+	for _, g := range groups {
+		fmt.Fprintf(tw, "%d\t%d\t#%d\t%s\t%s\n", g.Snippets, g.Users, g.SnippetID, g.Title, g.Hash[:12])
+	}
+	tw.Flush()
+}
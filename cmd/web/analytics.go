@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+// analyticsDailyMonths is the number of past months whose analytics are kept
+// day by day, on top of the current month. Older ones are rolled up into
+// monthly rows.
+const analyticsDailyMonths = 2
+
+// analyticsChartDays is the number of days shown in the chart of the stats
+// page of a snippet.
+const analyticsChartDays = 30
+
+// recordHit counts a hit of a snippet in the background, so that it doesn't
+// slow the response down. The hits of the owner of the snippet aren't
+// counted. The raw and embed routes have no session, but isAuthenticated is
+// false there so the session isn't looked at.
+func (app *application) recordHit(r *http.Request, snippet models.Snippet, kind string) {
+	if app.isAuthenticated(r) && app.sessionManager.GetInt(r.Context(), "authenticatedUserID") == snippet.UserID {
+		return
+	}
+
+	hit := models.Hit{
+		SnippetID:    snippet.ID,
+		Kind:         kind,
+		IP:           app.visitorIP(r),
+		UserAgent:    r.UserAgent(),
+		ReferrerHost: referrerHost(r),
+	}
+
+	app.background(func() error {
+		return app.analytics.Record(hit)
+	})
+}
+
+// visitorIP returns the IP address of the visitor who sent the request. The
+// X-Real-Ip and X-Forwarded-For headers are only believed when the request
+// comes from one of the trusted proxies, since anyone can send them
+// otherwise.
+func (app *application) visitorIP(r *http.Request) string {
+	ip := withoutPort(r.RemoteAddr)
+	if !app.trustedProxy(ip) {
+		return ip
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-Ip")); realIP != "" {
+		return withoutPort(realIP)
+	}
+
+	// X-Forwarded-For lists every proxy the request went through, starting
+	// with the client. Only the addresses appended by trusted proxies can be
+	// believed, so the client is the last one which isn't among them.
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := withoutPort(strings.TrimSpace(hops[i]))
+		if hop == "" {
+			continue
+		}
+
+		ip = hop
+		if !app.trustedProxy(hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// trustedProxy reports whether the given IP address is the one of a trusted
+// proxy.
+func (app *application) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	for _, prefix := range app.trustedProxies {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses a comma-separated list of IP addresses and CIDR
+// ranges, as given with the -trusted-proxies flag.
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// withoutPort returns an address without its port, if it has one.
+func withoutPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// referrerHost returns the host of the page which linked to the requested
+// one, or an empty string if there's none or if it's a page of this site.
+func referrerHost(r *http.Request) string {
+	referrer, err := url.Parse(r.Referer())
+	if err != nil || referrer.Hostname() == "" {
+		return ""
+	}
+
+	host := strings.ToLower(referrer.Hostname())
+	if ownHost, _, err := net.SplitHostPort(r.Host); (err == nil && host == ownHost) || host == r.Host {
+		return ""
+	}
+
+	return host
+}
+
+// maintainAnalytics rolls up the old daily analytics into monthly ones and
+// forgets the visitors of the previous days, once an hour for as long as the
+// application runs.
+func (app *application) maintainAnalytics() error {
+	for {
+		now := time.Now().UTC()
+		today := now.Truncate(24 * time.Hour)
+		firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+		err := app.analytics.DeleteVisitors(today)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+
+		err = app.analytics.RollUp(firstOfMonth.AddDate(0, -analyticsDailyMonths, 0))
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+
+		time.Sleep(time.Hour)
+	}
+}
+
+// chartBar is a day in a chart. The bar of the views is drawn first, and the
+// one of the unique visitors over it.
+type chartBar struct {
+	X              int
+	Width          int
+	ViewsY         int
+	ViewsHeight    int
+	VisitorsY      int
+	VisitorsHeight int
+	Day            time.Time
+	models.HitCounts
+}
+
+// dailyChart holds what's needed to draw the views of a snippet per day as a
+// bar chart in SVG. Max is the value at the top of the chart.
+type dailyChart struct {
+	Width  int
+	Height int
+	Max    int
+	Bars   []chartBar
+}
+
+const (
+	chartWidth  = 600
+	chartHeight = 150
+)
+
+// newDailyChart lays out a bar chart of the given days.
+func newDailyChart(days []models.DailyHitCounts) dailyChart {
+	chart := dailyChart{Width: chartWidth, Height: chartHeight, Max: 1}
+	if len(days) == 0 {
+		return chart
+	}
+
+	for _, d := range days {
+		chart.Max = max(chart.Max, d.Views, d.Visitors)
+	}
+
+	step := chartWidth / len(days)
+
+	for i, d := range days {
+		views := d.Views * chartHeight / chart.Max
+		visitors := d.Visitors * chartHeight / chart.Max
+
+		chart.Bars = append(chart.Bars, chartBar{
+			X:              i * step,
+			Width:          max(step-2, 1),
+			ViewsY:         chartHeight - views,
+			ViewsHeight:    views,
+			VisitorsY:      chartHeight - visitors,
+			VisitorsHeight: visitors,
+			Day:            d.Day,
+			HitCounts:      d.HitCounts,
+		})
+	}
+
+	return chart
+}
@@ -3,3 +3,7 @@ package main
 type contextKey string
 
 var isAuthenticatedContextKey = contextKey("isAuthenticated")
+
+// unreadNotificationsContextKey holds the number of unread notifications of
+// the authenticated user, shown in the navigation bar of every page.
+var unreadNotificationsContextKey = contextKey("unreadNotifications")
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/language"
+	"github.com/juliflorezg/lets-go/internal/pubsub"
+)
+
+// latestTopic is the topic of the snippets published on the home page.
+const latestTopic = "latest"
+
+// snippetTopic returns the topic of the changes of a snippet.
+func snippetTopic(id int) string {
+	return "snippet:" + strconv.Itoa(id)
+}
+
+const (
+	// heartbeatInterval is how often a comment is sent on idle streams, so
+	// that proxies don't close them and closed ones are noticed.
+	heartbeatInterval = 15 * time.Second
+
+	// retryInterval is how long browsers wait before reconnecting a closed
+	// stream.
+	retryInterval = 5 * time.Second
+
+	// maxStreamsPerIP is the number of streams a single IP address can have
+	// open at once. It leaves room for a few tabs.
+	maxStreamsPerIP = 8
+)
+
+// latestEvent is the data of the event sent to the home page when a snippet
+// is published.
+type latestEvent struct {
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	Created string `json:"created"`
+}
+
+// updateEvent is the data of the event sent to the viewers of a snippet when
+// it's edited. Lines are the lines of the new content, which main.js numbers
+// like the server does.
+type updateEvent struct {
+	Title    string   `json:"title"`
+	Language string   `json:"language"`
+	Lines    []string `json:"lines"`
+}
+
+// publishCreated tells the home pages about the snippet with the given ID,
+// unless it isn't public yet. Scheduled snippets show up once the page is
+// reloaded after they're published.
+func (app *application) publishCreated(id int) error {
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if snippet.IsScheduled() || snippet.Hidden {
+		return nil
+	}
+
+	data, err := json.Marshal(latestEvent{
+		ID:      snippet.ID,
+		Title:   snippet.Title,
+		Created: humanDate(snippet.Created),
+	})
+	if err != nil {
+		return err
+	}
+
+	app.events.Publish(latestTopic, pubsub.Event{Name: "snippet", Data: data})
+
+	return nil
+}
+
+// publishUpdated sends the new version of the snippet with the given ID to
+// everybody viewing it. Nothing is sent for the snippets which can't be
+// followed (see snippetEvents).
+func (app *application) publishUpdated(id int) error {
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if snippet.IsScheduled() || snippet.Hidden || snippet.ClientEncrypted {
+		return nil
+	}
+
+	var label string
+	if snippet.DisplayLanguage() != "" {
+		label = language.Label(snippet.DisplayLanguage())
+	}
+
+	data, err := json.Marshal(updateEvent{
+		Title:    snippet.Title,
+		Language: label,
+		Lines:    splitLines(snippet.Content),
+	})
+	if err != nil {
+		return err
+	}
+
+	app.events.Publish(snippetTopic(snippet.ID), pubsub.Event{Name: "update", Data: data})
+
+	return nil
+}
+
+// latestEvents streams the snippets published from now on.
+func (app *application) latestEvents(w http.ResponseWriter, r *http.Request) {
+	app.stream(w, r, latestTopic)
+}
+
+// snippetEvents streams the changes of a snippet. Like the raw content, it's
+// only available for published snippets.
+func (app *application) snippetEvents(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.publishedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	app.stream(w, r, snippetTopic(snippet.ID))
+}
+
+// stream sends the events published on a topic as Server-Sent Events, until
+// the client goes away or falls too far behind (in which case it reconnects
+// by itself).
+func (app *application) stream(w http.ResponseWriter, r *http.Request, topic string) {
+	ip := app.visitorIP(r)
+	if !app.streams.acquire(ip) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryInterval.Seconds())))
+		app.clientError(w, http.StatusTooManyRequests)
+		return
+	}
+	defer app.streams.release(ip)
+
+	// The WriteTimeout of the server is meant for regular responses, and
+	// would cut streams after a few seconds.
+	rc := http.NewResponseController(w)
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	sub := app.events.Subscribe(topic)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// Tell nginx and the like not to buffer the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", retryInterval.Milliseconds())
+	err = rc.Flush()
+	if err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			// The data is JSON, which never spans several lines.
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Name, e.Data)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// streamLimiter counts the open streams of each IP address, to keep a single
+// client from holding too many connections open.
+type streamLimiter struct {
+	mu     sync.Mutex
+	max    int
+	counts map[string]int
+}
+
+func newStreamLimiter(limit int) *streamLimiter {
+	return &streamLimiter{max: limit, counts: make(map[string]int)}
+}
+
+// acquire counts a new stream for the given IP address, unless it already
+// has the maximum number of them open, in which case it returns false.
+func (l *streamLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.counts[ip] >= l.max {
+		return false
+	}
+	l.counts[ip]++
+
+	return true
+}
+
+// release forgets a stream of the given IP address once it's closed.
+func (l *streamLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.counts[ip]--
+	if l.counts[ip] <= 0 {
+		delete(l.counts, ip)
+	}
+}
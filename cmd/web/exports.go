@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/export"
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+// exportRetention is how long the archive of an export can be downloaded for
+// once it's ready, after which it's deleted.
+const exportRetention = 7 * 24 * time.Hour
+
+// exportPath returns where the archive for the export with the given ID is
+// stored on disk.
+func (app *application) exportPath(id int) string {
+	return filepath.Join(app.exportDir, fmt.Sprintf("export-%d.zip", id))
+}
+
+// buildExport gathers all the data of a user and writes it as an archive for
+// the given export, then marks the export as ready (or failed). It's meant to
+// be run in the background.
+func (app *application) buildExport(exportID, userID int) error {
+	err := app.writeExport(exportID, userID)
+	if err != nil {
+		os.Remove(app.exportPath(exportID))
+		app.exports.SetStatus(exportID, models.ExportFailed)
+		return err
+	}
+
+	return app.exports.SetStatus(exportID, models.ExportReady)
+}
+
+func (app *application) writeExport(exportID, userID int) error {
+	user, err := app.users.Get(userID)
+	if err != nil {
+		return err
+	}
+
+	snippets, err := app.snippets.AllByUser(userID)
+	if err != nil {
+		return err
+	}
+
+	drafts, err := app.drafts.ByUser(userID)
+	if err != nil {
+		return err
+	}
+
+	settings, err := app.exportSettings(userID)
+	if err != nil {
+		return err
+	}
+
+	archive := export.Archive{
+		Profile: export.Profile{
+			ID:      user.ID,
+			Name:    user.Name,
+			Email:   user.Email,
+			Bio:     user.Bio,
+			Created: user.Created,
+		},
+		Settings:     settings,
+		Content:      make(map[int]string, len(snippets)),
+		DraftContent: make(map[int]string, len(drafts)),
+	}
+
+	for _, s := range snippets {
+		archive.Snippets = append(archive.Snippets, export.Snippet{
+			ID:        s.ID,
+			Title:     s.Title,
+			Language:  s.Language,
+			Encrypted: s.ClientEncrypted,
+			Pinned:    s.Pinned,
+			Created:   s.Created,
+			PublishAt: s.PublishAt,
+			Expires:   s.Expires,
+		})
+		archive.Content[s.ID] = s.Content
+	}
+
+	for _, d := range drafts {
+		archive.Drafts = append(archive.Drafts, export.Draft{
+			ID:       d.ID,
+			Title:    d.Title,
+			Language: d.Language,
+			Expires:  d.Expires,
+			Updated:  d.Updated,
+		})
+		archive.DraftContent[d.ID] = d.Content
+	}
+
+	// Write the archive under a temporary name first and rename it once it's
+	// complete, so a partially written file is never served.
+	path := app.exportPath(exportID)
+
+	f, err := os.CreateTemp(app.exportDir, "export-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = export.Write(f, archive)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// exportSettings gathers the settings of a user for the archive of their
+// data. Their two-factor methods and passkeys are only named: the secrets
+// and credentials they're made of are never exported.
+func (app *application) exportSettings(userID int) (export.Settings, error) {
+	var settings export.Settings
+
+	disabled, err := app.notifications.DisabledKinds(userID)
+	if err != nil {
+		return export.Settings{}, err
+	}
+	settings.DisabledNotifications = append([]string{}, disabled...)
+
+	webhooks, err := app.webhooks.ByUser(userID)
+	if err != nil {
+		return export.Settings{}, err
+	}
+	settings.Webhooks = []export.Webhook{}
+	for _, w := range webhooks {
+		settings.Webhooks = append(settings.Webhooks, export.Webhook{
+			URL:     w.URL,
+			Events:  w.Events,
+			Created: w.Created,
+		})
+	}
+
+	twoFactor, err := app.twoFactor.Enabled(userID)
+	if err != nil {
+		return export.Settings{}, err
+	}
+	settings.TwoFactorMethods = []string{}
+	if twoFactor {
+		settings.TwoFactorMethods = append(settings.TwoFactorMethods, "authenticator app")
+
+		left, err := app.twoFactor.RecoveryCodesLeft(userID)
+		if err != nil {
+			return export.Settings{}, err
+		}
+		if left > 0 {
+			settings.TwoFactorMethods = append(settings.TwoFactorMethods, "recovery codes")
+		}
+	}
+
+	passkeys, err := app.passkeys.ByUser(userID)
+	if err != nil {
+		return export.Settings{}, err
+	}
+	settings.Passkeys = []export.Passkey{}
+	for _, p := range passkeys {
+		settings.Passkeys = append(settings.Passkeys, export.Passkey{
+			Name:     p.Name,
+			Created:  p.Created,
+			LastUsed: p.LastUsed,
+		})
+	}
+
+	return settings, nil
+}
+
+// pruneExports expires the exports which are ready for longer than
+// exportRetention and deletes their archives, once an hour for as long as
+// the application runs.
+func (app *application) pruneExports() error {
+	for {
+		ids, err := app.exports.Expire(time.Now().Add(-exportRetention))
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+
+		for _, id := range ids {
+			err := os.Remove(app.exportPath(id))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				app.logger.Error(err.Error())
+			}
+		}
+		if len(ids) > 0 {
+			app.logger.Info("exports expired", "exports", len(ids))
+		}
+
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+// The atomFeed, atomEntry and related types mirror the elements of an Atom 1.0
+// document (RFC 4287). encoding/xml takes care of escaping every text value, so
+// snippet titles and contents can be assigned to them as they are.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Updated   string   `xml:"updated"`
+	Published string   `xml:"published"`
+	Link      atomLink `xml:"link"`
+	Content   atomText `xml:"content"`
+}
+
+// The rssFeed and rssItem types mirror the elements of an RSS 2.0 document.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// feedUpdated returns the time at which a feed made of the given snippets last
+// changed, which is the publication time of its newest snippet. An empty feed
+// has no meaningful modification time, so the zero time is returned for it.
+func feedUpdated(snippets []models.Snippet) time.Time {
+	var updated time.Time
+
+	for _, s := range snippets {
+		if s.PublishAt.After(updated) {
+			updated = s.PublishAt
+		}
+	}
+
+	return updated.UTC().Truncate(time.Second)
+}
+
+// newAtomFeed builds an Atom feed for the given snippets. selfURL is the
+// absolute URL the feed is served from and is also used as the feed ID.
+func newAtomFeed(baseURL, selfURL, title, author string, snippets []models.Snippet) atomFeed {
+	updated := feedUpdated(snippets)
+	if updated.IsZero() {
+		updated = time.Unix(0, 0).UTC()
+	}
+
+	feed := atomFeed{
+		ID:      selfURL,
+		Title:   title,
+		Updated: updated.Format(time.RFC3339),
+		Author:  atomAuthor{Name: author},
+		Links: []atomLink{
+			{Href: selfURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: baseURL + "/", Rel: "alternate", Type: "text/html"},
+		},
+	}
+
+	for _, s := range snippets {
+		url := fmt.Sprintf("%s/snippet/view/%d", baseURL, s.ID)
+		published := s.PublishAt.UTC().Format(time.RFC3339)
+
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:        url,
+			Title:     s.Title,
+			Updated:   published,
+			Published: published,
+			Link:      atomLink{Href: url, Rel: "alternate", Type: "text/html"},
+			Content:   atomText{Type: "text", Body: feedContent(s)},
+		})
+	}
+
+	return feed
+}
+
+// newRSSFeed builds an RSS 2.0 feed for the given snippets.
+func newRSSFeed(baseURL, title string, snippets []models.Snippet) rssFeed {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       title,
+			Link:        baseURL + "/",
+			Description: "The latest snippets published on Snippetbox",
+		},
+	}
+
+	if updated := feedUpdated(snippets); !updated.IsZero() {
+		feed.Channel.LastBuildDate = updated.Format(time.RFC1123Z)
+	}
+
+	for _, s := range snippets {
+		url := fmt.Sprintf("%s/snippet/view/%d", baseURL, s.ID)
+
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       s.Title,
+			Link:        url,
+			GUID:        rssGUID{IsPermaLink: true, Value: url},
+			PubDate:     s.PublishAt.UTC().Format(time.RFC1123Z),
+			Description: feedContent(s),
+		})
+	}
+
+	return feed
+}
+
+// writeFeed encodes a feed as XML and sends it to the client. The response
+// carries an ETag derived from the encoded document and a Last-Modified header
+// derived from updated, and http.ServeContent uses both of them to answer
+// conditional GET requests with a 304 Not Modified.
+func (app *application) writeFeed(w http.ResponseWriter, r *http.Request, contentType string, updated time.Time, feed any) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+
+	err := xml.NewEncoder(buf).Encode(feed)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+
+	http.ServeContent(w, r, "", updated, bytes.NewReader(buf.Bytes()))
+}
+
+// encryptedFeedContent replaces the content of the snippets encrypted in the
+// browser in feeds, since feed readers couldn't decrypt them.
+const encryptedFeedContent = "This snippet is encrypted. It can only be read with the link its author shared."
+
+// feedContent returns the content of a snippet as shown in feeds.
+func feedContent(s models.Snippet) string {
+	if s.ClientEncrypted {
+		return encryptedFeedContent
+	}
+	return s.Content
+}
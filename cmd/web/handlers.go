@@ -1,13 +1,24 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/juliflorezg/lets-go/internal/language"
 	"github.com/juliflorezg/lets-go/internal/models"
+	"github.com/juliflorezg/lets-go/internal/scanner"
+	"github.com/juliflorezg/lets-go/internal/signing"
+	"github.com/juliflorezg/lets-go/internal/totp"
 	"github.com/juliflorezg/lets-go/internal/validator"
+	"github.com/juliflorezg/lets-go/internal/webauthn"
+	"github.com/juliflorezg/lets-go/internal/webhook"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -21,10 +32,79 @@ import (
 // example, here we're telling the decoder to store the value from the HTML form
 // input with the name "title" in the Title field. The struct tag `form:"-"`
 // tells the decoder to completely ignore a field during decoding.
+// DraftID is the ID of the draft the snippet is written from, if any. The
+// form autosaves into this draft, and it's deleted once the snippet is
+// published. PublishAt is the optional time (in UTC, in the format of
+// datetime-local inputs) at which the snippet should be published.
+// Duplicate is an existing snippet of the user with the same content, which
+// the user is warned about unless they set IgnoreDuplicate. In the same way,
+// Secrets are the secrets found in the content, which block the snippet from
+// being published unless the user sets AllowSecrets. If ClientEncrypted is
+// set, the content was encrypted by the browser (see encrypted.js) and is
+// neither scanned for secrets nor compared to other snippets.
 type snippetCreateForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
+	Title               string            `form:"title"`
+	Content             string            `form:"content"`
+	Language            string            `form:"language"`
+	Expires             int               `form:"expires"`
+	PublishAt           string            `form:"publish_at"`
+	DraftID             int               `form:"draft_id"`
+	IgnoreDuplicate     bool              `form:"ignore_duplicate"`
+	Duplicate           models.Snippet    `form:"-"`
+	AllowSecrets        bool              `form:"allow_secrets"`
+	Secrets             []scanner.Finding `form:"-"`
+	ClientEncrypted     bool              `form:"client_encrypted"`
+	validator.Validator `form:"-"`
+}
+
+// snippetEditForm holds the parts of a snippet which can be changed once it's
+// created. Its expiry and publication time stay as they were.
+type snippetEditForm struct {
+	ID                  int               `form:"-"`
+	Title               string            `form:"title"`
+	Content             string            `form:"content"`
+	Language            string            `form:"language"`
+	AllowSecrets        bool              `form:"allow_secrets"`
+	Secrets             []scanner.Finding `form:"-"`
+	validator.Validator `form:"-"`
+}
+
+// publishAtLayout is the format of the values sent by datetime-local inputs.
+const publishAtLayout = "2006-01-02T15:04"
+
+// parsePublishAt parses the publish_at value of the snippet create form. An
+// empty value means the snippet is published right away, and is returned as
+// the zero time.
+func parsePublishAt(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(publishAtLayout, value, time.UTC)
+}
+
+// importSnippet holds one of the snippets of an import, as previewed to the
+// user before they confirm it. Filename is the name of the file the snippet
+// was read from. Secrets are the secrets found in its content, which block it
+// from being imported unless the user sets AllowSecrets for this file.
+type importSnippet struct {
+	Filename            string            `form:"filename"`
+	Title               string            `form:"title"`
+	Content             string            `form:"content"`
+	Language            string            `form:"language"`
+	AllowSecrets        bool              `form:"allow_secrets"`
+	Secrets             []scanner.Finding `form:"-"`
+	validator.Validator `form:"-"`
+}
+
+// snippetImportForm holds the snippets of an import. Snippets are the ones
+// which can be imported and Rejected the ones which failed to be read or to
+// be validated. Imported is the number of snippets which have been created
+// once the import is confirmed.
+type snippetImportForm struct {
+	Expires             int             `form:"expires"`
+	Snippets            []importSnippet `form:"snippets"`
+	Rejected            []importSnippet `form:"-"`
+	Imported            int             `form:"-"`
 	validator.Validator `form:"-"`
 }
 
@@ -36,6 +116,177 @@ type userSignUpForm struct {
 	validator.Validator `form:"-"`
 }
 
+// validateSnippet runs the checks that every snippet must pass, whether it's
+// created through the form, imported from a file or edited.
+func validateSnippet(v *validator.Validator, title, content, lang string) {
+	v.CheckField(validator.NotBlank(title), "title", "This field cannot be blank")
+	v.CheckField(validator.MaxChars(title, 100), "title", "This field cannot be more than 100 characters long")
+	v.CheckField(validator.NotBlank(content), "content", "This field cannot be blank")
+	v.CheckField(lang == "" || validator.PermittedValue(lang, language.Names()...), "language", "This field must be one of the listed languages")
+}
+
+// maxBioChars is the maximum length of the bio of a user.
+const maxBioChars = 500
+
+type userBioForm struct {
+	Bio                 string `form:"bio"`
+	validator.Validator `form:"-"`
+}
+
+type snippetPinForm struct {
+	Pinned bool `form:"pinned"`
+}
+
+// notificationsForm acts on the notifications of the user: Action is "read"
+// to mark them as read or "delete" to clear them. ID is the notification to
+// act on, or 0 for all of them.
+type notificationsForm struct {
+	Action string `form:"action"`
+	ID     int    `form:"id"`
+}
+
+// notificationSettingsForm holds the kinds of notifications the user wants
+// to get, keyed by name. They opt out of the others.
+type notificationSettingsForm struct {
+	Enabled map[string]bool `form:"enabled"`
+}
+
+// notificationsLimit is the number of notifications shown on the
+// notifications page.
+const notificationsLimit = 50
+
+// webhookForm adds a webhook. Events holds the events it subscribes to, keyed
+// by name. The secret is generated rather than chosen by the user.
+type webhookForm struct {
+	URL                 string          `form:"url"`
+	Events              map[string]bool `form:"events"`
+	validator.Validator `form:"-"`
+}
+
+// adminSuspendForm, adminUnlockForm and adminHideForm are sent from the search results of the
+// administration area. Query is the search the admin came from, so that they
+// can be sent back to it.
+type adminSuspendForm struct {
+	Suspended bool   `form:"suspended"`
+	Query     string `form:"q"`
+}
+
+type adminUnlockForm struct {
+	Query string `form:"q"`
+}
+
+type adminHideForm struct {
+	Hidden bool   `form:"hidden"`
+	Note   string `form:"note"`
+	Query  string `form:"q"`
+}
+
+// adminSearchLimit is the maximum number of results of the searches in the
+// administration area.
+const adminSearchLimit = 50
+
+// maxPinnedSnippets is the maximum number of snippets a user can pin to their
+// profile.
+const maxPinnedSnippets = 6
+
+// profilePageSize is the number of snippets listed on each page of a profile.
+const profilePageSize = 20
+
+// userProfile holds what the public profile page of a user shows. It's filled
+// from the public fields of models.User only, so that private ones (like the
+// email address) can't end up on the page by mistake.
+type userProfile struct {
+	ID      int
+	Name    string
+	Bio     string
+	Created time.Time
+	Pinned  []models.Snippet
+	Page    int
+	Pages   int
+}
+
+// PrevPage returns the number of the previous page of snippets, or 0 if this
+// is the first one.
+func (p userProfile) PrevPage() int {
+	return p.Page - 1
+}
+
+// NextPage returns the number of the next page of snippets, or 0 if this is
+// the last one.
+func (p userProfile) NextPage() int {
+	if p.Page >= p.Pages {
+		return 0
+	}
+	return p.Page + 1
+}
+
+type snippetReportForm struct {
+	Reason              string `form:"reason"`
+	Details             string `form:"details"`
+	validator.Validator `form:"-"`
+}
+
+// moderationDecisionForm holds the decision of a moderator about a reported
+// snippet. Action is one of the models.Decision constants.
+type moderationDecisionForm struct {
+	Action              string `form:"action"`
+	Note                string `form:"note"`
+	validator.Validator `form:"-"`
+}
+
+// forgotPasswordForm asks for a link to reset the password of an account.
+type forgotPasswordForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+// resetPasswordForm sets a new password with the token of a reset link, and
+// removes the passkeys of the user if RevokePasskeys is set.
+type resetPasswordForm struct {
+	Token                   string `form:"-"`
+	NewPassword             string `form:"new_password"`
+	NewPasswordConfirmation string `form:"new_password_confirmation"`
+	RevokePasskeys          bool   `form:"revoke_passkeys"`
+	validator.Validator     `form:"-"`
+}
+
+// twoFactorCodeForm holds a code of an authenticator app, or a recovery code
+// when logging in.
+type twoFactorCodeForm struct {
+	Code                string `form:"code"`
+	validator.Validator `form:"-"`
+}
+
+// twoFactorPasswordForm confirms changes to the two-factor authentication of
+// an account with the password of the user.
+type twoFactorPasswordForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+// passkeyForm registers a passkey, once the user has entered their password,
+// and Code if they have two-factor authentication. ClientDataJSON and
+// AttestationObject are the response of the authenticator, base64url encoded.
+type passkeyForm struct {
+	Name                string `form:"name"`
+	Password            string `form:"password"`
+	Code                string `form:"code"`
+	ClientDataJSON      string `form:"client_data_json"`
+	AttestationObject   string `form:"attestation_object"`
+	validator.Validator `form:"-"`
+}
+
+// passkeyLoginForm logs in with a passkey, with the response of the
+// authenticator, base64url encoded.
+type passkeyLoginForm struct {
+	CredentialID        string `form:"credential_id"`
+	ClientDataJSON      string `form:"client_data_json"`
+	AuthenticatorData   string `form:"authenticator_data"`
+	Signature           string `form:"signature"`
+	UserHandle          string `form:"user_handle"`
+	validator.Validator `form:"-"`
+}
+
 type userChangePasswordForm struct {
 	CurrentPassword         string `form:"current_password"`
 	NewPassword             string `form:"new_password"`
@@ -66,11 +317,45 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 
-	data := app.newTemplateData(r)
-	data.Form = snippetCreateForm{
+	form := snippetCreateForm{
 		Expires: 365,
 	}
 
+	// If the user is resuming one of their drafts, fill the form with it.
+	if r.URL.Query().Has("draft") {
+		id, err := strconv.Atoi(r.URL.Query().Get("draft"))
+		if err != nil || id < 1 {
+			app.notFound(w)
+			return
+		}
+
+		draft, err := app.drafts.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.notFound(w)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		if draft.UserID != app.sessionManager.GetInt(r.Context(), "authenticatedUserID") {
+			app.notFound(w)
+			return
+		}
+
+		form = snippetCreateForm{
+			Title:    draft.Title,
+			Content:  draft.Content,
+			Language: draft.Language,
+			Expires:  draft.Expires,
+			DraftID:  draft.ID,
+		}
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+
 	app.render(w, r, http.StatusOK, "create.tmpl.html", data)
 }
 
@@ -145,11 +430,39 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 
 	// replace the previous checks with the methods from snippetCreateForm embedded struct Validator
 
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	validateSnippet(&form.Validator, form.Title, form.Content, form.Language)
 	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
 
+	publishAt, err := parsePublishAt(form.PublishAt)
+	form.CheckField(err == nil, "publishAt", "This field must be a valid date and time")
+	form.CheckField(publishAt.IsZero() || publishAt.After(time.Now()), "publishAt", "This field must be in the future")
+	form.CheckField(publishAt.Before(time.Now().AddDate(1, 0, 0)), "publishAt", "This field must be within the next year")
+
+	if form.ClientEncrypted {
+		form.CheckField(isClientCiphertext(form.Content), "content", "This field must hold a snippet encrypted by your browser")
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	// Warn the user if the content seems to contain secrets, or if they
+	// already posted it (or something very close to it), unless they've been
+	// warned already and chose to go on. Neither can be checked when the
+	// content is encrypted.
+	if form.Valid() && !form.ClientEncrypted {
+		form.Secrets = app.checkSecrets(&form.Validator, form.Content, form.AllowSecrets)
+
+		if !form.IgnoreDuplicate {
+			duplicate, err := app.snippets.FindDuplicate(userID, form.Content)
+			if err == nil {
+				form.Duplicate = duplicate
+				form.AddNonFieldError("You already have a snippet with the same or nearly the same content.")
+			} else if !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+	}
+
 	// If there are any validation errors, then re-display the create.tmpl template,
 	// passing in the snippetCreateForm instance as dynamic data in the Form
 	// field. Note that we use the HTTP status code 422 Unprocessable Entity
@@ -168,12 +481,37 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 
 	// Pass the data to the SnippetModel.Insert() method, receiving the
 	// ID of the new record back.
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	var id int
+	if form.ClientEncrypted {
+		id, err = app.snippets.InsertEncrypted(userID, form.Title, form.Content, form.Language, form.Expires, publishAt)
+	} else {
+		id, err = app.snippets.Insert(userID, form.Title, form.Content, form.Language, form.Expires, publishAt)
+	}
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
+	app.logSecretsOverride(userID, id, form.Secrets)
+
+	app.background(func() error {
+		return app.publishCreated(id)
+	})
+
+	app.background(func() error {
+		return app.enqueueSnippetWebhooks(webhook.EventSnippetCreated, id)
+	})
+
+	// The snippet has been published, so the draft it was written from isn't
+	// needed anymore.
+	if form.DraftID != 0 {
+		err = app.drafts.Delete(form.DraftID, userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
 	// Use the Put() method to add a string value ("Snippet successfully
 	// created!") and the corresponding key ("flash") to the session data
 	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
@@ -183,283 +521,2724 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
 
-func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
-
-	// id, err := strconv.Atoi(r.URL.Query().Get("id"))
+// ownSnippet fetches the snippet with the ID given in the URL, as long as it
+// belongs to the authenticated user. If it doesn't exist or belongs to
+// somebody else, a 404 Not Found response is sent and ok is false.
+func (app *application) ownSnippet(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, ok bool) {
 	params := httprouter.ParamsFromContext(r.Context())
 	id, err := strconv.Atoi(params.ByName("id"))
-	fmt.Printf("id: ->%v<-\n", id)
 	if err != nil || id < 1 {
 		app.notFound(w)
-		return
+		return models.Snippet{}, false
 	}
 
-	snippet, err := app.snippets.Get(id)
+	snippet, err = app.snippets.Get(id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			app.notFound(w)
 		} else {
 			app.serverError(w, r, err)
 		}
-		return
+		return models.Snippet{}, false
 	}
 
-	// Use the PopString() method to retrieve the value for the "flash" key.
-	// PopString() also deletes the key and value from the session data, so it
-	// acts like a one-time fetch. If there is no matching key in the session
-	// data this will return the empty string.
-	// flash := app.sessionManager.GetString(r.Context(), "flash")
-
-	templateData := app.newTemplateData(r)
-	templateData.Snippet = snippet
-	// templateData.Flash = flash
-	// fmt.Printf("flash value in SnippetView:::%v\n", flash)
-	fmt.Printf("%+v\n", templateData)
+	if snippet.UserID != app.sessionManager.GetInt(r.Context(), "authenticatedUserID") {
+		app.notFound(w)
+		return models.Snippet{}, false
+	}
 
-	app.render(w, r, http.StatusOK, "view.tmpl.html", templateData)
+	return snippet, true
 }
 
-func (app *application) fooHandler(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Foo"))
+// editableSnippet fetches the snippet with the ID given in the URL like
+// ownSnippet, and also makes sure it can be edited. Snippets encrypted in the
+// browser can't, since the server can't read them: the user is sent back to
+// the snippet instead, and ok is false.
+func (app *application) editableSnippet(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, ok bool) {
+	snippet, ok = app.ownSnippet(w, r)
+	if !ok {
+		return models.Snippet{}, false
+	}
+
+	if snippet.ClientEncrypted {
+		app.sessionManager.Put(r.Context(), "flash", "Snippets encrypted in your browser can't be edited.")
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
 }
 
-func (app *application) userSignUp(w http.ResponseWriter, r *http.Request) {
-	// fmt.Fprintln(w, "Display an HTML form for signing up a new use")
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.editableSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	// If the author didn't choose a language, offer the detected one (if
+	// any) as the default.
 	data := app.newTemplateData(r)
-	data.Form = userSignUpForm{}
-	app.render(w, r, 200, "signup.tmpl.html", data)
+	data.Form = snippetEditForm{
+		ID:       snippet.ID,
+		Title:    snippet.Title,
+		Content:  snippet.Content,
+		Language: snippet.DisplayLanguage(),
+	}
+
+	app.render(w, r, http.StatusOK, "edit.tmpl.html", data)
 }
 
-func (app *application) userSignUpPost(w http.ResponseWriter, r *http.Request) {
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.editableSnippet(w, r)
+	if !ok {
+		return
+	}
 
-	var form userSignUpForm
+	var form snippetEditForm
 
 	err := app.decodePostForm(w, r, &form)
-
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
+	form.ID = snippet.ID
 
-	// Validate the form contents using the helper functions
-	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
-	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	validateSnippet(&form.Validator, form.Title, form.Content, form.Language)
+
+	if form.Valid() {
+		form.Secrets = app.checkSecrets(&form.Validator, form.Content, form.AllowSecrets)
+	}
 
-	// If there are any errors, re display the signup form along with a 422 status code
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "edit.tmpl.html", data)
 		return
 	}
 
-	err = app.users.Insert(form.Name, form.Email, form.Password)
-
+	err = app.snippets.Update(snippet.ID, snippet.UserID, form.Title, form.Content, form.Language)
 	if err != nil {
-		if errors.Is(err, models.ErrDuplicateEmail) {
-			form.AddFieldError("email", "This email address is already in use")
+		app.serverError(w, r, err)
+		return
+	}
 
-			data := app.newTemplateData(r)
-			data.Form = form
+	app.logSecretsOverride(snippet.UserID, snippet.ID, form.Secrets)
 
-			app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
+	app.background(func() error {
+		return app.publishUpdated(snippet.ID)
+	})
 
-		} else {
+	app.background(func() error {
+		return app.enqueueSnippetWebhooks(webhook.EventSnippetUpdated, snippet.ID)
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully updated!")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// snippetPinPost pins a snippet to the profile of its owner, or unpins it.
+func (app *application) snippetPinPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetPinForm
+
+	err := app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if form.Pinned && !snippet.Pinned {
+		pinned, err := app.snippets.PinnedByUser(snippet.UserID)
+		if err != nil {
 			app.serverError(w, r, err)
+			return
+		}
+
+		if len(pinned) >= maxPinnedSnippets {
+			app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You can pin up to %d snippets. Unpin one first.", maxPinnedSnippets))
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+			return
 		}
+	}
 
+	err = app.snippets.SetPinned(snippet.ID, snippet.UserID, form.Pinned)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
+	if form.Pinned {
+		app.sessionManager.Put(r.Context(), "flash", "Snippet pinned to your profile.")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Snippet unpinned from your profile.")
+	}
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
 
-	//Redirect the user to the login page
-	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+// reportableSnippet fetches the snippet with the ID given in the URL, so that
+// the authenticated user can report it. Users can only report the snippets
+// they can see, and not their own ones. If the snippet can't be reported, an
+// error response is sent and ok is false.
+func (app *application) reportableSnippet(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, ok bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return models.Snippet{}, false
+	}
 
-	// Otherwise send the placeholder response (for now!).
-	// fmt.Fprintln(w, "Create a new user...")
+	snippet, err = app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	if snippet.UserID == app.sessionManager.GetInt(r.Context(), "authenticatedUserID") {
+		app.clientError(w, http.StatusForbidden)
+		return models.Snippet{}, false
+	}
 
+	if snippet.IsScheduled() || snippet.Hidden {
+		app.notFound(w)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
 }
 
-func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
-	// fmt.Fprintln(w, "Display an HTML form for logging an user")
+func (app *application) snippetReport(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.reportableSnippet(w, r)
+	if !ok {
+		return
+	}
+
 	data := app.newTemplateData(r)
-	data.Form = userSignUpForm{}
+	data.Snippet = snippet
+	data.Form = snippetReportForm{}
 
-	app.render(w, r, http.StatusOK, "login.tmpl.html", data)
+	app.render(w, r, http.StatusOK, "report.tmpl.html", data)
 }
 
-func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
-
-	// Decode the form data into the userLoginForm struct.
+func (app *application) snippetReportPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.reportableSnippet(w, r)
+	if !ok {
+		return
+	}
 
-	var form userSignUpForm
+	var form snippetReportForm
 
 	err := app.decodePostForm(w, r, &form)
-
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
-	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	reasons := make([]string, len(models.ReportReasons))
+	for i, reason := range models.ReportReasons {
+		reasons[i] = reason.Name
+	}
+
+	form.CheckField(validator.PermittedValue(form.Reason, reasons...), "reason", "Please choose one of the reasons")
+	form.CheckField(validator.MaxChars(form.Details, 1000), "details", "This field cannot be more than 1000 characters long")
 
-	// If there are any errors, re display the login form along with a 422 status code
 	if !form.Valid() {
 		data := app.newTemplateData(r)
+		data.Snippet = snippet
 		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "report.tmpl.html", data)
 		return
 	}
 
-	// Check whether the credentials are valid. If they're not, add a generic
-	// non-field error message and re-display the login page
-	id, err := app.users.Authenticate(form.Email, form.Password)
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 
+	_, err = app.reports.Insert(snippet.ID, userID, form.Reason, form.Details)
 	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentials) {
-			form.AddNonFieldError("Invalid email or password")
-
-			data := app.newTemplateData(r)
-			data.Form = form
-
-			app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		if errors.Is(err, models.ErrDuplicateReport) {
+			app.sessionManager.Put(r.Context(), "flash", "You already reported this snippet. A moderator will look into it soon.")
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
 		} else {
 			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	// Use the RenewToken() method on the current session to change the session
-	// ID. It's good practice to generate a new session ID when the
-	// authentication state or privilege levels changes for the user (e.g. login
-	// and logout operations)
-	err = app.sessionManager.RenewToken(r.Context())
+	app.sessionManager.Put(r.Context(), "flash", "Thanks for your report. A moderator will look into it soon.")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// snippetDraftPost is called in the background by the create form every few
+// seconds, to save what the user has written so far. It responds with the ID
+// of the draft as JSON, which the form sends back with the following saves.
+func (app *application) snippetDraftPost(w http.ResponseWriter, r *http.Request) {
+	var form snippetCreateForm
 
+	err := app.decodePostForm(w, r, &form)
 	if err != nil {
-		app.serverError(w, r, err)
+		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// Add the ID of the current user to the session, so that they are now
-	// 'logged in'.
-	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
-
-	// if user was trying to visit a page prior to login, redirect them to that page
-	if urlToVisit := app.sessionManager.PopString(r.Context(), "urlToVisit"); urlToVisit != "" {
-		http.Redirect(w, r, urlToVisit, http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+	// There's nothing worth saving in an empty form.
+	if !validator.NotBlank(form.Title) && !validator.NotBlank(form.Content) {
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
 
+	// Drafts can be incomplete, so only check what the database can't store.
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(form.Language == "" || validator.PermittedValue(form.Language, language.Names()...), "language", "This field must be one of the listed languages")
+	if !validator.PermittedValue(form.Expires, 1, 7, 365) {
+		form.Expires = 365
+	}
+
+	if !form.Valid() {
+		app.writeJSON(w, r, http.StatusUnprocessableEntity, map[string]any{"errors": form.FieldErrors})
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	id, err := app.drafts.Save(form.DraftID, userID, form.Title, form.Content, form.Language, form.Expires)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusOK, map[string]any{"id": id})
+}
+
+func (app *application) snippetDraftDeletePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	err = app.drafts.Delete(id, app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Draft deleted.")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) snippetImport(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = snippetImportForm{
+		Expires: 365,
+	}
+
+	app.render(w, r, http.StatusOK, "import.tmpl.html", data)
+}
+
+// snippetImportPost reads the uploaded files and shows a preview of the
+// snippets they would become. Nothing is saved until the user confirms the
+// import, which sends the valid snippets to snippetImportConfirmPost.
+func (app *application) snippetImportPost(w http.ResponseWriter, r *http.Request) {
+	// The CSRF middleware has already parsed the multipart form (within the
+	// limit set by http.MaxBytesHandler in routes.go) to find the token.
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var form snippetImportForm
+
+	form.Expires, err = strconv.Atoi(r.PostForm.Get("expires"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+
+	headers := r.MultipartForm.File["files"]
+	form.CheckField(len(headers) > 0, "files", "Please choose at least one file")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "import.tmpl.html", data)
+		return
+	}
+
+	snippets, truncated := readImportUploads(headers)
+
+	if truncated {
+		form.AddNonFieldError(fmt.Sprintf("Only the first %d files, and %d MB in total, can be imported at once.", maxImportFiles, maxImportBytes>>20))
+	}
+
+	for _, s := range snippets {
+		// Snippets which couldn't be read have errors already.
+		if s.Valid() {
+			validateSnippet(&s.Validator, s.Title, s.Content, s.Language)
+		}
+
+		if s.Valid() {
+			// Secrets are only shown in the preview, so that the user can
+			// choose which files to publish anyway when they confirm it.
+			s.Secrets = app.scanner.Scan(s.Content)
+			form.Snippets = append(form.Snippets, s)
+		} else {
+			form.Rejected = append(form.Rejected, s)
+		}
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, r, http.StatusOK, "import.tmpl.html", data)
+}
+
+// snippetImportConfirmPost creates the snippets of a previewed import. Each
+// snippet is validated and scanned for secrets again, and the ones which fail
+// are reported back without preventing the others from being created.
+func (app *application) snippetImportConfirmPost(w http.ResponseWriter, r *http.Request) {
+	var form snippetImportForm
+
+	err := app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	if !form.Valid() {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	for _, s := range form.Snippets {
+		validateSnippet(&s.Validator, s.Title, s.Content, s.Language)
+		if s.Valid() {
+			s.Secrets = app.checkSecrets(&s.Validator, s.Content, s.AllowSecrets)
+		}
+		if !s.Valid() {
+			form.Rejected = append(form.Rejected, s)
+			continue
+		}
+
+		id, err := app.snippets.Insert(userID, s.Title, s.Content, s.Language, form.Expires, time.Time{})
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		form.Imported++
+
+		app.logSecretsOverride(userID, id, s.Secrets)
+
+		app.background(func() error {
+			return app.publishCreated(id)
+		})
+		app.background(func() error {
+			return app.enqueueSnippetWebhooks(webhook.EventSnippetCreated, id)
+		})
+	}
+
+	if len(form.Rejected) > 0 {
+		form.Snippets = nil
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "import.tmpl.html", data)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%d snippets successfully imported!", form.Imported))
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
+
+	// id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Snippets scheduled for later are only visible to their owner until
+	// they're published, and so are the snippets hidden by a moderator.
+	// Everybody else gets the same response as if the snippet didn't exist.
+	if (snippet.IsScheduled() || snippet.Hidden) && snippet.UserID != app.sessionManager.GetInt(r.Context(), "authenticatedUserID") {
+		app.notFound(w)
+		return
+	}
+
+	// Tell the owner of a hidden snippet why it was hidden.
+	var decision models.Decision
+	if snippet.Hidden {
+		decision, err = app.reports.LatestDecision(snippet.ID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// Use the PopString() method to retrieve the value for the "flash" key.
+	// PopString() also deletes the key and value from the session data, so it
+	// acts like a one-time fetch. If there is no matching key in the session
+	// data this will return the empty string.
+	// flash := app.sessionManager.GetString(r.Context(), "flash")
+
+	// The related snippets are computed in the background by refreshRelated.
+	related, err := app.snippets.Related(snippet.ID, relatedSnippets)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.recordHit(r, snippet, models.HitView)
+
+	templateData := app.newTemplateData(r)
+	templateData.Snippet = snippet
+	templateData.Decision = decision
+	templateData.Related = related
+
+	// The lines of encrypted snippets are shown by encrypted.js once it has
+	// decrypted them.
+	if !snippet.ClientEncrypted {
+		templateData.Lines = numberLines(snippet.Content, 0, 0)
+	}
+	// templateData.Flash = flash
+	// fmt.Printf("flash value in SnippetView:::%v\n", flash)
+
+	app.render(w, r, http.StatusOK, "view.tmpl.html", templateData)
+}
+
+// snippetStats shows the owner of a snippet how many times it was seen, per
+// day over the last days and in total, and which sites sent visitors to it.
+func (app *application) snippetStats(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.ownSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -(analyticsChartDays - 1))
+
+	days, err := app.analytics.Daily(snippet.ID, from, to)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	totals, err := app.analytics.Totals(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	referrers, err := app.analytics.TopReferrers(snippet.ID, 10)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Chart = newDailyChart(days)
+	data.HitCounts = totals
+	data.Referrers = referrers
+
+	app.render(w, r, http.StatusOK, "stats.tmpl.html", data)
+}
+
+// publishedSnippet fetches the snippet with the ID given in the URL for the
+// raw and embed endpoints. Those are used outside of the site (by scripts and
+// by other sites) without a session, so snippets scheduled for later are
+// hidden from everybody. Snippets encrypted in the browser are left out too,
+// since only their ciphertext could be shown. If there's no such snippet, a
+// 404 Not Found response is sent and ok is false.
+func (app *application) publishedSnippet(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, ok bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return models.Snippet{}, false
+	}
+
+	snippet, err = app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	if snippet.IsScheduled() || snippet.Hidden || snippet.ClientEncrypted {
+		app.notFound(w)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// requestedLines returns the lines of content selected by the lines query
+// parameter (like ?lines=10-20), or every line if there's none. If the
+// parameter is invalid or starts past the end of the content, a 400 Bad
+// Request response is sent and ok is false.
+func (app *application) requestedLines(w http.ResponseWriter, r *http.Request, content string) (lines []snippetLine, ok bool) {
+	if !r.URL.Query().Has("lines") {
+		return numberLines(content, 0, 0), true
+	}
+
+	first, last, err := parseLineRange(r.URL.Query().Get("lines"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return nil, false
+	}
+
+	lines = numberLines(content, first, last)
+	if len(lines) == 0 {
+		app.clientError(w, http.StatusBadRequest)
+		return nil, false
+	}
+
+	return lines, true
+}
+
+// snippetRaw sends the content of a snippet as plain text, or just some of
+// its lines when asked for with the lines query parameter. With the download
+// query parameter, it's sent as a file named after the snippet.
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.publishedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if r.URL.Query().Has("download") {
+		filename := fmt.Sprintf("snippet-%d%s", snippet.ID, language.Extension(snippet.Language))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		app.recordHit(r, snippet, models.HitDownload)
+	} else {
+		app.recordHit(r, snippet, models.HitRaw)
+	}
+
+	if !r.URL.Query().Has("lines") {
+		w.Write([]byte(snippet.Content))
+		return
+	}
+
+	lines, ok := app.requestedLines(w, r, snippet.Content)
+	if !ok {
+		return
+	}
+
+	for _, line := range lines {
+		w.Write([]byte(line.Text + "\n"))
+	}
+}
+
+// snippetEmbed renders a snippet on its own, to be shown within an <iframe>
+// on other sites. The lines query parameter restricts it to some lines.
+func (app *application) snippetEmbed(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.publishedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	lines, ok := app.requestedLines(w, r, snippet.Content)
+	if !ok {
+		return
+	}
+
+	app.recordHit(r, snippet, models.HitEmbed)
+
+	// Unlike every other page, this one is meant to be framed by other
+	// sites.
+	w.Header().Del("X-Frame-Options")
+	w.Header().Set("Content-Security-Policy",
+		"default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com; frame-ancestors *")
+
+	// There's no session here, so the data of the template is put together
+	// without newTemplateData.
+	data := templateData{
+		CurrentYear: time.Now().Year(),
+		Snippet:     snippet,
+		Lines:       lines,
+		BaseURL:     app.origin,
+	}
+
+	app.render(w, r, http.StatusOK, "embed.tmpl.html", data)
+}
+
+func (app *application) feedAtom(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Latest()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	feed := newAtomFeed(app.origin, app.origin+"/feed.atom", "Snippetbox - Latest snippets", "Snippetbox", snippets)
+
+	app.writeFeed(w, r, "application/atom+xml; charset=utf-8", feedUpdated(snippets), feed)
+}
+
+func (app *application) feedRSS(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Latest()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	feed := newRSSFeed(app.origin, "Snippetbox - Latest snippets", snippets)
+
+	app.writeFeed(w, r, "application/rss+xml; charset=utf-8", feedUpdated(snippets), feed)
+}
+
+func (app *application) userFeedAtom(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	snippets, err := app.snippets.LatestByUser(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	self := fmt.Sprintf("%s/users/%d/feed.atom", app.origin, user.ID)
+	feed := newAtomFeed(app.origin, self, fmt.Sprintf("Snippetbox - Snippets by %s", user.Name), user.Name, snippets)
+
+	app.writeFeed(w, r, "application/atom+xml; charset=utf-8", feedUpdated(snippets), feed)
+}
+
+func (app *application) sitemap(w http.ResponseWriter, r *http.Request) {
+	count, err := app.snippets.CountPublic()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// A single sitemap file can list up to sitemapMaxURLs URLs. Past that, we
+	// send a sitemap index pointing to as many sitemap files as needed.
+	if count > sitemapMaxURLs {
+		pages := (count + sitemapMaxURLs - 1) / sitemapMaxURLs
+		app.writeXML(w, r, newSitemapIndex(app.origin, pages))
+		return
+	}
+
+	refs, err := app.snippets.PublicRefs(0, sitemapMaxURLs)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeXML(w, r, newSitemapURLSet(app.origin, refs))
+}
+
+func (app *application) sitemapPage(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	page, err := strconv.Atoi(strings.TrimSuffix(params.ByName("page"), ".xml"))
+	if err != nil || page < 1 {
+		app.notFound(w)
+		return
+	}
+
+	refs, err := app.snippets.PublicRefs((page-1)*sitemapMaxURLs, sitemapMaxURLs)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if len(refs) == 0 {
+		app.notFound(w)
+		return
+	}
+
+	app.writeXML(w, r, newSitemapURLSet(app.origin, refs))
+}
+
+func (app *application) robots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	// Keep crawlers away from pages which only make sense for a signed in
+	// user, and tell them where the sitemap is.
+	fmt.Fprint(w, "User-agent: *\n")
+	fmt.Fprint(w, "Disallow: /account/\n")
+	fmt.Fprint(w, "Disallow: /snippet/create\n")
+	fmt.Fprint(w, "Disallow: /user/\n")
+	fmt.Fprintf(w, "\nSitemap: %s/sitemap.xml\n", app.origin)
+}
+
+func (app *application) fooHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("Foo"))
+}
+
+func (app *application) userSignUp(w http.ResponseWriter, r *http.Request) {
+	// fmt.Fprintln(w, "Display an HTML form for signing up a new use")
+	data := app.newTemplateData(r)
+	data.Form = userSignUpForm{}
+	app.render(w, r, 200, "signup.tmpl.html", data)
+}
+
+func (app *application) userSignUpPost(w http.ResponseWriter, r *http.Request) {
+
+	var form userSignUpForm
+
+	err := app.decodePostForm(w, r, &form)
+
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Validate the form contents using the helper functions
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+
+	// If there are any errors, re display the signup form along with a 422 status code
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
+		return
+	}
+
+	id, err := app.users.Insert(form.Name, form.Email, form.Password)
+
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFieldError("email", "This email address is already in use")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+
+			app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl.html", data)
+
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	// The account is created whether or not the email can be sent, since
+	// another one can be asked for from the account page.
+	user := models.User{ID: id, Name: form.Name, Email: form.Email}
+
+	err = app.sendVerificationEmail(user)
+	if err != nil {
+		app.logger.Error(err.Error(), "user_id", id)
+		app.sessionManager.Put(r.Context(), "flash", "Your signup was successful, but we couldn't send you the email to verify your address. Please log in and ask for another one from your account page.")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. We've sent you an email with a link to verify your address. Please log in.")
+	}
+
+	//Redirect the user to the login page
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+
+	// Otherwise send the placeholder response (for now!).
+	// fmt.Fprintln(w, "Create a new user...")
+
+}
+
+func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+	// fmt.Fprintln(w, "Display an HTML form for logging an user")
+	data := app.newTemplateData(r)
+	data.Form = userSignUpForm{}
+
+	app.render(w, r, http.StatusOK, "login.tmpl.html", data)
+}
+
+func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
+
+	// Decode the form data into the userLoginForm struct.
+
+	var form userSignUpForm
+
+	err := app.decodePostForm(w, r, &form)
+
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+
+	// If there are any errors, re display the login form along with a 422 status code
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		return
+	}
+
+	// Attempts coming after too many failures, with the same email address or
+	// from the same IP address, are refused without checking the password.
+	ip := app.visitorIP(r)
+
+	attempt, wait, err := app.beginLogin(form.Email, ip)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if wait > 0 {
+		if accountThrottle.locked(attempt.Account) {
+			form.AddNonFieldError(fmt.Sprintf("This account is locked after too many failed login attempts. Please try again in %s, or reset your password.", waitText(wait)))
+		} else {
+			form.AddNonFieldError(fmt.Sprintf("Too many failed login attempts. Please try again in %s.", waitText(wait)))
+		}
+
+		data := app.newTemplateData(r)
+		data.Form = form
+
+		w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+		app.render(w, r, http.StatusTooManyRequests, "login.tmpl.html", data)
+		return
+	}
+
+	// Check whether the credentials are valid. If they're not, add a generic
+	// non-field error message and re-display the login page
+	id, err := app.users.Authenticate(form.Email, form.Password)
+
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.loginFailed(form.Email, ip, attempt)
+
+			form.AddNonFieldError("Invalid email or password")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+
+			app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		} else if errors.Is(err, models.ErrSuspendedUser) {
+			form.AddNonFieldError("Your account has been suspended")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+
+			app.render(w, r, http.StatusForbidden, "login.tmpl.html", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Users who enabled two-factor authentication aren't logged in yet: they
+	// still have to enter a code, which they have a few minutes to do. Until
+	// they do, the attempt still counts as a failure, so that starting over
+	// doesn't give them more codes to try.
+	enabled, err := app.twoFactor.Enabled(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if enabled {
+		err = app.sessionManager.RenewToken(r.Context())
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "twoFactorUserID", id)
+		app.sessionManager.Put(r.Context(), "twoFactorStarted", time.Now().Unix())
+		app.sessionManager.Put(r.Context(), "twoFactorAttempts", 0)
+		app.sessionManager.Put(r.Context(), "loginAttemptID", attempt.ID)
+
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	if app.logIn(w, r, id) {
+		err = app.loginSucceeded(form.Email, attempt.ID)
+		if err != nil {
+			app.logger.Error(err.Error(), "user_id", id)
+		}
+	}
+}
+
+// logIn logs in the given user, once they've proved who they are, and
+// redirects them to the page they were trying to visit. It reports whether
+// they were logged in, an error response having been sent otherwise.
+func (app *application) logIn(w http.ResponseWriter, r *http.Request, id int) bool {
+	// Use the RenewToken() method on the current session to change the session
+	// ID. It's good practice to generate a new session ID when the
+	// authentication state or privilege levels changes for the user (e.g. login
+	// and logout operations)
+	err := app.sessionManager.RenewToken(r.Context())
+
+	if err != nil {
+		app.serverError(w, r, err)
+		return false
+	}
+
+	// Store the session version of the user along with their ID, so that the
+	// session ends when it's bumped.
+	version, err := app.users.SessionVersion(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return false
+	}
+
+	// Add the ID of the current user to the session, so that they are now
+	// 'logged in'.
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+	app.sessionManager.Put(r.Context(), "sessionVersion", version)
+
+	// if user was trying to visit a page prior to login, redirect them to that page
+	if urlToVisit := app.sessionManager.PopString(r.Context(), "urlToVisit"); urlToVisit != "" {
+		http.Redirect(w, r, urlToVisit, http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+	}
+
+	return true
+}
+
+func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+
+	err := app.sessionManager.RenewToken(r.Context())
+
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.sessionManager.Pop(r.Context(), "authenticatedUserID")
+
+	app.sessionManager.Put(r.Context(), "flash", "You've logged out successfully")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+
+}
+
+func ping(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
+}
+
+func (app *application) about(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	// data.Form = userSignUpForm{}
+
+	app.render(w, r, http.StatusOK, "about.tmpl.html", data)
+}
+
+func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	user, err := app.users.Get(id)
+	templateData := app.newTemplateData(r)
+	templateData.User = user
+
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+
+		} else {
+			app.serverError(w, r, err)
+
+		}
+		return
+	}
+
+	// Show the state of the latest export of the user's data, if they ever
+	// requested one.
+	export, err := app.exports.LatestByUser(id)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+	templateData.Export = export
+
+	scheduled, err := app.snippets.ScheduledByUser(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	templateData.Snippets = scheduled
+
+	drafts, err := app.drafts.ByUser(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	templateData.Drafts = drafts
+
+	enabled, err := app.twoFactor.Enabled(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	templateData.TwoFactor.Enabled = enabled
+
+	// fmt.Fprintf(w, "%+v", user)
+	app.render(w, r, http.StatusOK, "account.tmpl.html", templateData)
+}
+
+// moderationQueue lists the snippets with reports which no moderator has made
+// a decision about yet.
+func (app *application) moderationQueue(w http.ResponseWriter, r *http.Request) {
+	queue, err := app.reports.Queue()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Queue = queue
+
+	app.render(w, r, http.StatusOK, "moderation.tmpl.html", data)
+}
+
+// moderationReview shows a reported snippet along with its pending reports,
+// and the form to make a decision about them. Moderators can see any
+// snippet, including the hidden and scheduled ones.
+func (app *application) moderationReview(w http.ResponseWriter, r *http.Request) {
+	snippet, reports, ok := app.reportedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Lines = moderatedLines(snippet)
+	data.Reports = reports
+	data.Form = moderationDecisionForm{}
+
+	app.render(w, r, http.StatusOK, "moderate.tmpl.html", data)
+}
+
+func (app *application) moderationReviewPost(w http.ResponseWriter, r *http.Request) {
+	snippet, reports, ok := app.reportedSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form moderationDecisionForm
+
+	err := app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.PermittedValue(form.Action, models.DecisionDismiss, models.DecisionHide, models.DecisionDelete), "action", "Please choose what to do with this snippet")
+	form.CheckField(validator.NotBlank(form.Note), "note", "Please explain your decision")
+	form.CheckField(validator.MaxChars(form.Note, 1000), "note", "This field cannot be more than 1000 characters long")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Lines = moderatedLines(snippet)
+		data.Reports = reports
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "moderate.tmpl.html", data)
+		return
+	}
+
+	moderatorID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.reports.Decide(snippet.ID, moderatorID, form.Action, form.Note)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.Info("moderation decision", "snippet_id", snippet.ID, "moderator_id", moderatorID, "action", form.Action, "reports", len(reports))
+
+	// The snippet was read before being deleted, so its owner can still be
+	// told what it was.
+	if form.Action == models.DecisionDelete {
+		app.background(func() error {
+			return app.enqueueWebhooks(webhook.EventSnippetDeleted, snippet)
+		})
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your decision has been recorded.")
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
+
+// moderatedLines returns the lines of a snippet shown to moderators. They
+// can't read the snippets encrypted in the browser either.
+func moderatedLines(snippet models.Snippet) []snippetLine {
+	if snippet.ClientEncrypted {
+		return nil
+	}
+	return numberLines(snippet.Content, 0, 0)
+}
+
+// reportedSnippet fetches the snippet with the ID given in the URL for a
+// moderator, along with its pending reports. If there's no such snippet, a
+// 404 Not Found response is sent and ok is false.
+func (app *application) reportedSnippet(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, reports []models.Report, ok bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return models.Snippet{}, nil, false
+	}
+
+	snippet, err = app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, nil, false
+	}
+
+	reports, err = app.reports.BySnippet(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return models.Snippet{}, nil, false
+	}
+
+	return snippet, reports, true
+}
+
+// adminDashboard shows the statistics of the instance, along with the
+// contents which have been posted the most times.
+func (app *application) adminDashboard(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.stats.Get()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	duplicates, err := app.snippets.MostDuplicated(10)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Stats = stats
+	data.Duplicates = duplicates
+
+	app.render(w, r, http.StatusOK, "admin.tmpl.html", data)
+}
+
+// adminUsers searches the users by name or email address, using the q query
+// string parameter.
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	var users []models.User
+	if query != "" {
+		var err error
+		users, err = app.users.Search(query, adminSearchLimit)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	locked, err := app.lockedUsers(users)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Query = query
+	data.Users = users
+	data.LockedUsers = locked
+
+	app.render(w, r, http.StatusOK, "admin-users.tmpl.html", data)
+}
+
+// adminUserSuspendPost suspends a user or lifts their suspension. Admins
+// can't be suspended, so that they can't lock each other out.
+func (app *application) adminUserSuspendPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	var form adminSuspendForm
+
+	err = app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if user.IsAdmin() {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = app.users.SetSuspended(user.ID, form.Suspended)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	adminID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	app.logger.Info("user suspension changed", "user_id", user.ID, "admin_id", adminID, "suspended", form.Suspended)
+
+	if form.Suspended {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s has been suspended.", user.Name))
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s is no longer suspended.", user.Name))
+	}
+	http.Redirect(w, r, "/admin/users?q="+url.QueryEscape(form.Query), http.StatusSeeOther)
+}
+
+// adminUserUnlockPost unlocks the account of a user locked after too many
+// failed login attempts, by forgetting them.
+func (app *application) adminUserUnlockPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	var form adminUnlockForm
+
+	err = app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.logins.Clear(user.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	adminID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	app.logger.Info("user unlocked", "user_id", user.ID, "admin_id", adminID)
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s has been unlocked.", user.Name))
+	http.Redirect(w, r, "/admin/users?q="+url.QueryEscape(form.Query), http.StatusSeeOther)
+}
+
+// adminSnippets searches the snippets of every user by title or content,
+// using the q query string parameter.
+func (app *application) adminSnippets(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	var snippets []models.Snippet
+	if query != "" {
+		var err error
+		snippets, err = app.snippets.Search(query, adminSearchLimit)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	data := app.newTemplateData(r)
+	data.Query = query
+	data.Snippets = snippets
+
+	app.render(w, r, http.StatusOK, "admin-snippets.tmpl.html", data)
+}
+
+// adminSnippetHidePost hides a snippet or makes it visible again. Hiding is
+// recorded as a moderation decision, which closes the pending reports of the
+// snippet and lets its owner know why it was hidden.
+func (app *application) adminSnippetHidePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	var form adminHideForm
+
+	err = app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	adminID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	if form.Hidden {
+		note := strings.TrimSpace(form.Note)
+		if note == "" {
+			note = "Hidden by an administrator."
+		}
+		err = app.reports.Decide(snippet.ID, adminID, models.DecisionHide, note)
+	} else {
+		err = app.snippets.SetHidden(snippet.ID, false)
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.Info("snippet visibility changed", "snippet_id", snippet.ID, "admin_id", adminID, "hidden", form.Hidden)
+
+	if form.Hidden {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet #%d has been hidden.", snippet.ID))
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet #%d is visible again.", snippet.ID))
+	}
+	http.Redirect(w, r, "/admin/snippets?q="+url.QueryEscape(form.Query), http.StatusSeeOther)
+}
+
+// userProfileView shows the public profile of a user: their name, bio and
+// join date, the snippets they pinned, and a paginated list of all of their
+// public snippets.
+func (app *application) userProfileView(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	page := 1
+	if r.URL.Query().Has("page") {
+		page, err = strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			app.notFound(w)
+			return
+		}
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	count, err := app.snippets.CountPublicByUser(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// There's always a first page, even when it's empty.
+	pages := max(1, (count+profilePageSize-1)/profilePageSize)
+	if page > pages {
+		app.notFound(w)
+		return
+	}
+
+	snippets, err := app.snippets.PublicByUser(user.ID, (page-1)*profilePageSize, profilePageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	pinned, err := app.snippets.PinnedByUser(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Profile = userProfile{
+		ID:      user.ID,
+		Name:    user.Name,
+		Bio:     user.Bio,
+		Created: user.Created,
+		Pinned:  pinned,
+		Page:    page,
+		Pages:   pages,
+	}
+	data.Snippets = snippets
+
+	app.render(w, r, http.StatusOK, "profile.tmpl.html", data)
+}
+
+func (app *application) accountBioUpdate(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = userBioForm{Bio: user.Bio}
+
+	app.render(w, r, http.StatusOK, "bio.tmpl.html", data)
+}
+
+func (app *application) accountBioUpdatePost(w http.ResponseWriter, r *http.Request) {
+	var form userBioForm
+
+	err := app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Bio = strings.TrimSpace(form.Bio)
+	form.CheckField(validator.MaxChars(form.Bio, maxBioChars), "bio", fmt.Sprintf("This field cannot be more than %d characters long", maxBioChars))
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "bio.tmpl.html", data)
+		return
+	}
+
+	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.users.UpdateBio(id, form.Bio)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your bio has been updated!")
+	http.Redirect(w, r, fmt.Sprintf("/users/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) accountExportPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	id, err := app.exports.Insert(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Building the archive may take a while for users with lots of data, so
+	// do it in the background and let the account page link to it when it's
+	// ready.
+	app.background(func() error {
+		return app.buildExport(id, userID)
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "Your data export is being prepared. It will be available on this page shortly.")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) accountExportDownload(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	export, err := app.exports.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Users can only download their own data, and only once it's ready and
+	// until it expires, even if its archive wasn't deleted yet.
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if export.UserID != userID || export.Status != models.ExportReady || time.Since(export.Created) > exportRetention {
+		app.notFound(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="snippetbox-export-%d.zip"`, export.ID))
+
+	http.ServeFile(w, r, app.exportPath(export.ID))
+}
+
+func (app *application) accountPasswordUpdate(w http.ResponseWriter, r *http.Request) {
+	// w.Write([]byte("here we'll display a new page with a form for password update"))
+
+	data := app.newTemplateData(r)
+	data.Form = userChangePasswordForm{}
+
+	app.render(w, r, http.StatusOK, "password.tmpl.html", data)
+}
+
+func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http.Request) {
+
+	var form userChangePasswordForm
+
+	err := app.decodePostForm(w, r, &form)
+
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.CurrentPassword), "currentPassword", "This field is required")
+	form.CheckField(validator.NotBlank(form.NewPassword), "newPassword", "This field is required")
+	form.CheckField(validator.NotBlank(form.NewPasswordConfirmation), "newPasswordConfirmation", "This field is required")
+	form.CheckField(validator.MinChars(form.NewPassword, 8), "newPassword", "Your new password must be at least 8 characters")
+	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "newPasswordConfirmation", "The passwords don't match")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+
+		app.render(w, r, http.StatusUnprocessableEntity, "password.tmpl.html", data)
+		return
+	}
+
+	err = app.users.UpdatePassword(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"), form.CurrentPassword, form.NewPassword)
+
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("currentPassword", "The password entered does not match with your current password")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+
+			app.render(w, r, http.StatusUnprocessableEntity, "password.tmpl.html", data)
+		} else if err != nil {
+			app.serverError(w, r, err)
+		}
+		return
+
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "You have changed your password successfully.")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// notificationsView lists the latest notifications of the user.
+func (app *application) notificationsView(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	notifications, err := app.notifications.ByUser(userID, notificationsLimit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Notifications = notifications
+
+	app.render(w, r, http.StatusOK, "notifications.tmpl.html", data)
+}
+
+// notificationsPost marks the notifications of the user as read or clears
+// them, either one or all of them at once.
+func (app *application) notificationsPost(w http.ResponseWriter, r *http.Request) {
+	var form notificationsForm
+
+	err := app.decodePostForm(w, r, &form)
+	if err != nil || form.ID < 0 || !validator.PermittedValue(form.Action, "read", "delete") {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	switch {
+	case form.Action == "read" && form.ID == 0:
+		err = app.notifications.MarkAllRead(userID)
+	case form.Action == "read":
+		err = app.notifications.MarkRead(form.ID, userID)
+	case form.ID == 0:
+		err = app.notifications.DeleteAll(userID)
+	default:
+		err = app.notifications.Delete(form.ID, userID)
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// accountNotifications shows the kinds of notifications the user can opt out
+// of.
+func (app *application) accountNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	disabled, err := app.notifications.DisabledKinds(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	form := notificationSettingsForm{Enabled: make(map[string]bool)}
+	for _, kind := range models.NotificationKinds {
+		form.Enabled[kind.Name] = true
+	}
+	for _, kind := range disabled {
+		form.Enabled[kind] = false
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+
+	app.render(w, r, http.StatusOK, "notification-settings.tmpl.html", data)
+}
+
+// accountNotificationsPost saves the kinds of notifications the user opted
+// out of. Unknown kinds are ignored.
+func (app *application) accountNotificationsPost(w http.ResponseWriter, r *http.Request) {
+	var form notificationSettingsForm
+
+	err := app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var disabled []string
+	for _, kind := range models.NotificationKinds {
+		if !form.Enabled[kind.Name] {
+			disabled = append(disabled, kind.Name)
+		}
+	}
+
+	err = app.notifications.SetDisabledKinds(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"), disabled)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your notification settings have been saved.")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) accountWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := app.webhooks.ByUser(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	form := webhookForm{Events: make(map[string]bool)}
+	for _, event := range webhook.Events {
+		form.Events[event] = true
+	}
+
+	data := app.newTemplateData(r)
+	data.Webhooks = webhooks
+	data.Form = form
+
+	app.render(w, r, http.StatusOK, "webhooks.tmpl.html", data)
+}
+
+func (app *application) accountWebhooksPost(w http.ResponseWriter, r *http.Request) {
+	var form webhookForm
+
+	err := app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var events []string
+	for _, event := range webhook.Events {
+		if form.Events[event] {
+			events = append(events, event)
+		}
+	}
+
+	form.CheckField(validator.NotBlank(form.URL), "url", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.URL, 2000), "url", "This field cannot be more than 2000 characters long")
+	form.CheckField(validWebhookURL(form.URL), "url", "This field must be an http:// or https:// URL")
+	form.CheckField(len(events) > 0, "events", "Please choose at least one event")
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	if !form.Valid() {
+		webhooks, err := app.webhooks.ByUser(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data := app.newTemplateData(r)
+		data.Webhooks = webhooks
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "webhooks.tmpl.html", data)
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	id, err := app.webhooks.Insert(userID, form.URL, secret, events)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your webhook has been added. Use its secret to check the signature of the requests it gets.")
+	http.Redirect(w, r, fmt.Sprintf("/account/webhooks/%d", id), http.StatusSeeOther)
+}
+
+// accountWebhookView shows a webhook of the user along with its secret and
+// the log of its latest deliveries.
+func (app *application) accountWebhookView(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := app.webhooks.Deliveries(hook.ID, webhookLogSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Webhook = hook
+	data.Deliveries = deliveries
+
+	app.render(w, r, http.StatusOK, "webhook.tmpl.html", data)
+}
+
+func (app *application) accountWebhookDeletePost(w http.ResponseWriter, r *http.Request) {
+	hook, ok := app.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.webhooks.Delete(hook.ID, hook.UserID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your webhook has been deleted.")
+	http.Redirect(w, r, "/account/webhooks", http.StatusSeeOther)
+}
+
+// ownWebhook fetches the webhook with the ID given in the URL, as long as it
+// belongs to the authenticated user. Otherwise a 404 Not Found response is
+// sent (so that the webhooks of other users can't be told apart from missing
+// ones) and ok is false.
+func (app *application) ownWebhook(w http.ResponseWriter, r *http.Request) (hook models.Webhook, ok bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return models.Webhook{}, false
+	}
+
+	hook, err = app.webhooks.Get(id, app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Webhook{}, false
+	}
+
+	return hook, true
+}
+
+// userVerifyEmail marks the email address a verification link was sent for
+// as verified. The link works whether or not the user is logged in.
+func (app *application) userVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	next := "/user/login"
+	if app.isAuthenticated(r) {
+		next = "/account/view"
+	}
+
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, email, err := app.parseVerificationToken(params.ByName("token"))
+	if err == nil {
+		err = app.users.VerifyEmail(id, email)
+	}
+
+	switch {
+	case err == nil:
+		app.sessionManager.Put(r.Context(), "flash", "Your email address has been verified. You can now create snippets.")
+	case errors.Is(err, signing.ErrExpiredToken):
+		app.sessionManager.Put(r.Context(), "flash", "This verification link has expired. You can ask for another one from your account page.")
+	case errors.Is(err, signing.ErrInvalidToken), errors.Is(err, models.ErrNoRecord):
+		app.sessionManager.Put(r.Context(), "flash", "This verification link is invalid.")
+	default:
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// accountVerifyEmailPost sends the authenticated user a new link to verify
+// their email address.
+func (app *application) accountVerifyEmailPost(w http.ResponseWriter, r *http.Request) {
+	user, err := app.users.Get(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user.Verified {
+		app.sessionManager.Put(r.Context(), "flash", "Your email address is already verified.")
+		http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+		return
+	}
+
+	err = app.sendVerificationEmail(user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("We've sent a new link to %s.", user.Email))
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+func (app *application) userPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = forgotPasswordForm{}
+	app.render(w, r, http.StatusOK, "forgot-password.tmpl.html", data)
+}
+
+func (app *application) userPasswordForgotPost(w http.ResponseWriter, r *http.Request) {
+	var form forgotPasswordForm
+
+	err := app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "forgot-password.tmpl.html", data)
+		return
+	}
+
+	// The account is looked up and the email sent in the background, so that
+	// neither the response nor the time it takes tell whether there's an
+	// account with this address.
+	email := form.Email
+	app.background(func() error {
+		return app.sendPasswordResetEmail(email)
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("If there's an account for %s, we've sent it a link to reset its password.", form.Email))
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) userPasswordReset(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	app.renderPasswordReset(w, r, http.StatusOK, resetPasswordForm{Token: token})
+}
+
+// renderPasswordReset renders the form to reset a password with the token of
+// the given form, along with the passkeys of the user, which they can remove
+// at the same time in case someone else added them.
+func (app *application) renderPasswordReset(w http.ResponseWriter, r *http.Request, status int, form resetPasswordForm) {
+	userID, err := app.resets.UserID(form.Token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.invalidResetLink(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	passkeys, err := app.passkeys.ByUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	data.Passkeys = passkeys
+	app.render(w, r, status, "reset-password.tmpl.html", data)
+}
+
+func (app *application) userPasswordResetPost(w http.ResponseWriter, r *http.Request) {
+	var form resetPasswordForm
+
+	err := app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.Token = httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	form.CheckField(validator.NotBlank(form.NewPassword), "newPassword", "This field is required")
+	form.CheckField(validator.MinChars(form.NewPassword, 8), "newPassword", "Your new password must be at least 8 characters")
+	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "newPasswordConfirmation", "The passwords don't match")
+
+	if !form.Valid() {
+		app.renderPasswordReset(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	userID, err := app.resets.Reset(form.Token, form.NewPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.invalidResetLink(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Every session of the user has ended along with the reset, including
+	// this one if they were logged in.
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+
+	// Resetting the password unlocks the account.
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.logins.Clear(user.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.Info("password reset", "user_id", userID, "ip", ReadUserIP(r))
+
+	flash := "Your password has been reset. Please log in with your new password."
+
+	if form.RevokePasskeys {
+		n, err := app.passkeys.DeleteAll(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.logger.Info("passkeys removed", "user_id", userID, "passkeys", n, "ip", ReadUserIP(r))
+		flash = "Your password has been reset and your passkeys have been removed. Please log in with your new password."
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// invalidResetLink sends the user who followed an unknown, used or expired
+// password reset link back to the form to ask for another one.
+func (app *application) invalidResetLink(w http.ResponseWriter, r *http.Request) {
+	app.sessionManager.Put(r.Context(), "flash", "This password reset link is invalid or has expired. Please ask for a new one.")
+	http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+}
+
+// accountTwoFactor shows the user how to set up two-factor authentication,
+// or how to manage it once they have.
+func (app *application) accountTwoFactor(w http.ResponseWriter, r *http.Request) {
+	app.renderTwoFactor(w, r, http.StatusOK, nil)
+}
+
+// accountTwoFactorEnablePost enables two-factor authentication once the user
+// has entered a code of the secret they added to their authenticator app,
+// and shows them their recovery codes.
+func (app *application) accountTwoFactorEnablePost(w http.ResponseWriter, r *http.Request) {
+	var form twoFactorCodeForm
+
+	err := app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The secret was forgotten if the session expired meanwhile: start over
+	// with a new one. There's none either when there are no keys to encrypt
+	// it with, which the page explains.
+	secret := app.enrolmentSecret(r)
+	if secret == "" {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+
+	var step int64
+	if form.Valid() {
+		var ok bool
+		step, ok = totp.Validate(secret, form.Code, time.Now(), 0)
+		form.CheckField(ok, "code", "This code is invalid. Check that the time of your device is right and try again")
+	}
+
+	if !form.Valid() {
+		app.renderTwoFactor(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.twoFactor.Enable(userID, secret, step, codes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.forgetEnrolmentSecret(r)
+
+	app.logger.Info("two-factor authentication enabled", "user_id", userID, "ip", ReadUserIP(r))
+
+	data := app.newTemplateData(r)
+	data.TwoFactor = twoFactorSetup{Enabled: true, RecoveryCodes: codes}
+	app.render(w, r, http.StatusOK, "recovery-codes.tmpl.html", data)
+}
+
+// accountTwoFactorDisablePost disables two-factor authentication, once the
+// user has confirmed it with their password.
+func (app *application) accountTwoFactorDisablePost(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.confirmTwoFactorChange(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.twoFactor.Disable(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.Info("two-factor authentication disabled", "user_id", userID, "ip", ReadUserIP(r))
+
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication has been disabled.")
+	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+}
+
+// accountTwoFactorRecoveryPost replaces the recovery codes of the user with
+// new ones, once they've confirmed it with their password.
+func (app *application) accountTwoFactorRecoveryPost(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.confirmTwoFactorChange(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.twoFactor.ReplaceRecoveryCodes(userID, codes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.TwoFactor = twoFactorSetup{Enabled: true, RecoveryCodes: codes}
+	app.render(w, r, http.StatusOK, "recovery-codes.tmpl.html", data)
 }
 
-func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+// confirmTwoFactorChange checks the password the user entered to change
+// their two-factor authentication, and returns their ID if it's right. It
+// re-displays the page otherwise, and the caller should stop there.
+func (app *application) confirmTwoFactorChange(w http.ResponseWriter, r *http.Request) (int, bool) {
+	var form twoFactorPasswordForm
+
+	err := app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return 0, false
+	}
+
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	enabled, err := app.twoFactor.Enabled(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return 0, false
+	}
+	if !enabled {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return 0, false
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
 
-	err := app.sessionManager.RenewToken(r.Context())
+	if form.Valid() {
+		user, err := app.users.Get(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return 0, false
+		}
+
+		id, err := app.users.Authenticate(user.Email, form.Password)
+		if err != nil && !errors.Is(err, models.ErrInvalidCredentials) {
+			app.serverError(w, r, err)
+			return 0, false
+		}
+		form.CheckField(err == nil && id == userID, "password", "Your password is incorrect")
+	}
+
+	if !form.Valid() {
+		app.renderTwoFactor(w, r, http.StatusUnprocessableEntity, form)
+		return 0, false
+	}
 
+	return userID, true
+}
+
+// renderTwoFactor renders the two-factor authentication page of the user,
+// with form as the form of the page when it's re-displayed.
+func (app *application) renderTwoFactor(w http.ResponseWriter, r *http.Request, status int, form any) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	enabled, err := app.twoFactor.Enabled(userID)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
-	app.sessionManager.Pop(r.Context(), "authenticatedUserID")
 
-	app.sessionManager.Put(r.Context(), "flash", "You've logged out successfully")
+	data := app.newTemplateData(r)
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	if enabled {
+		left, err := app.twoFactor.RecoveryCodesLeft(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.TwoFactor = twoFactorSetup{Enabled: true, RecoveryCodesLeft: left}
+		data.Form = twoFactorPasswordForm{}
+	} else {
+		user, err := app.users.Get(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.TwoFactor, err = app.twoFactorEnrolment(r, user)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Form = twoFactorCodeForm{}
+	}
 
-}
+	if form != nil {
+		data.Form = form
+	}
 
-func ping(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("OK"))
+	app.render(w, r, status, "two-factor.tmpl.html", data)
 }
 
-func (app *application) about(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	// data.Form = userSignUpForm{}
+// userLoginTwoFactor asks the user who just entered their password for a
+// code of their authenticator app.
+func (app *application) userLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.pendingTwoFactor(r); !ok {
+		app.twoFactorExpired(w, r)
+		return
+	}
 
-	app.render(w, r, http.StatusOK, "about.tmpl.html", data)
+	data := app.newTemplateData(r)
+	data.Form = twoFactorCodeForm{}
+	app.render(w, r, http.StatusOK, "login-2fa.tmpl.html", data)
 }
 
-func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
-	id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+// userLoginTwoFactorPost logs in the user who entered their password, with a
+// code of their authenticator app or one of their recovery codes. After
+// maxTwoFactorAttempts wrong codes, they have to start over, and every wrong
+// code counts as a failed login attempt of the account.
+func (app *application) userLoginTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.pendingTwoFactor(r)
+	if !ok {
+		app.twoFactorExpired(w, r)
+		return
+	}
+
+	var form twoFactorCodeForm
+
+	err := app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login-2fa.tmpl.html", data)
+		return
+	}
 
 	user, err := app.users.Get(id)
-	templateData := app.newTemplateData(r)
-	templateData.User = user
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Codes are recorded like passwords, so that wrong ones count towards
+	// the lockout of the account, however many are tried at once and in
+	// however many sessions.
+	ip := app.visitorIP(r)
 
+	attempt, wait, err := app.beginLogin(user.Email, ip)
 	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if wait > 0 {
+		form.AddFieldError("code", fmt.Sprintf("Too many failed attempts. Please try again in %s.", waitText(wait)))
+
+		data := app.newTemplateData(r)
+		data.Form = form
+
+		w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+		app.render(w, r, http.StatusTooManyRequests, "login-2fa.tmpl.html", data)
+		return
+	}
+
+	valid, err := app.twoFactor.Validate(id, form.Code, time.Now())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	recovery := false
+	if !valid {
+		recovery, err = app.twoFactor.UseRecoveryCode(id, form.Code)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !valid && !recovery {
+		app.loginFailed(user.Email, ip, attempt)
+
+		attempts := app.sessionManager.GetInt(r.Context(), "twoFactorAttempts") + 1
+
+		if attempts >= maxTwoFactorAttempts {
+			app.logger.Warn("too many invalid two-factor codes", "user_id", id, "ip", ReadUserIP(r))
+
+			app.clearTwoFactor(r)
+			app.sessionManager.Put(r.Context(), "flash", "Too many invalid codes. Please log in again.")
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "twoFactorAttempts", attempts)
+
+		form.AddFieldError("code", "This code is invalid")
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "login-2fa.tmpl.html", data)
+		return
+	}
+
+	attemptID := app.sessionManager.GetInt64(r.Context(), "loginAttemptID")
+	app.clearTwoFactor(r)
+
+	// Recovery codes can only be used once, so let the user know how many
+	// they have left.
+	if recovery {
+		left, err := app.twoFactor.RecoveryCodesLeft(id)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.logger.Info("logged in with a recovery code", "user_id", id, "left", left)
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You've used a recovery code, and have %d left. You can get new ones from your account page.", left))
+	}
+
+	if app.logIn(w, r, id) {
+		err = app.loginSucceeded(user.Email, attemptID, attempt.ID)
+		if err != nil {
+			app.logger.Error(err.Error(), "user_id", id)
+		}
+	}
+}
+
+// twoFactorExpired sends the user back to the login page when there's no
+// login waiting for a code, or it took too long.
+func (app *application) twoFactorExpired(w http.ResponseWriter, r *http.Request) {
+	app.clearTwoFactor(r)
+	app.sessionManager.Put(r.Context(), "flash", "Please log in again.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// accountPasskeys lists the passkeys of the user, with the form to add one.
+func (app *application) accountPasskeys(w http.ResponseWriter, r *http.Request) {
+	app.renderPasskeys(w, r, http.StatusOK, passkeyForm{})
+}
+
+// accountPasskeysPost registers a passkey, with the response of the
+// authenticator to the options of the passkeys page. Since a passkey is
+// enough to log in, the user has to enter their password, and a code of their
+// authenticator app if they have two-factor authentication, and they're
+// told by email once it's added.
+func (app *application) accountPasskeysPost(w http.ResponseWriter, r *http.Request) {
+	var form passkeyForm
+
+	err := app.decodePostForm(w, r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Challenges are only used once, whatever the outcome.
+	challenge := app.sessionManager.PopString(r.Context(), "passkeyChallenge")
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	twoFactor, err := app.twoFactor.Enabled(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, maxPasskeyNameChars), "name", fmt.Sprintf("This field cannot be more than %d characters long", maxPasskeyNameChars))
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	if twoFactor {
+		form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+	}
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if form.Valid() {
+		ok, wait, err := app.reauthenticate(user, form.Password, form.Code, twoFactor, app.visitorIP(r))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if wait > 0 {
+			form.AddFieldError("password", fmt.Sprintf("Too many failed attempts. Please try again in %s.", waitText(wait)))
+
+			w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+			app.renderPasskeys(w, r, http.StatusTooManyRequests, form)
+			return
+		}
+
+		if !ok {
+			if twoFactor {
+				form.AddFieldError("password", "Your password or code is incorrect")
+			} else {
+				form.AddFieldError("password", "Your password is incorrect")
+			}
+		}
+	}
+
+	var cred webauthn.Credential
+	if form.Valid() {
+		attestation, ok := form.attestation()
+		if ok {
+			cred, err = app.relyingParty.Register(challenge, attestation)
+		}
+		if !ok || err != nil {
+			app.logger.Info("passkey not registered", "user_id", userID, "error", err)
+			form.AddNonFieldError("Your passkey couldn't be added. Please try again.")
+		}
+	}
+
+	if !form.Valid() {
+		app.renderPasskeys(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
 
+	_, err = app.passkeys.Insert(userID, form.Name, cred.ID, cred.PublicKey, cred.SignCount)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicatePasskey) {
+			form.AddNonFieldError("This passkey has already been added.")
+			app.renderPasskeys(w, r, http.StatusUnprocessableEntity, form)
 		} else {
 			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Info("passkey added", "user_id", userID, "ip", ReadUserIP(r))
+
+	app.background(func() error {
+		return app.sendMail(user, "passkey-added.tmpl", map[string]any{
+			"Name":    user.Name,
+			"Passkey": form.Name,
+			"Link":    app.origin + "/account/passkeys",
+		})
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "Your passkey has been added. You can now log in with it.")
+	http.Redirect(w, r, "/account/passkeys", http.StatusSeeOther)
+}
+
+// accountPasskeyDeletePost removes a passkey of the user.
+func (app *application) accountPasskeyDeletePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
 
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+
+	err = app.passkeys.Delete(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	// fmt.Fprintf(w, "%+v", user)
-	app.render(w, r, http.StatusOK, "account.tmpl.html", templateData)
+	app.logger.Info("passkey removed", "user_id", userID, "ip", ReadUserIP(r))
+
+	app.sessionManager.Put(r.Context(), "flash", "Your passkey has been removed.")
+	http.Redirect(w, r, "/account/passkeys", http.StatusSeeOther)
 }
 
-func (app *application) accountPasswordUpdate(w http.ResponseWriter, r *http.Request) {
-	// w.Write([]byte("here we'll display a new page with a form for password update"))
+// renderPasskeys renders the passkeys page of the user, with a new challenge
+// to register one.
+func (app *application) renderPasskeys(w http.ResponseWriter, r *http.Request, status int, form passkeyForm) {
+	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
 
-	data := app.newTemplateData(r)
-	data.Form = userChangePasswordForm{}
+	user, err := app.users.Get(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
-	app.render(w, r, http.StatusOK, "password.tmpl.html", data)
+	passkeys, err := app.passkeys.ByUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	twoFactor, err := app.twoFactor.Enabled(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	challenge, err := app.newPasskeyChallenge(r, "passkeyChallenge")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var exclude [][]byte
+	for _, p := range passkeys {
+		exclude = append(exclude, p.CredentialID)
+	}
+
+	data := app.newTemplateData(r)
+	data.Passkeys = passkeys
+	data.TwoFactor = twoFactorSetup{Enabled: twoFactor}
+	data.PasskeyOptions = app.relyingParty.CreationOptions(challenge, webauthn.User{
+		ID:          passkeyUserHandle(userID),
+		Name:        user.Email,
+		DisplayName: user.Name,
+	}, exclude)
+	data.Form = form
+
+	app.render(w, r, status, "passkeys.tmpl.html", data)
 }
 
-func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http.Request) {
+// userLoginPasskey shows the page to log in with a passkey.
+func (app *application) userLoginPasskey(w http.ResponseWriter, r *http.Request) {
+	app.renderPasskeyLogin(w, r, http.StatusOK, passkeyLoginForm{})
+}
 
-	var form userChangePasswordForm
+// userLoginPasskeyPost logs in the user whose passkey signed the challenge of
+// the login page. Passkeys require the user to be verified by their
+// authenticator (with a PIN or a biometric), so they aren't asked for a code
+// of their authenticator app on top of it.
+func (app *application) userLoginPasskeyPost(w http.ResponseWriter, r *http.Request) {
+	var form passkeyLoginForm
 
 	err := app.decodePostForm(w, r, &form)
-
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.CurrentPassword), "currentPassword", "This field is required")
-	form.CheckField(validator.NotBlank(form.NewPassword), "newPassword", "This field is required")
-	form.CheckField(validator.NotBlank(form.NewPasswordConfirmation), "newPasswordConfirmation", "This field is required")
-	form.CheckField(validator.MinChars(form.NewPassword, 8), "newPassword", "Your new password must be at least 8 characters")
-	form.CheckField(form.NewPassword == form.NewPasswordConfirmation, "newPasswordConfirmation", "The passwords don't match")
+	// Challenges are only used once, whatever the outcome.
+	challenge := app.sessionManager.PopString(r.Context(), "passkeyLoginChallenge")
 
-	if !form.Valid() {
-		data := app.newTemplateData(r)
-		data.Form = form
+	invalid := func(reason string, err error) {
+		app.logger.Info("passkey login failed", "reason", reason, "error", err, "ip", ReadUserIP(r))
 
-		app.render(w, r, http.StatusUnprocessableEntity, "password.tmpl.html", data)
+		form.AddNonFieldError("Your passkey couldn't be verified. Please try again.")
+		app.renderPasskeyLogin(w, r, http.StatusUnprocessableEntity, form)
+	}
+
+	assertion, ok := form.assertion()
+	if !ok {
+		invalid("malformed response", nil)
 		return
 	}
 
-	err = app.users.UpdatePassword(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"), form.CurrentPassword, form.NewPassword)
+	passkey, err := app.passkeys.GetByCredentialID(assertion.CredentialID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			invalid("unknown passkey", nil)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
 
+	signCount, err := app.relyingParty.Verify(challenge, webauthn.Credential{
+		ID:        passkey.CredentialID,
+		PublicKey: passkey.PublicKey,
+		SignCount: passkey.SignCount,
+	}, assertion)
 	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentials) {
-			form.AddFieldError("currentPassword", "The password entered does not match with your current password")
+		if errors.Is(err, webauthn.ErrClonedAuthenticator) {
+			app.logger.Warn("passkey may have been cloned", "passkey_id", passkey.ID, "user_id", passkey.UserID)
+		}
+		invalid("invalid assertion", err)
+		return
+	}
 
-			data := app.newTemplateData(r)
-			data.Form = form
+	if len(assertion.UserHandle) > 0 && !bytes.Equal(assertion.UserHandle, passkeyUserHandle(passkey.UserID)) {
+		invalid("wrong user handle", nil)
+		return
+	}
 
-			app.render(w, r, http.StatusUnprocessableEntity, "password.tmpl.html", data)
-		} else if err != nil {
+	user, err := app.users.Get(passkey.UserID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user.Suspended {
+		form.AddNonFieldError("Your account has been suspended")
+		app.renderPasskeyLogin(w, r, http.StatusForbidden, form)
+		return
+	}
+
+	// Raising the counter fails if another request used the same signature
+	// meanwhile.
+	err = app.passkeys.Use(passkey.ID, signCount)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			invalid("signature already used", nil)
+		} else {
 			app.serverError(w, r, err)
 		}
 		return
+	}
+
+	app.logger.Info("logged in with a passkey", "user_id", user.ID, "passkey_id", passkey.ID, "ip", ReadUserIP(r))
+
+	app.logIn(w, r, user.ID)
+}
 
+// renderPasskeyLogin renders the page to log in with a passkey, with a new
+// challenge.
+func (app *application) renderPasskeyLogin(w http.ResponseWriter, r *http.Request, status int, form passkeyLoginForm) {
+	challenge, err := app.newPasskeyChallenge(r, "passkeyLoginChallenge")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "You have changed your password successfully.")
-	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
+	data := app.newTemplateData(r)
+	data.PasskeyOptions = app.relyingParty.RequestOptions(challenge, nil)
+	data.Form = form
+
+	app.render(w, r, status, "login-passkey.tmpl.html", data)
 }
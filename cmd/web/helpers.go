@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -10,6 +12,8 @@ import (
 	"time"
 
 	"github.com/go-playground/form/v4"
+	"github.com/juliflorezg/lets-go/internal/scanner"
+	"github.com/juliflorezg/lets-go/internal/validator"
 	"github.com/justinas/nosurf"
 )
 
@@ -80,12 +84,20 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 
 func (app *application) newTemplateData(r *http.Request) templateData {
 	fmt.Printf("flash value in helper for SnippetView:::%v\n", app.sessionManager.GetString(r.Context(), "flash"))
-	return templateData{
+	data := templateData{
 		CurrentYear:     time.Now().Year(),
 		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
 		IsAuthenticated: app.isAuthenticated(r),
 		CSRFToken:       nosurf.Token(r),
+		BaseURL:         app.origin,
 	}
+
+	if data.IsAuthenticated {
+		data.UserID = app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+		data.UnreadNotifications, _ = r.Context().Value(unreadNotificationsContextKey).(int)
+	}
+
+	return data
 }
 
 func ReadUserIP(r *http.Request) string {
@@ -99,6 +111,19 @@ func ReadUserIP(r *http.Request) string {
 	return IPAddress
 }
 
+// writeJSON encodes v as JSON and sends it with the given status code.
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
 // Create a new decodePostForm() helper method. The second parameter here, dst,
 // is the target destination that we want to decode the form data into.
 func (app *application) decodePostForm(w http.ResponseWriter, r *http.Request, dst any) error {
@@ -130,6 +155,24 @@ func (app *application) decodePostForm(w http.ResponseWriter, r *http.Request, d
 	return nil
 }
 
+// background runs fn in a new goroutine. Any error returned by fn, or any
+// panic raised by it, is logged instead of being lost or crashing the
+// application.
+func (app *application) background(fn func() error) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprintf("%s", err), "trace", string(debug.Stack()))
+			}
+		}()
+
+		err := fn()
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	}()
+}
+
 func (app *application) isAuthenticated(r *http.Request) bool {
 	// return app.sessionManager.Exists(r.Context(), "authenticatedUserID")
 
@@ -140,3 +183,46 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 
 	return isAuthenticated
 }
+
+// checkSecrets looks for secrets (like API keys or passwords) in the content
+// of a snippet. Unless the user has chosen to publish it anyway, finding any
+// adds an error to the form, which blocks the snippet from being saved. The
+// findings are returned either way, so they can be shown to the user or
+// logged with logSecretsOverride.
+func (app *application) checkSecrets(v *validator.Validator, content string, allow bool) []scanner.Finding {
+	findings := app.scanner.Scan(content)
+
+	if len(findings) > 0 && !allow {
+		v.AddNonFieldError("This snippet seems to contain secrets, which anybody could read once it's published. Please remove them, or confirm that you want to publish it anyway.")
+	}
+
+	return findings
+}
+
+// logSecretsOverride records that a user saved a snippet even though secrets
+// were found in it. Only the names of the rules and the lines they matched on
+// are logged, never the secrets themselves.
+func (app *application) logSecretsOverride(userID, snippetID int, findings []scanner.Finding) {
+	if len(findings) == 0 {
+		return
+	}
+
+	rules := make([]string, len(findings))
+	lines := make([]int, len(findings))
+	for i, f := range findings {
+		rules[i] = f.Rule
+		lines[i] = f.Line
+	}
+
+	app.logger.Warn("secret scanner warning overridden", "user_id", userID, "snippet_id", snippetID, "rules", rules, "lines", lines)
+}
+
+// isClientCiphertext reports whether content looks like a snippet encrypted
+// by encrypted.js: the base64 encoding of a 12 byte nonce followed by the
+// AES-GCM ciphertext of a non-empty content and its 16 byte tag. It can't
+// tell whether the ciphertext is genuine, but catches forms sent in plain
+// text by mistake.
+func isClientCiphertext(content string) bool {
+	b, err := base64.StdEncoding.DecodeString(content)
+	return err == nil && len(b) > 12+16
+}
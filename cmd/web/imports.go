@@ -0,0 +1,365 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/juliflorezg/lets-go/internal/export"
+	"github.com/juliflorezg/lets-go/internal/language"
+)
+
+const (
+	// maxImportSize is the maximum size of a whole import request body.
+	maxImportSize = 10 << 20
+	// maxImportFileSize is the maximum size of each imported file, once
+	// extracted from its archive.
+	maxImportFileSize = 1 << 20
+	// maxImportFiles is the maximum number of files read in one import.
+	maxImportFiles = 100
+	// maxImportBytes is the maximum size of all the files read in one
+	// import, once extracted from their archives.
+	maxImportBytes = 10 << 20
+	// maxImportConfirmSize is the maximum size of the request body which
+	// confirms an import, which holds the contents of the snippets URL
+	// encoded, at up to three times their size.
+	maxImportConfirmSize = 3*maxImportBytes + 1<<20
+)
+
+var (
+	errImportFileTooLarge = fmt.Errorf("This file is larger than %d KB", maxImportFileSize>>10)
+	errImportTooLarge     = fmt.Errorf("The files of this import are larger than %d MB in total", maxImportBytes>>20)
+)
+
+// importBudget is what is left to read in an import request: the number of
+// files, and the number of bytes once decompressed. It's shared by all the
+// uploads and archives of the request, and reading stops as soon as it's
+// used up, so that no archive can make the server decompress more than
+// maxImportBytes, however it's built. Truncated records whether something
+// was left out because of it.
+type importBudget struct {
+	files     int
+	bytes     int64
+	truncated bool
+}
+
+// budgetReader reads from r, taking the bytes it reads from the budget, and
+// fails with errImportTooLarge once the budget is used up.
+type budgetReader struct {
+	r      io.Reader
+	budget *importBudget
+}
+
+func (br budgetReader) Read(p []byte) (int, error) {
+	if br.budget.bytes <= 0 {
+		br.budget.truncated = true
+		return 0, errImportTooLarge
+	}
+	if int64(len(p)) > br.budget.bytes {
+		p = p[:br.budget.bytes]
+	}
+
+	n, err := br.r.Read(p)
+	br.budget.bytes -= int64(n)
+	return n, err
+}
+
+// spent reports whether the budget is used up, in which case whatever is
+// left to read is left out.
+func (b *importBudget) spent() bool {
+	if b.files <= 0 || b.bytes <= 0 {
+		b.truncated = true
+		return true
+	}
+	return false
+}
+
+// take reports whether there's a file left in the budget, and takes it if
+// so.
+func (b *importBudget) take() bool {
+	if b.spent() {
+		return false
+	}
+	b.files--
+	return true
+}
+
+// importFile is a file read from an import request, either uploaded on its
+// own or extracted from an archive. If it couldn't be read, err says why.
+// The title and language of the snippet are derived from the file name,
+// unless they are known already because the file comes from a data export.
+type importFile struct {
+	name     string
+	title    string
+	language string
+	content  []byte
+	err      error
+}
+
+// readImportUploads reads every uploaded file, extracting the contents of zip
+// and tar.gz archives, and turns each of them into a snippet to import. Files
+// which can't be read are returned too, with an error attached, so they can be
+// reported to the user without aborting the whole import. The second return
+// value reports whether some files were left out because there were more
+// than maxImportFiles of them, or more than maxImportBytes in total.
+func readImportUploads(headers []*multipart.FileHeader) ([]importSnippet, bool) {
+	budget := &importBudget{files: maxImportFiles, bytes: maxImportBytes}
+
+	var files []importFile
+
+	for _, fh := range headers {
+		files = append(files, readUpload(fh, budget)...)
+	}
+
+	// The index of a data export may list more snippets than were read.
+	truncated := budget.truncated || len(files) > maxImportFiles
+	if len(files) > maxImportFiles {
+		files = files[:maxImportFiles]
+	}
+
+	snippets := make([]importSnippet, 0, len(files))
+
+	for _, f := range files {
+		s := importSnippet{
+			Filename: f.name,
+			Title:    f.title,
+			Language: f.language,
+		}
+		if s.Title == "" {
+			s.Title = path.Base(f.name)
+		}
+		if s.Language == "" {
+			s.Language = language.FromFilename(f.name)
+		}
+
+		if f.err != nil {
+			s.AddNonFieldError(f.err.Error())
+		} else if !utf8.Valid(f.content) {
+			s.AddNonFieldError("This file doesn't look like a text file")
+		} else {
+			s.Content = string(f.content)
+		}
+
+		snippets = append(snippets, s)
+	}
+
+	return snippets, truncated
+}
+
+// readUpload reads a single uploaded file, which may be an archive, within
+// the budget of the import.
+func readUpload(fh *multipart.FileHeader, budget *importBudget) []importFile {
+	if budget.spent() {
+		return nil
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return []importFile{{name: fh.Filename, err: err}}
+	}
+	defer f.Close()
+
+	name := strings.ToLower(fh.Filename)
+
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		files, err := readZip(f, fh.Size, budget)
+		if err != nil {
+			return []importFile{{name: fh.Filename, err: errors.New("This archive could not be read")}}
+		}
+		return fromExport(files)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		files, err := readTarGz(f, budget)
+		if err != nil {
+			return []importFile{{name: fh.Filename, err: errors.New("This archive could not be read")}}
+		}
+		return fromExport(files)
+	}
+
+	budget.files--
+
+	content, err := readLimited(budgetReader{f, budget})
+	return []importFile{{name: fh.Filename, content: content, err: err}}
+}
+
+// readZip reads the files of a zip archive within the budget of the import.
+// Only the entries which are read are decompressed.
+func readZip(r io.ReaderAt, size int64, budget *importBudget) ([]importFile, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []importFile
+	index := false
+
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() || skipArchiveEntry(zf.Name) {
+			continue
+		}
+
+		if !readArchiveEntry(zf.Name, &index, budget) {
+			if budget.bytes <= 0 {
+				break
+			}
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			files = append(files, importFile{name: zf.Name, err: err})
+			continue
+		}
+
+		content, err := readLimited(budgetReader{rc, budget})
+		rc.Close()
+
+		files = append(files, importFile{name: zf.Name, content: content, err: err})
+	}
+
+	return files, nil
+}
+
+// readTarGz reads the files of a tar.gz archive within the budget of the
+// import. The whole archive is decompressed to go through it, including the
+// entries which aren't read, so it all counts against the budget.
+func readTarGz(r io.Reader, budget *importBudget) ([]importFile, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(budgetReader{gr, budget})
+
+	var files []importFile
+	index := false
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Whatever tar makes of it, the rest of the archive is left
+			// out once the budget is used up.
+			if budget.bytes <= 0 {
+				break
+			}
+			return nil, err
+		}
+
+		if hdr.Typeflag != tar.TypeReg || skipArchiveEntry(hdr.Name) {
+			continue
+		}
+
+		if !readArchiveEntry(hdr.Name, &index, budget) {
+			continue
+		}
+
+		content, err := readLimited(tr)
+		files = append(files, importFile{name: hdr.Name, content: content, err: err})
+	}
+
+	return files, nil
+}
+
+// skipArchiveEntry reports whether an archive entry is operating system
+// clutter (like macOS resource forks) rather than a file to import.
+func skipArchiveEntry(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+// readArchiveEntry reports whether an archive entry should be read, taking
+// it from the budget of the import if so. The index of a data export, which
+// is written after the snippet files, is read even once there are no files
+// left in the budget, but only once per archive; index records whether it
+// was read already.
+func readArchiveEntry(name string, index *bool, budget *importBudget) bool {
+	if name == export.SnippetsFile {
+		if *index || budget.bytes <= 0 {
+			return false
+		}
+		*index = true
+		return true
+	}
+
+	return budget.take()
+}
+
+// readLimited reads r to the end, failing if it holds more than
+// maxImportFileSize bytes.
+func readLimited(r io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, maxImportFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) > maxImportFileSize {
+		return nil, errImportFileTooLarge
+	}
+
+	return content, nil
+}
+
+// fromExport recognises archives produced by a data export (see the export
+// package) and returns their snippet files along with the title and language
+// recorded for them, dropping the rest of the export. Any other archive is
+// returned unchanged.
+func fromExport(files []importFile) []importFile {
+	var index *importFile
+	contents := make(map[string]importFile, len(files))
+
+	for i, f := range files {
+		if f.name == export.SnippetsFile {
+			index = &files[i]
+		}
+		contents[f.name] = f
+	}
+
+	if index == nil || index.err != nil {
+		return files
+	}
+
+	var snippets []export.Snippet
+
+	err := json.NewDecoder(bytes.NewReader(index.content)).Decode(&snippets)
+	if err != nil {
+		return files
+	}
+
+	restored := make([]importFile, 0, len(snippets))
+
+	for _, s := range snippets {
+		f, ok := contents[s.File]
+		if !ok {
+			f = importFile{name: s.File, err: errors.New("This snippet's content is missing from the archive")}
+		}
+
+		// The key of encrypted snippets isn't part of the export, so they
+		// would be imported as unreadable ciphertexts.
+		if s.Encrypted {
+			f.err = errors.New("Snippets encrypted in the browser can't be imported")
+		}
+
+		f.title = s.Title
+		f.language = s.Language
+		restored = append(restored, f)
+	}
+
+	return restored
+}
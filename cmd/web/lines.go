@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errInvalidLineRange = errors.New("invalid line range")
+
+// snippetLine is a line of a snippet's content, as rendered with its number
+// so that it can be linked to (like /snippet/view/1#L10).
+type snippetLine struct {
+	Number int
+	Text   string
+}
+
+// splitLines splits content into lines. A trailing newline doesn't start a
+// new, empty line.
+func splitLines(content string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.TrimSuffix(content, "\n")
+	return strings.Split(content, "\n")
+}
+
+// parseLineRange parses the value of a lines query parameter, which is either
+// a single line number ("10") or an inclusive range of them ("10-20"). Line
+// numbers start at 1.
+func parseLineRange(value string) (first, last int, err error) {
+	from, to, isRange := strings.Cut(value, "-")
+
+	first, err = strconv.Atoi(from)
+	if err != nil || first < 1 {
+		return 0, 0, errInvalidLineRange
+	}
+
+	last = first
+	if isRange {
+		last, err = strconv.Atoi(to)
+		if err != nil || last < first {
+			return 0, 0, errInvalidLineRange
+		}
+	}
+
+	return first, last, nil
+}
+
+// numberLines returns the lines of content from first to last (both
+// included), along with their numbers. A last line past the end of the
+// content stands for the end of the content, and a zero range (0, 0) selects
+// every line. If first is past the end of the content, no line is returned.
+func numberLines(content string, first, last int) []snippetLine {
+	lines := splitLines(content)
+
+	if first == 0 && last == 0 {
+		first, last = 1, len(lines)
+	}
+	if first > len(lines) {
+		return nil
+	}
+	last = min(last, len(lines))
+
+	numbered := make([]snippetLine, 0, last-first+1)
+	for n := first; n <= last; n++ {
+		numbered = append(numbered, snippetLine{Number: n, Text: lines[n-1]})
+	}
+
+	return numbered
+}
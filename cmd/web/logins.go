@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+// loginThrottle is how failed login attempts slow down the next ones. The
+// first FreeFailures cost nothing; after that, every failure doubles how
+// long the next attempt has to wait, from BaseDelay up to MaxDelay. Once
+// there were LockoutAfter failures, no attempt is allowed until Lockout has
+// passed since the last one.
+//
+// Failures only count for loginFailureWindow, which is also how long
+// lockouts last, so a lockout ends as soon as enough of them are older than
+// that: at most Lockout after the last one.
+type loginThrottle struct {
+	FreeFailures int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockoutAfter int
+	Lockout      time.Duration
+}
+
+// loginFailureWindow is how long failed login attempts count for.
+const loginFailureWindow = 15 * time.Minute
+
+var (
+	// accountThrottle applies to the attempts made with an email address,
+	// wherever they come from.
+	accountThrottle = loginThrottle{
+		FreeFailures: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     30 * time.Second,
+		LockoutAfter: 10,
+		Lockout:      loginFailureWindow,
+	}
+
+	// ipThrottle applies to the attempts made from an IP address, whatever
+	// the accounts, so that guessing the passwords of many accounts at once
+	// is slowed down too. It's more lenient, since many users can share an
+	// address.
+	ipThrottle = loginThrottle{
+		FreeFailures: 10,
+		BaseDelay:    time.Second,
+		MaxDelay:     30 * time.Second,
+		LockoutAfter: 100,
+		Lockout:      loginFailureWindow,
+	}
+)
+
+// retryAfter returns how long to wait, from now, before the next attempt is
+// allowed after the given failures. It's zero or negative if it's allowed
+// right away.
+func (t loginThrottle) retryAfter(f models.LoginFailures, now time.Time) time.Duration {
+	switch {
+	case f.Count >= t.LockoutAfter:
+		return f.Last.Add(t.Lockout).Sub(now)
+	case f.Count > t.FreeFailures:
+		delay := t.MaxDelay
+		if n := f.Count - t.FreeFailures - 1; n < 30 && t.BaseDelay<<n < t.MaxDelay {
+			delay = t.BaseDelay << n
+		}
+		return f.Last.Add(delay).Sub(now)
+	}
+	return 0
+}
+
+// locked reports whether the given failures lock out the next attempts.
+func (t loginThrottle) locked(f models.LoginFailures) bool {
+	return f.Count >= t.LockoutAfter
+}
+
+// beginLogin records a login attempt with an email address, from an IP
+// address, and returns how long to wait before trying to log in with them,
+// which is zero if it can be done right away. Attempts which have to wait
+// are forgotten, so that they don't make the wait any longer.
+//
+// The attempt is recorded before the password is checked, and counts as a
+// failure until loginSucceeded is called, so that concurrent attempts can't
+// all get in before the first failure is recorded.
+func (app *application) beginLogin(email, ip string) (models.LoginAttempt, time.Duration, error) {
+	now := time.Now()
+
+	attempt, err := app.logins.Begin(email, ip, now.Add(-loginFailureWindow))
+	if err != nil {
+		return models.LoginAttempt{}, 0, err
+	}
+
+	wait := max(accountThrottle.retryAfter(attempt.Account, now), ipThrottle.retryAfter(attempt.IP, now), 0)
+	if wait > 0 {
+		err = app.logins.Delete(attempt.ID)
+		if err != nil {
+			return models.LoginAttempt{}, 0, err
+		}
+	}
+
+	return attempt, wait, nil
+}
+
+// loginFailed is called when a login attempt failed, which stays recorded,
+// and notifies the owner of the account if it's the one which locks it.
+func (app *application) loginFailed(email, ip string, attempt models.LoginAttempt) {
+	if attempt.Account.Count+1 == accountThrottle.LockoutAfter {
+		app.logger.Warn("account locked", "ip", ip)
+
+		app.background(func() error {
+			return app.notifyLockout(email)
+		})
+	}
+}
+
+// loginSucceeded forgets the failed login attempts with the email address of
+// a user who just logged in, along with the attempts they logged in with
+// (their password, and their code if they have two-factor authentication),
+// which don't count against their IP address either.
+func (app *application) loginSucceeded(email string, attemptIDs ...int64) error {
+	for _, id := range attemptIDs {
+		err := app.logins.Delete(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return app.logins.Clear(email)
+}
+
+// reauthenticate checks the password of a logged in user, and the code of
+// their authenticator app if they have two-factor authentication, before a
+// change which lets whoever makes it log in as them. The attempts are
+// recorded like logins, so that a stolen session can't be used to guess
+// them either: it returns how long to wait if there were too many failures,
+// and otherwise whether the password and code are right.
+func (app *application) reauthenticate(user models.User, password, code string, twoFactor bool, ip string) (bool, time.Duration, error) {
+	attempt, wait, err := app.beginLogin(user.Email, ip)
+	if err != nil || wait > 0 {
+		return false, wait, err
+	}
+
+	id, err := app.users.Authenticate(user.Email, password)
+	if err != nil && !errors.Is(err, models.ErrInvalidCredentials) {
+		return false, 0, err
+	}
+
+	ok := err == nil && id == user.ID
+	if ok && twoFactor {
+		ok, err = app.twoFactor.Validate(user.ID, code, time.Now())
+		if err != nil {
+			return false, 0, err
+		}
+	}
+
+	if !ok {
+		app.loginFailed(user.Email, ip, attempt)
+		return false, 0, nil
+	}
+
+	return true, 0, app.logins.Delete(attempt.ID)
+}
+
+// notifyLockout tells the user with the given email address, if there's
+// one, that their account was locked, with a notification and an email.
+func (app *application) notifyLockout(email string) error {
+	user, err := app.users.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	err = app.notifications.NotifyLocked(user.ID)
+	if err != nil {
+		return err
+	}
+
+	return app.sendMail(user, "account-locked.tmpl", map[string]any{
+		"Name":    user.Name,
+		"Lockout": waitText(accountThrottle.Lockout),
+	})
+}
+
+// lockedUsers returns the IDs of the given users whose account is locked.
+func (app *application) lockedUsers(users []models.User) (map[int]bool, error) {
+	emails := make([]string, len(users))
+	for i, user := range users {
+		emails[i] = user.Email
+	}
+
+	since := time.Now().Add(-loginFailureWindow)
+
+	lockedEmails, err := app.logins.Locked(emails, since, accountThrottle.LockoutAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	locked := make(map[int]bool)
+	for _, email := range lockedEmails {
+		for _, user := range users {
+			if strings.EqualFold(user.Email, email) {
+				locked[user.ID] = true
+			}
+		}
+	}
+
+	return locked, nil
+}
+
+// waitText returns a duration the way it's shown to users, rounded up to
+// the second or, past a minute, to the minute.
+func waitText(d time.Duration) string {
+	if d <= time.Minute {
+		seconds := int((d + time.Second - 1) / time.Second)
+		if seconds <= 1 {
+			return "1 second"
+		}
+		return fmt.Sprintf("%d seconds", seconds)
+	}
+
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+// pruneLoginFailures deletes the failed login attempts which don't count
+// anymore, once an hour for as long as the application runs.
+func (app *application) pruneLoginFailures() error {
+	for {
+		n, err := app.logins.DeleteBefore(time.Now().Add(-loginFailureWindow))
+		if err != nil {
+			app.logger.Error(err.Error())
+		} else if n > 0 {
+			app.logger.Info("login failures pruned", "failures", n)
+		}
+
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/mailer"
+	"github.com/juliflorezg/lets-go/internal/models"
+	"github.com/juliflorezg/lets-go/internal/signing"
+	"github.com/juliflorezg/lets-go/ui"
+)
+
+const (
+	// verificationTTL is how long the links sent to verify email addresses
+	// work for.
+	verificationTTL = 48 * time.Hour
+
+	// verifyEmailPurpose is the purpose of the tokens in those links.
+	verifyEmailPurpose = "verify-email"
+
+	// resetTTL is how long the links sent to reset passwords work for.
+	resetTTL = time.Hour
+)
+
+// sendMail renders the email template with the given name, from the ui/mail
+// directory, and sends it to a user. Email templates define a "subject" and
+// a "body" template.
+func (app *application) sendMail(user models.User, name string, data any) error {
+	ts, err := template.New(name).Funcs(template.FuncMap{"humanDate": humanDate}).ParseFS(ui.Files, "mail/"+name)
+	if err != nil {
+		return err
+	}
+
+	var subject, body bytes.Buffer
+
+	err = ts.ExecuteTemplate(&subject, "subject", data)
+	if err != nil {
+		return err
+	}
+
+	err = ts.ExecuteTemplate(&body, "body", data)
+	if err != nil {
+		return err
+	}
+
+	to := mail.Address{Name: user.Name, Address: user.Email}
+
+	return app.mailer.Send(mailer.Message{
+		To:      to.String(),
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    body.String(),
+	})
+}
+
+// sendVerificationEmail sends a user the link to verify their email
+// address. The link points to the configured origin rather than to the host
+// of the request, which clients can set to anything.
+func (app *application) sendVerificationEmail(user models.User) error {
+	expires := time.Now().Add(verificationTTL)
+	token := app.signer.Sign(verifyEmailPurpose, fmt.Sprintf("%d:%s", user.ID, user.Email), expires)
+
+	return app.sendMail(user, "verify-email.tmpl", map[string]any{
+		"Name":    user.Name,
+		"Link":    app.origin + "/user/verify/" + token,
+		"Expires": expires,
+	})
+}
+
+// parseVerificationToken returns the ID of the user and the email address a
+// verification link was sent for. The errors are the ones of
+// signing.Signer.Verify.
+func (app *application) parseVerificationToken(token string) (int, string, error) {
+	value, err := app.signer.Verify(verifyEmailPurpose, token, time.Now())
+	if err != nil {
+		return 0, "", err
+	}
+
+	id, email, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, "", signing.ErrInvalidToken
+	}
+
+	userID, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, "", signing.ErrInvalidToken
+	}
+
+	return userID, email, nil
+}
+
+// sendPasswordResetEmail sends the user with the given email address a link
+// to reset their password, if there's such a user. Like the verification
+// links, it points to the configured origin.
+func (app *application) sendPasswordResetEmail(email string) error {
+	user, err := app.users.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	// Suspended users couldn't log in with their new password anyway.
+	if user.Suspended {
+		return nil
+	}
+
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	expires := time.Now().Add(resetTTL)
+
+	err = app.resets.Insert(user.ID, token, expires)
+	if err != nil {
+		return err
+	}
+
+	return app.sendMail(user, "reset-password.tmpl", map[string]any{
+		"Name":    user.Name,
+		"Link":    app.origin + "/user/password/reset/" + token,
+		"Expires": expires,
+	})
+}
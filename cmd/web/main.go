@@ -7,12 +7,20 @@ import (
 	"html/template"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"time"
 
 	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
+	"github.com/juliflorezg/lets-go/internal/encryption"
+	"github.com/juliflorezg/lets-go/internal/mailer"
 	"github.com/juliflorezg/lets-go/internal/models"
+	"github.com/juliflorezg/lets-go/internal/pubsub"
+	"github.com/juliflorezg/lets-go/internal/scanner"
+	"github.com/juliflorezg/lets-go/internal/signing"
+	"github.com/juliflorezg/lets-go/internal/webauthn"
+	"github.com/juliflorezg/lets-go/internal/webhook"
 
 	"github.com/go-playground/form/v4"
 	_ "github.com/go-sql-driver/mysql"
@@ -22,12 +30,38 @@ type application struct {
 	logger         *slog.Logger
 	snippets       models.SnippetModelInterface // use of interfaces defined in models package
 	users          models.UserModelInterface    // use of interfaces defined in models package
+	resets         models.PasswordResetModelInterface
+	twoFactor      models.TwoFactorModelInterface
+	passkeys       models.PasskeyModelInterface
+	logins         models.LoginFailureModelInterface
+	exports        models.ExportModelInterface
+	drafts         models.DraftModelInterface
+	reports        models.ReportModelInterface
+	stats          models.StatsModelInterface
+	analytics      models.AnalyticsModelInterface
+	notifications  models.NotificationModelInterface
+	webhooks       models.WebhookModelInterface
+	webhookClient  *http.Client
+	events         *pubsub.Hub
+	streams        *streamLimiter
+	mailer         mailer.Mailer
+	signer         *signing.Signer
+	relyingParty   *webauthn.RelyingParty
+	keys           *encryption.Keyring
+	origin         string
+	trustedProxies []netip.Prefix
+	exportDir      string
+	scanner        *scanner.Scanner
 	templateCache  map[string]*template.Template
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
 	isDebug        bool
 }
 
+// smtpPasswordEnvVar is the environment variable the password of the SMTP
+// server is read from, so that it doesn't show up in the list of processes.
+const smtpPasswordEnvVar = "SNIPPETBOX_SMTP_PASSWORD"
+
 func main() {
 	//> this comment style represents the responsibilities of this main function
 	// new command line flag, name addr, default value :4000
@@ -35,6 +69,15 @@ func main() {
 	addr := flag.String("addr", ":4000", "HTTP Network Address")
 	dsn := flag.String("dsn", "web:web24pass_@@/snippetbox?parseTime=true", "MySQL data source name")
 	isDebugMode := flag.Bool("debug", false, "this flag is used to run the app in debug mode")
+	exportDir := flag.String("export-dir", "./exports", "Directory where user data archives are stored")
+	scannerRules := flag.String("scanner-rules", "", "JSON file with the rules used to find secrets in snippets (the built-in rules are used if empty)")
+	keyFile := flag.String("key-file", "", "File with the keys snippets are encrypted with (read from $"+encryption.EnvVar+" if empty)")
+	smtpAddr := flag.String("smtp-addr", "", "SMTP server (host:port) emails are sent through (they're written to -mail-dir if empty)")
+	smtpUsername := flag.String("smtp-username", "", "Username for the SMTP server (the password is read from $"+smtpPasswordEnvVar+")")
+	mailFrom := flag.String("mail-from", "Snippetbox <no-reply@snippetbox.local>", "Sender of the emails")
+	mailDir := flag.String("mail-dir", "./mail", "Directory emails are written to as .eml files when no SMTP server is set")
+	origin := flag.String("origin", "https://localhost:4000", "Origin users visit the site at, which passkeys are bound to and links in emails, webhook payloads, feeds, sitemaps and canonical URLs point to")
+	trustedProxies := flag.String("trusted-proxies", "", "Comma-separated IP addresses or CIDR ranges of the reverse proxies whose X-Real-Ip and X-Forwarded-For headers are believed")
 
 	// this assigns the value passed on runtime to the addr variable
 	// must be used before using the addr variable:_
@@ -60,6 +103,79 @@ func main() {
 
 	formDecoder := form.NewDecoder()
 
+	// Make sure the directory for user data archives exists before any
+	// export is requested.
+	err = os.MkdirAll(*exportDir, 0o700)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Load the rules used to warn users about secrets in their snippets.
+	rules := scanner.DefaultRules()
+	if *scannerRules != "" {
+		rules, err = scanner.LoadRules(*scannerRules)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// Load the keys the content of snippets and drafts (along with the
+	// webhook payloads which hold it) and the two-factor secrets of users are
+	// encrypted with. Running without keys is allowed for development, but
+	// snippets are then stored in plain text, and two-factor authentication
+	// can't be enabled.
+	keys, err := encryption.FromConfig(*keyFile)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if keys == nil {
+		logger.Warn("no encryption keys configured, snippets will be stored in plain text and two-factor authentication can't be enabled")
+	}
+
+	// Load the key the links sent by email are signed with. Without one, a
+	// random key is used, and the links stop working when the server
+	// restarts.
+	signer, err := signing.FromEnv()
+	if err == nil && signer == nil {
+		logger.Warn("no signing key configured, a random one will be used", "env", signing.EnvVar)
+		signer, err = signing.Random()
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	var mail mailer.Mailer
+	if *smtpAddr != "" {
+		mail, err = mailer.NewSMTP(*smtpAddr, *smtpUsername, os.Getenv(smtpPasswordEnvVar), *mailFrom)
+	} else {
+		logger.Info("no SMTP server configured, emails will be written to files", "dir", *mailDir)
+		mail, err = mailer.NewFileDrop(*mailDir, *mailFrom)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Passkeys only work on the origin they were registered on, which
+	// browsers check, so it has to be the one users actually visit.
+	relyingParty, err := webauthn.New("Snippetbox", *origin)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Client IP addresses are used to limit streams and login attempts, so
+	// the headers proxies pass them in can't be taken from anyone.
+	proxies, err := parseTrustedProxies(*trustedProxies)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	// Here we use the scs.New() function to initialize a new session manager.
 	// Then we configure it to use our MySQL database as the session store, and set a
 	// lifetime of 12 hours (so that sessions automatically expire 12 hours
@@ -75,8 +191,30 @@ func main() {
 	//> Establish the dependencies for the handlers
 	app := &application{
 		logger:         logger,
-		snippets:       &models.SnippetModel{DB: db},
+		snippets:       &models.SnippetModel{DB: db, Keys: keys},
 		users:          &models.UserModel{DB: db},
+		resets:         &models.PasswordResetModel{DB: db},
+		twoFactor:      &models.TwoFactorModel{DB: db, Keys: keys},
+		passkeys:       &models.PasskeyModel{DB: db},
+		logins:         &models.LoginFailureModel{DB: db},
+		exports:        &models.ExportModel{DB: db},
+		drafts:         &models.DraftModel{DB: db, Keys: keys},
+		reports:        &models.ReportModel{DB: db},
+		stats:          &models.StatsModel{DB: db},
+		analytics:      &models.AnalyticsModel{DB: db},
+		notifications:  &models.NotificationModel{DB: db},
+		webhooks:       &models.WebhookModel{DB: db, Keys: keys},
+		webhookClient:  webhook.NewClient(webhookTimeout),
+		events:         pubsub.New(),
+		streams:        newStreamLimiter(maxStreamsPerIP),
+		mailer:         mail,
+		signer:         signer,
+		relyingParty:   relyingParty,
+		keys:           keys,
+		origin:         relyingParty.Origin,
+		trustedProxies: proxies,
+		exportDir:      *exportDir,
+		scanner:        scanner.New(rules),
 		templateCache:  templateCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
@@ -105,6 +243,27 @@ func main() {
 		WriteTimeout: 5 * (time.Second),
 	}
 
+	// Keep the analytics tables small while the server runs.
+	app.background(app.maintainAnalytics)
+
+	// Keep the related snippets shown under each snippet up to date.
+	app.background(app.refreshRelated)
+
+	// Warn users about their snippets which are about to expire.
+	app.background(app.notifyExpiring)
+
+	// Send the events of snippets to the webhooks of their owners.
+	app.background(app.dispatchWebhooks)
+
+	// Forget the webhook deliveries which are done with once they're old.
+	app.background(app.pruneWebhookDeliveries)
+
+	// Delete the archives of exports once they expire.
+	app.background(app.pruneExports)
+
+	// Forget the failed login attempts which don't count anymore.
+	app.background(app.pruneLoginFailures)
+
 	logger.Info("starting server", "addr", srv.Addr)
 
 	//> Run the HTTP server
@@ -76,6 +76,66 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// requireModerator only lets moderators through. It must come after
+// requireAuthentication in the chain.
+func (app *application) requireModerator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := app.users.Get(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if !user.IsModerator() {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin only lets admins through. Like requireModerator, it must come
+// after requireAuthentication in the chain.
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := app.users.Get(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if !user.IsAdmin() {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireVerifiedEmail only lets users who verified their email address
+// through. The others are asked to follow the link sent to them. Like
+// requireModerator, it must come after requireAuthentication in the chain.
+func (app *application) requireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := app.users.Get(app.sessionManager.GetInt(r.Context(), "authenticatedUserID"))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if !user.Verified {
+			data := app.newTemplateData(r)
+			data.User = user
+			app.render(w, r, http.StatusForbidden, "unverified.tmpl.html", data)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) noSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 	csrfHandler.SetBaseCookie(http.Cookie{
@@ -111,8 +171,30 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// coming from an authenticated user who exists in our database. We
 		// create a new copy of the request (with an isAuthenticatedContextKey
 		// value of true in the request context) and assign it to r.
+		// Sessions started before the session version of the user was last
+		// bumped (for example by a password reset) have ended.
 		if exists {
+			version, err := app.users.SessionVersion(id)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			if version != app.sessionManager.GetInt(r.Context(), "sessionVersion") {
+				app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+				exists = false
+			}
+		}
+
+		if exists {
+			unread, err := app.notifications.CountUnread(id)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+			ctx = context.WithValue(ctx, unreadNotificationsContextKey, unread)
 			r = r.WithContext(ctx)
 		}
 
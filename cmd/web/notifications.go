@@ -0,0 +1,22 @@
+package main
+
+import "time"
+
+// expiringWithin is how long before a snippet expires its owner is notified
+// about it.
+const expiringWithin = 24 * time.Hour
+
+// notifyExpiring notifies the users whose snippets are about to expire, once
+// an hour for as long as the application runs.
+func (app *application) notifyExpiring() error {
+	for {
+		n, err := app.notifications.NotifyExpiring(expiringWithin)
+		if err != nil {
+			app.logger.Error(err.Error())
+		} else if n > 0 {
+			app.logger.Info("expiring snippets notified", "notifications", n)
+		}
+
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+
+	"github.com/juliflorezg/lets-go/internal/webauthn"
+)
+
+// maxPasskeyNameChars is the maximum length of the name of a passkey.
+const maxPasskeyNameChars = 100
+
+// passkeyUserHandle returns the WebAuthn user handle of a user, which
+// authenticators store along with their passkeys: their ID, as 8 bytes.
+func passkeyUserHandle(id int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(id))
+}
+
+// attestation returns the response of the authenticator sent with the form,
+// and reports whether it was properly encoded.
+func (f passkeyForm) attestation() (webauthn.Attestation, bool) {
+	var a webauthn.Attestation
+
+	ok := decodeBase64URL(&a.ClientDataJSON, f.ClientDataJSON) &&
+		decodeBase64URL(&a.AttestationObject, f.AttestationObject)
+
+	return a, ok
+}
+
+// assertion returns the response of the authenticator sent with the form,
+// and reports whether it was properly encoded. The user handle is optional.
+func (f passkeyLoginForm) assertion() (webauthn.Assertion, bool) {
+	var a webauthn.Assertion
+
+	ok := decodeBase64URL(&a.CredentialID, f.CredentialID) &&
+		decodeBase64URL(&a.ClientDataJSON, f.ClientDataJSON) &&
+		decodeBase64URL(&a.AuthenticatorData, f.AuthenticatorData) &&
+		decodeBase64URL(&a.Signature, f.Signature) &&
+		decodeBase64URL(&a.UserHandle, f.UserHandle)
+
+	return a, ok && len(a.CredentialID) > 0
+}
+
+// decodeBase64URL decodes a field encoded by passkeys.js into dst.
+func decodeBase64URL(dst *[]byte, s string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return false
+	}
+	*dst = b
+	return true
+}
+
+// newPasskeyChallenge makes a WebAuthn challenge, and stores it in the
+// session under the given key until the response comes back.
+func (app *application) newPasskeyChallenge(r *http.Request, key string) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	app.sessionManager.Put(r.Context(), key, challenge)
+
+	return challenge, nil
+}
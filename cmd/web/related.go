@@ -0,0 +1,64 @@
+package main
+
+import (
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/related"
+)
+
+// relatedSnippets is the number of related snippets shown under a snippet.
+const relatedSnippets = 5
+
+// relatedInterval is how often the related snippets are computed again.
+// Snippets published in between have no related snippets until then.
+const relatedInterval = 30 * time.Minute
+
+// relatedCorpusSize is the number of the newest public snippets which are
+// read and compared every relatedInterval, which bounds the work of each
+// run. Older snippets have no related snippets, and aren't recommended.
+const relatedCorpusSize = 2000
+
+// refreshRelated computes the snippets related to each public snippet and
+// saves them, so that the view page only has to read them. It runs every
+// relatedInterval for as long as the application runs.
+func (app *application) refreshRelated() error {
+	for {
+		err := app.computeRelated()
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+
+		time.Sleep(relatedInterval)
+	}
+}
+
+// computeRelated computes and saves the related snippets once. Only the
+// newest public snippets are compared, so expired, scheduled, hidden and
+// encrypted ones are never recommended. The titles are compared along with
+// the contents.
+func (app *application) computeRelated() error {
+	start := time.Now()
+
+	snippets, err := app.snippets.AllPublic(relatedCorpusSize)
+	if err != nil {
+		return err
+	}
+
+	docs := make([]related.Document, len(snippets))
+	for i, s := range snippets {
+		docs[i] = related.Document{
+			ID:       s.ID,
+			Language: s.DisplayLanguage(),
+			Text:     s.Title + "\n" + s.Content,
+		}
+	}
+
+	err = app.snippets.SetRelated(related.Compute(docs, relatedSnippets))
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("related snippets computed", "snippets", len(snippets), "duration", time.Since(start))
+
+	return nil
+}
@@ -49,6 +49,28 @@ func (app *application) routes() http.Handler {
 	// mux.HandleFunc("/foo/", app.fooHandler)
 
 	router.HandlerFunc(http.MethodGet, "/ping", ping)
+
+	// Feeds are read by feed readers rather than browsers, so they don't need
+	// sessions or CSRF protection. Per-user routes live under /users/ because
+	// httprouter doesn't allow a /user/:id wildcard next to /user/signup and
+	// friends.
+	router.HandlerFunc(http.MethodGet, "/feed.atom", app.feedAtom)
+	router.HandlerFunc(http.MethodGet, "/feed.rss", app.feedRSS)
+	router.HandlerFunc(http.MethodGet, "/users/:id/feed.atom", app.userFeedAtom)
+
+	// Raw contents and embeds are used by scripts and by other sites, so they
+	// don't need sessions either.
+	router.HandlerFunc(http.MethodGet, "/snippet/raw/:id", app.snippetRaw)
+	router.HandlerFunc(http.MethodGet, "/snippet/embed/:id", app.snippetEmbed)
+
+	// Live updates are streamed with Server-Sent Events, which need neither.
+	router.HandlerFunc(http.MethodGet, "/events/latest", app.latestEvents)
+	router.HandlerFunc(http.MethodGet, "/events/snippet/:id", app.snippetEvents)
+
+	// The same goes for the files read by search engine crawlers.
+	router.HandlerFunc(http.MethodGet, "/robots.txt", app.robots)
+	router.HandlerFunc(http.MethodGet, "/sitemap.xml", app.sitemap)
+	router.HandlerFunc(http.MethodGet, "/sitemap/:page", app.sitemapPage)
 	// Create a new middleware chain containing the middleware specific to our
 	// dynamic application routes. For now, this chain will only contain the
 	// LoadAndSave session middleware but we'll add more to it later.
@@ -64,12 +86,22 @@ func (app *application) routes() http.Handler {
 	// router.Handler(http.MethodGet, "/", dynamicMd.ThenFunc(app.home))
 	router.Handler(http.MethodGet, "/", dynamicMd.Then(http.HandlerFunc(app.home)))
 	router.Handler(http.MethodGet, "/snippet/view/:id", dynamicMd.ThenFunc(app.snippetView))
+	router.Handler(http.MethodGet, "/users/:id", dynamicMd.ThenFunc(app.userProfileView))
 
 	// routes for user authentication
 	router.Handler(http.MethodGet, "/user/signup", dynamicMd.ThenFunc(app.userSignUp))
 	router.Handler(http.MethodPost, "/user/signup", dynamicMd.ThenFunc(app.userSignUpPost))
 	router.Handler(http.MethodGet, "/user/login", dynamicMd.ThenFunc(app.userLogin))
 	router.Handler(http.MethodPost, "/user/login", dynamicMd.ThenFunc(app.userLoginPost))
+	router.Handler(http.MethodGet, "/user/login/2fa", dynamicMd.ThenFunc(app.userLoginTwoFactor))
+	router.Handler(http.MethodPost, "/user/login/2fa", dynamicMd.ThenFunc(app.userLoginTwoFactorPost))
+	router.Handler(http.MethodGet, "/user/login/passkey", dynamicMd.ThenFunc(app.userLoginPasskey))
+	router.Handler(http.MethodPost, "/user/login/passkey", dynamicMd.ThenFunc(app.userLoginPasskeyPost))
+	router.Handler(http.MethodGet, "/user/verify/:token", dynamicMd.ThenFunc(app.userVerifyEmail))
+	router.Handler(http.MethodGet, "/user/password/forgot", dynamicMd.ThenFunc(app.userPasswordForgot))
+	router.Handler(http.MethodPost, "/user/password/forgot", dynamicMd.ThenFunc(app.userPasswordForgotPost))
+	router.Handler(http.MethodGet, "/user/password/reset/:token", dynamicMd.ThenFunc(app.userPasswordReset))
+	router.Handler(http.MethodPost, "/user/password/reset/:token", dynamicMd.ThenFunc(app.userPasswordResetPost))
 
 	//guided exercises
 	router.Handler(http.MethodGet, "/about", dynamicMd.ThenFunc(app.about))
@@ -78,15 +110,70 @@ func (app *application) routes() http.Handler {
 	// middleware chain which includes the requireAuthentication middleware.
 	protectedMd := dynamicMd.Append(app.requireAuthentication)
 
+	// Creating snippets is only allowed once users have verified their email
+	// address.
+	verifiedMd := protectedMd.Append(app.requireVerifiedEmail)
+
 	// Because the 'protected' middleware chain appends to the 'dynamic' chain
 	// the noSurf middleware will also be used on the three routes below too.
-	router.Handler(http.MethodGet, "/snippet/create", protectedMd.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", protectedMd.ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodGet, "/snippet/create", verifiedMd.ThenFunc(app.snippetCreate))
+	router.Handler(http.MethodPost, "/snippet/create", verifiedMd.ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodGet, "/snippet/edit/:id", protectedMd.ThenFunc(app.snippetEdit))
+	router.Handler(http.MethodPost, "/snippet/edit/:id", protectedMd.ThenFunc(app.snippetEditPost))
+	router.Handler(http.MethodGet, "/snippet/report/:id", protectedMd.ThenFunc(app.snippetReport))
+	router.Handler(http.MethodPost, "/snippet/report/:id", protectedMd.ThenFunc(app.snippetReportPost))
+	router.Handler(http.MethodPost, "/snippet/pin/:id", protectedMd.ThenFunc(app.snippetPinPost))
+	router.Handler(http.MethodGet, "/snippet/view/:id/stats", protectedMd.ThenFunc(app.snippetStats))
+	router.Handler(http.MethodPost, "/snippet/draft", protectedMd.ThenFunc(app.snippetDraftPost))
+	router.Handler(http.MethodPost, "/snippet/draft/:id/delete", protectedMd.ThenFunc(app.snippetDraftDeletePost))
+	router.Handler(http.MethodGet, "/snippet/import", verifiedMd.ThenFunc(app.snippetImport))
+	// Limit the size of uploads, and of the imports they preview, before any
+	// middleware starts reading them.
+	router.Handler(http.MethodPost, "/snippet/import", http.MaxBytesHandler(verifiedMd.ThenFunc(app.snippetImportPost), maxImportSize))
+	router.Handler(http.MethodPost, "/snippet/import/confirm", http.MaxBytesHandler(verifiedMd.ThenFunc(app.snippetImportConfirmPost), maxImportConfirmSize))
 	router.Handler(http.MethodPost, "/user/logout", protectedMd.ThenFunc(app.userLogoutPost))
 	router.Handler(http.MethodGet, "/account/view", protectedMd.ThenFunc(app.accountView))
+	router.Handler(http.MethodPost, "/account/verify", protectedMd.ThenFunc(app.accountVerifyEmailPost))
+	router.Handler(http.MethodGet, "/account/bio/update", protectedMd.ThenFunc(app.accountBioUpdate))
+	router.Handler(http.MethodPost, "/account/bio/update", protectedMd.ThenFunc(app.accountBioUpdatePost))
+	router.Handler(http.MethodPost, "/account/export", protectedMd.ThenFunc(app.accountExportPost))
+	router.Handler(http.MethodGet, "/account/export/:id", protectedMd.ThenFunc(app.accountExportDownload))
 
 	router.Handler(http.MethodGet, "/account/password/update", protectedMd.ThenFunc(app.accountPasswordUpdate))
 	router.Handler(http.MethodPost, "/account/password/update", protectedMd.ThenFunc(app.accountPasswordUpdatePost))
+	router.Handler(http.MethodGet, "/account/2fa", protectedMd.ThenFunc(app.accountTwoFactor))
+	router.Handler(http.MethodPost, "/account/2fa/enable", protectedMd.ThenFunc(app.accountTwoFactorEnablePost))
+	router.Handler(http.MethodPost, "/account/2fa/disable", protectedMd.ThenFunc(app.accountTwoFactorDisablePost))
+	router.Handler(http.MethodPost, "/account/2fa/recovery", protectedMd.ThenFunc(app.accountTwoFactorRecoveryPost))
+	router.Handler(http.MethodGet, "/account/passkeys", protectedMd.ThenFunc(app.accountPasskeys))
+	router.Handler(http.MethodPost, "/account/passkeys", protectedMd.ThenFunc(app.accountPasskeysPost))
+	router.Handler(http.MethodPost, "/account/passkeys/:id/delete", protectedMd.ThenFunc(app.accountPasskeyDeletePost))
+	router.Handler(http.MethodGet, "/account/notifications", protectedMd.ThenFunc(app.accountNotifications))
+	router.Handler(http.MethodPost, "/account/notifications", protectedMd.ThenFunc(app.accountNotificationsPost))
+	router.Handler(http.MethodGet, "/account/webhooks", protectedMd.ThenFunc(app.accountWebhooks))
+	router.Handler(http.MethodPost, "/account/webhooks", protectedMd.ThenFunc(app.accountWebhooksPost))
+	router.Handler(http.MethodGet, "/account/webhooks/:id", protectedMd.ThenFunc(app.accountWebhookView))
+	router.Handler(http.MethodPost, "/account/webhooks/:id/delete", protectedMd.ThenFunc(app.accountWebhookDeletePost))
+	router.Handler(http.MethodGet, "/notifications", protectedMd.ThenFunc(app.notificationsView))
+	router.Handler(http.MethodPost, "/notifications", protectedMd.ThenFunc(app.notificationsPost))
+
+	// Moderation routes are only available to moderators.
+	moderatorMd := protectedMd.Append(app.requireModerator)
+
+	router.Handler(http.MethodGet, "/moderation", moderatorMd.ThenFunc(app.moderationQueue))
+	router.Handler(http.MethodGet, "/moderation/snippets/:id", moderatorMd.ThenFunc(app.moderationReview))
+	router.Handler(http.MethodPost, "/moderation/snippets/:id", moderatorMd.ThenFunc(app.moderationReviewPost))
+
+	// The administration area is only available to admins. Its forms go
+	// through the same CSRF checks as the rest of the protected routes.
+	adminMd := protectedMd.Append(app.requireAdmin)
+
+	router.Handler(http.MethodGet, "/admin", adminMd.ThenFunc(app.adminDashboard))
+	router.Handler(http.MethodGet, "/admin/users", adminMd.ThenFunc(app.adminUsers))
+	router.Handler(http.MethodPost, "/admin/users/:id/suspend", adminMd.ThenFunc(app.adminUserSuspendPost))
+	router.Handler(http.MethodPost, "/admin/users/:id/unlock", adminMd.ThenFunc(app.adminUserUnlockPost))
+	router.Handler(http.MethodGet, "/admin/snippets", adminMd.ThenFunc(app.adminSnippets))
+	router.Handler(http.MethodPost, "/admin/snippets/:id/hide", adminMd.ThenFunc(app.adminSnippetHidePost))
 
 	// Create a middleware chain containing our 'standard' middleware
 	// which will be used for every request our application receives.
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+// sitemapMaxURLs is the maximum number of URLs a single sitemap file may list
+// according to the sitemaps.org protocol. Past this number /sitemap.xml
+// becomes a sitemap index pointing to several sitemap files.
+const sitemapMaxURLs = 50000
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name         `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapPointer `xml:"sitemap"`
+}
+
+type sitemapPointer struct {
+	Loc string `xml:"loc"`
+}
+
+// newSitemapURLSet builds a sitemap listing the view page of every given
+// snippet.
+func newSitemapURLSet(baseURL string, refs []models.SnippetRef) sitemapURLSet {
+	var set sitemapURLSet
+
+	for _, ref := range refs {
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     fmt.Sprintf("%s/snippet/view/%d", baseURL, ref.ID),
+			LastMod: ref.Updated.UTC().Format(time.RFC3339),
+		})
+	}
+
+	return set
+}
+
+// newSitemapIndex builds a sitemap index pointing to the given number of
+// sitemap files, which are served by the sitemapPage handler.
+func newSitemapIndex(baseURL string, pages int) sitemapIndex {
+	var index sitemapIndex
+
+	for page := 1; page <= pages; page++ {
+		index.Sitemaps = append(index.Sitemaps, sitemapPointer{
+			Loc: fmt.Sprintf("%s/sitemap/%d.xml", baseURL, page),
+		})
+	}
+
+	return index
+}
+
+// writeXML encodes v as an XML document and sends it with a 200 OK status.
+func (app *application) writeXML(w http.ResponseWriter, r *http.Request, v any) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+
+	err := xml.NewEncoder(buf).Encode(v)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	buf.WriteTo(w)
+}
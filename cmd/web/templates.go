@@ -4,9 +4,13 @@ import (
 	"html/template"
 	"io/fs"
 	"path/filepath"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/juliflorezg/lets-go/internal/language"
 	"github.com/juliflorezg/lets-go/internal/models"
+	"github.com/juliflorezg/lets-go/internal/webhook"
 	"github.com/juliflorezg/lets-go/ui"
 )
 
@@ -21,6 +25,36 @@ type templateData struct {
 	IsAuthenticated bool
 	CSRFToken       string
 	User            models.User
+	Export          models.Export
+	Drafts          []models.Draft
+	BaseURL         string
+	UserID          int
+	Lines           []snippetLine
+	Profile         userProfile
+	Reports         []models.Report
+	Queue           []models.ReportedSnippet
+	Decision        models.Decision
+	Stats           models.Stats
+	Duplicates      []models.DuplicateGroup
+	Users           []models.User
+	LockedUsers     map[int]bool
+	Query           string
+	Chart           dailyChart
+	HitCounts       models.HitCounts
+	Referrers       []models.Referrer
+	Related         []models.Snippet
+	// UnreadNotifications is set on every page seen by an authenticated
+	// user, for the navigation bar.
+	UnreadNotifications int
+	Notifications       []models.Notification
+	Webhooks            []models.Webhook
+	Webhook             models.Webhook
+	Deliveries          []models.Delivery
+	TwoFactor           twoFactorSetup
+	Passkeys            []models.Passkey
+	// PasskeyOptions holds the options of the WebAuthn ceremony run on the
+	// page, passed to the browser as JSON.
+	PasskeyOptions any
 }
 
 // Create a humanDate function which returns a nicely formatted string
@@ -36,8 +70,42 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04 MST")
 }
 
+// excerpt returns the first n characters of a text with its whitespace
+// collapsed into single spaces, adding an ellipsis if anything was cut off.
+// It's used to build short descriptions (like the ones in <meta> tags) out of
+// snippet contents.
+func excerpt(n int, s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n])) + "…"
+}
+
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":         humanDate,
+	"excerpt":           excerpt,
+	"languages":         func() []language.Language { return language.All },
+	"languageLabel":     language.Label,
+	"reportReasons":     func() []models.ReportReason { return models.ReportReasons },
+	"reportReasonLabel": reportReasonLabel,
+	"notificationKinds": func() []models.NotificationKind { return models.NotificationKinds },
+	"webhookEvents":     func() []string { return webhook.Events },
+	"exportExpires":     func(e models.Export) time.Time { return e.Created.Add(exportRetention) },
+}
+
+// reportReasonLabel returns the human readable label of a report reason, or
+// the name itself if the reason is unknown.
+func reportReasonLabel(name string) string {
+	for _, r := range models.ReportReasons {
+		if r.Name == name {
+			return r.Label
+		}
+	}
+	return name
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
@@ -101,5 +169,21 @@ func newTemplateCache() (map[string]*template.Template, error) {
 		cache[name] = ts // keys would be like: home.tmpl.html
 	}
 
+	// Standalone pages (like the embedded view of a snippet) don't share the
+	// layout of the site, so they define the whole "base" template themselves.
+	standalone, err := fs.Glob(ui.Files, "html/standalone/*.tmpl.html")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, page := range standalone {
+		ts, err := template.New(filepath.Base(page)).Funcs(functions).ParseFS(ui.Files, page)
+		if err != nil {
+			return nil, err
+		}
+
+		cache[filepath.Base(page)] = ts
+	}
+
 	return cache, nil
 }
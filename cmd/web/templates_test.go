@@ -57,3 +57,43 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		s    string
+		want string
+	}{
+		{
+			name: "Short",
+			n:    20,
+			s:    "An old silent pond",
+			want: "An old silent pond",
+		},
+		{
+			name: "Whitespace",
+			n:    20,
+			s:    "An old\n\tsilent   pond\n",
+			want: "An old silent pond",
+		},
+		{
+			name: "Truncated",
+			n:    10,
+			s:    "An old silent pond",
+			want: "An old sil…",
+		},
+		{
+			name: "Multi-byte",
+			n:    3,
+			s:    "古池や蛙飛び込む",
+			want: "古池や…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, excerpt(tt.n, tt.s), tt.want)
+		})
+	}
+}
@@ -5,21 +5,33 @@ import (
 	"html"
 	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"github.com/juliflorezg/lets-go/internal/encryption"
+	"github.com/juliflorezg/lets-go/internal/mailer"
 	"github.com/juliflorezg/lets-go/internal/models/mocks"
+	"github.com/juliflorezg/lets-go/internal/pubsub"
+	"github.com/juliflorezg/lets-go/internal/scanner"
+	"github.com/juliflorezg/lets-go/internal/signing"
+	"github.com/juliflorezg/lets-go/internal/webauthn"
 )
 
 var csrfTokenRX = regexp.MustCompile(`<input type="hidden" name="csrf_token" value="(.+)" />`)
 
+// testOrigin is the origin test applications are configured with, which
+// passkeys are bound to and links in emails point to.
+const testOrigin = "https://localhost:4000"
+
 // Create a newTestApplication helper which returns an instance of our
 // application struct containing mocked dependencies.
 func NewTestApplication(t *testing.T) *application {
@@ -39,10 +51,48 @@ func NewTestApplication(t *testing.T) *application {
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
 
+	signer, err := signing.Random()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relyingParty, err := webauthn.New("Snippetbox", testOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two-factor secrets are encrypted in sessions, and can't be enrolled
+	// without keys.
+	keys, err := encryption.New(map[string][]byte{"test": make([]byte, encryption.KeySize)}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	return &application{
 		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
 		snippets:       &mocks.SnippetModel{},
 		users:          &mocks.UserModel{},
+		resets:         &mocks.PasswordResetModel{},
+		twoFactor:      &mocks.TwoFactorModel{},
+		passkeys:       &mocks.PasskeyModel{},
+		logins:         &mocks.LoginFailureModel{},
+		exports:        &mocks.ExportModel{},
+		drafts:         &mocks.DraftModel{},
+		reports:        &mocks.ReportModel{},
+		stats:          &mocks.StatsModel{},
+		analytics:      &mocks.AnalyticsModel{},
+		notifications:  &mocks.NotificationModel{},
+		webhooks:       &mocks.WebhookModel{},
+		webhookClient:  http.DefaultClient,
+		events:         pubsub.New(),
+		streams:        newStreamLimiter(maxStreamsPerIP),
+		mailer:         &mailer.Memory{},
+		signer:         signer,
+		relyingParty:   relyingParty,
+		keys:           keys,
+		origin:         testOrigin,
+		exportDir:      t.TempDir(),
+		scanner:        scanner.New(scanner.DefaultRules()),
 		templateCache:  templateCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
@@ -100,6 +150,101 @@ func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, strin
 	return rs.StatusCode, rs.Header, string(body)
 }
 
+// getWithHeader works like get() but sends the given headers along with the
+// request, which is useful to exercise conditional requests.
+func (ts *testServer) getWithHeader(t *testing.T, urlPath string, header http.Header) (int, http.Header, string) {
+	req, err := http.NewRequest(http.MethodGet, ts.URL+urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = header
+
+	// The client sends the Host header from req.Host, whatever the other
+	// headers say.
+	if host := header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body = bytes.TrimSpace(body)
+
+	return rs.StatusCode, rs.Header, string(body)
+}
+
+// login signs in as the user the mocked UserModel knows about, so that the
+// following requests made by the test server client are authenticated.
+func (ts *testServer) login(t *testing.T) {
+	ts.loginAs(t, "alice@example.com")
+}
+
+// loginAs logs in as the mock user with the given email address (see the
+// mocks package), all of which have the same password.
+func (ts *testServer) loginAs(t *testing.T, email string) {
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login failed with status %d", code)
+	}
+}
+
+// postMultipart sends a multipart/form-data POST request with the given
+// values and files (keyed by field name, then by file name).
+func (ts *testServer) postMultipart(t *testing.T, urlPath string, values url.Values, files map[string]map[string][]byte) (int, http.Header, string) {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+
+	for key, vals := range values {
+		for _, v := range vals {
+			mw.WriteField(key, v)
+		}
+	}
+
+	for field, named := range files {
+		for name, content := range named {
+			fw, err := mw.CreateFormFile(field, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write(content)
+		}
+	}
+
+	err := mw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := ts.Client().Post(ts.URL+urlPath, mw.FormDataContentType(), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = bytes.TrimSpace(body)
+
+	return rs.StatusCode, rs.Header, string(body)
+}
+
 func extractCSRFToken(t *testing.T, body string) string {
 	// Here we use the FindStringSubmatch method to extract the token from the HTML body.
 	// This returns an array with the entire matched pattern in the
@@ -131,3 +276,36 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	return rs.StatusCode, rs.Header, string(body)
 
 }
+
+// postFormWithHost works like postForm() but sends the given Host header,
+// the way a client can to make the site believe it's on another host.
+func (ts *testServer) postFormWithHost(t *testing.T, urlPath, host string, form url.Values) (int, http.Header, string) {
+	req, err := http.NewRequest(http.MethodPost, ts.URL+urlPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// The client looks up and stores cookies by the Host header, so the ones
+	// of the test server have to be handled by hand.
+	for _, cookie := range ts.Client().Jar.Cookies(req.URL) {
+		req.AddCookie(cookie)
+	}
+	req.Host = host
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar.SetCookies(req.URL, rs.Cookies())
+
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body = bytes.TrimSpace(body)
+
+	return rs.StatusCode, rs.Header, string(body)
+}
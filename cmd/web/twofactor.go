@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+	"github.com/juliflorezg/lets-go/internal/totp"
+
+	"rsc.io/qr"
+)
+
+const (
+	// twoFactorIssuer names the site in authenticator apps.
+	twoFactorIssuer = "Snippetbox"
+
+	// recoveryCodeCount is the number of recovery codes users get.
+	recoveryCodeCount = 10
+
+	// twoFactorTimeout is how long users have to enter a code once they've
+	// entered their password.
+	twoFactorTimeout = 5 * time.Minute
+
+	// maxTwoFactorAttempts is the number of wrong codes users can enter
+	// before having to enter their password again.
+	maxTwoFactorAttempts = 5
+
+	// qrQuietZone is the width of the margin around QR codes, in modules.
+	qrQuietZone = 4
+)
+
+// twoFactorSetup holds what the two-factor authentication pages show. Secret
+// and QRCode are the ones of the authenticator app being enrolled, and
+// RecoveryCodes the ones just generated, which are only ever shown once.
+// Available is false when there are no keys to encrypt secrets with, in
+// which case two-factor authentication can't be enabled.
+type twoFactorSetup struct {
+	Available         bool
+	Enabled           bool
+	Secret            string
+	QRCode            qrCode
+	RecoveryCodes     []string
+	RecoveryCodesLeft int
+}
+
+// qrCode is a QR code drawn as an SVG path, with one unit per module. It's
+// drawn inline in the page, since the Content-Security-Policy doesn't allow
+// data: images.
+type qrCode struct {
+	Size int
+	Path string
+}
+
+// newQRCode encodes text as a QR code.
+func newQRCode(text string) (qrCode, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return qrCode{}, err
+	}
+
+	var path strings.Builder
+
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+
+	return qrCode{Size: code.Size + 2*qrQuietZone, Path: path.String()}, nil
+}
+
+// newRecoveryCodes returns a set of random recovery codes, formatted as
+// "xxxx-xxxx-xxxx-xxxx" (80 bits each).
+func newRecoveryCodes() ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	codes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 10)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+
+		s := strings.ToLower(encoding.EncodeToString(b))
+		codes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+	}
+
+	return codes, nil
+}
+
+// twoFactorEnrolment returns what the user needs to add their account to an
+// authenticator app. The secret is kept in the session until they confirm it
+// with a code, so that it doesn't change when the page is reloaded. Sessions
+// are stored in the database too, so it's encrypted like the confirmed ones.
+func (app *application) twoFactorEnrolment(r *http.Request, user models.User) (twoFactorSetup, error) {
+	if app.keys == nil {
+		return twoFactorSetup{}, nil
+	}
+
+	secret := app.enrolmentSecret(r)
+
+	if secret == "" {
+		var err error
+		secret, err = totp.NewSecret()
+		if err != nil {
+			return twoFactorSetup{}, err
+		}
+
+		keyID, encrypted, err := app.keys.Encrypt(secret)
+		if err != nil {
+			return twoFactorSetup{}, err
+		}
+		app.sessionManager.Put(r.Context(), "twoFactorSecret", encrypted)
+		app.sessionManager.Put(r.Context(), "twoFactorSecretKey", keyID)
+	}
+
+	code, err := newQRCode(totp.URL(twoFactorIssuer, user.Email, secret))
+	if err != nil {
+		return twoFactorSetup{}, err
+	}
+
+	return twoFactorSetup{Available: true, Secret: secret, QRCode: code}, nil
+}
+
+// enrolmentSecret returns the secret being enrolled, or an empty string if
+// there's none or it can't be decrypted anymore, in which case the user
+// starts over with a new one.
+func (app *application) enrolmentSecret(r *http.Request) string {
+	encrypted := app.sessionManager.GetString(r.Context(), "twoFactorSecret")
+	keyID := app.sessionManager.GetString(r.Context(), "twoFactorSecretKey")
+
+	if encrypted == "" || app.keys == nil {
+		return ""
+	}
+
+	secret, err := app.keys.Decrypt(keyID, encrypted)
+	if err != nil {
+		return ""
+	}
+
+	return secret
+}
+
+// forgetEnrolmentSecret removes the secret being enrolled from the session.
+func (app *application) forgetEnrolmentSecret(r *http.Request) {
+	app.sessionManager.Remove(r.Context(), "twoFactorSecret")
+	app.sessionManager.Remove(r.Context(), "twoFactorSecretKey")
+}
+
+// pendingTwoFactor returns the ID of the user who entered their password
+// but not their code yet, if they did so less than twoFactorTimeout ago.
+func (app *application) pendingTwoFactor(r *http.Request) (int, bool) {
+	id := app.sessionManager.GetInt(r.Context(), "twoFactorUserID")
+	started := app.sessionManager.GetInt64(r.Context(), "twoFactorStarted")
+
+	if id == 0 || time.Since(time.Unix(started, 0)) > twoFactorTimeout {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// clearTwoFactor forgets the user who was entering their code.
+func (app *application) clearTwoFactor(r *http.Request) {
+	app.sessionManager.Remove(r.Context(), "twoFactorUserID")
+	app.sessionManager.Remove(r.Context(), "twoFactorStarted")
+	app.sessionManager.Remove(r.Context(), "twoFactorAttempts")
+	app.sessionManager.Remove(r.Context(), "loginAttemptID")
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+	"github.com/juliflorezg/lets-go/internal/webhook"
+)
+
+const (
+	// webhookTimeout is how long a webhook has to answer a delivery.
+	webhookTimeout = 10 * time.Second
+
+	// webhookPollInterval is how often the due deliveries are looked for
+	// when there are none left.
+	webhookPollInterval = 5 * time.Second
+
+	// webhookBatchSize is the number of deliveries handed out at a time.
+	webhookBatchSize = 20
+
+	// webhookWorkers is the number of webhooks deliveries are sent to at
+	// once.
+	webhookWorkers = 8
+
+	// webhookLogSize is the number of deliveries shown in the log of a
+	// webhook.
+	webhookLogSize = 20
+
+	// webhookRetention is how long deliveries are kept once they were
+	// delivered or failed for good, for the log of their webhook.
+	webhookRetention = 30 * 24 * time.Hour
+)
+
+// webhookPayload is the JSON body posted to webhooks.
+type webhookPayload struct {
+	Event   string         `json:"event"`
+	Sent    time.Time      `json:"sent"`
+	Snippet webhookSnippet `json:"snippet"`
+}
+
+// webhookSnippet describes a snippet in webhookPayload. The content of
+// snippets encrypted in the browser is left out, since it's a ciphertext
+// only their readers have the key of.
+type webhookSnippet struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content,omitempty"`
+	Language  string    `json:"language,omitempty"`
+	Encrypted bool      `json:"encrypted,omitempty"`
+	Created   time.Time `json:"created"`
+	PublishAt time.Time `json:"publish_at"`
+	Expires   time.Time `json:"expires"`
+}
+
+// validWebhookURL reports whether s is an absolute http:// or https:// URL.
+func validWebhookURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil
+}
+
+// enqueueWebhooks queues a delivery of an event about a snippet to the
+// webhooks of its owner which subscribe to it. The link to the snippet
+// points to the configured origin rather than to the host of the request
+// which caused the event, since receivers trust signed payloads.
+func (app *application) enqueueWebhooks(event string, snippet models.Snippet) error {
+	payload := webhookPayload{
+		Event: event,
+		Sent:  time.Now().UTC(),
+		Snippet: webhookSnippet{
+			ID:        snippet.ID,
+			URL:       fmt.Sprintf("%s/snippet/view/%d", app.origin, snippet.ID),
+			Title:     snippet.Title,
+			Language:  snippet.DisplayLanguage(),
+			Encrypted: snippet.ClientEncrypted,
+			Created:   snippet.Created.UTC(),
+			PublishAt: snippet.PublishAt.UTC(),
+			Expires:   snippet.Expires.UTC(),
+		},
+	}
+	if !snippet.ClientEncrypted {
+		payload.Snippet.Content = snippet.Content
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return app.webhooks.Enqueue(snippet.UserID, event, body)
+}
+
+// enqueueSnippetWebhooks reads the snippet with the given ID and queues an
+// event about it, for the handlers which only have its ID.
+func (app *application) enqueueSnippetWebhooks(event string, id int) error {
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		return err
+	}
+
+	return app.enqueueWebhooks(event, snippet)
+}
+
+// dispatchWebhooks sends the due deliveries for as long as the application
+// runs.
+func (app *application) dispatchWebhooks() error {
+	for {
+		n, err := app.deliverWebhooks()
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+
+		// Keep going right away while there's a backlog.
+		if err != nil || n < webhookBatchSize {
+			time.Sleep(webhookPollInterval)
+		}
+	}
+}
+
+// deliverWebhooks sends a batch of due deliveries and returns how many there
+// were. Up to webhookWorkers webhooks are sent to at once, so that a slow
+// webhook only holds up its own deliveries, which are sent one at a time and
+// in order. Once an attempt to a webhook fails, its other deliveries in the
+// batch are left to be handed out again, rather than each waiting on the
+// same server.
+func (app *application) deliverWebhooks() (int, error) {
+	deliveries, err := app.webhooks.Due(webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// Group the deliveries by webhook, in the order they were handed out.
+	var webhookIDs []int
+	queues := make(map[int][]models.Delivery)
+	for _, d := range deliveries {
+		if _, ok := queues[d.WebhookID]; !ok {
+			webhookIDs = append(webhookIDs, d.WebhookID)
+		}
+		queues[d.WebhookID] = append(queues[d.WebhookID], d)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		errs    []error
+		workers = make(chan struct{}, webhookWorkers)
+	)
+
+	for _, id := range webhookIDs {
+		queue := queues[id]
+
+		workers <- struct{}{}
+		wg.Add(1)
+
+		go func() {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+
+			for _, d := range queue {
+				delivered, err := app.deliverWebhook(d)
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+					return
+				}
+				if !delivered {
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return 0, err
+	}
+
+	return len(deliveries), nil
+}
+
+// deliverWebhook attempts to send a delivery, records the outcome and
+// reports whether it was delivered. Failed deliveries are attempted again
+// later, waiting longer after every attempt, until webhook.MaxAttempts is
+// reached.
+func (app *application) deliverWebhook(d models.Delivery) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	code, err := webhook.Send(ctx, app.webhookClient, webhook.Request{
+		DeliveryID: d.ID,
+		Event:      d.Event,
+		URL:        d.URL,
+		Secret:     d.Secret,
+		Body:       d.Payload,
+	})
+
+	attempt := models.DeliveryAttempt{ResponseCode: code}
+	status := models.DeliveryDelivered
+	next := time.Now()
+
+	if err != nil {
+		attempt.Error = excerpt(500, err.Error())
+		attempts := d.Attempts + 1
+
+		if attempts < webhook.MaxAttempts {
+			status = models.DeliveryPending
+			next = next.Add(webhook.Backoff(attempts))
+		} else {
+			status = models.DeliveryFailed
+		}
+	}
+
+	app.logger.Info("webhook delivery attempted", "delivery_id", d.ID, "webhook_id", d.WebhookID, "code", code, "status", status)
+
+	return status == models.DeliveryDelivered, app.webhooks.RecordAttempt(d.ID, attempt, status, next)
+}
+
+// pruneWebhookDeliveries deletes the deliveries which are done with once
+// they're older than webhookRetention, along with the payloads they hold,
+// once an hour for as long as the application runs.
+func (app *application) pruneWebhookDeliveries() error {
+	for {
+		n, err := app.webhooks.DeleteDeliveriesBefore(time.Now().Add(-webhookRetention))
+		if err != nil {
+			app.logger.Error(err.Error())
+		} else if n > 0 {
+			app.logger.Info("webhook deliveries pruned", "deliveries", n)
+		}
+
+		time.Sleep(time.Hour)
+	}
+}
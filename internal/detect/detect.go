@@ -0,0 +1,235 @@
+// Package detect guesses the language a piece of code is written in, for
+// snippets whose author didn't choose one.
+//
+// The classifier is a simple heuristic one: every language has a set of
+// features (keywords, shebangs, structural tokens...) with a weight, the
+// content scores the weight of every feature found in it, and the language
+// with the highest score wins. The names of the languages are the ones of the
+// language package.
+package detect
+
+import (
+	"encoding/json"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// MinConfidence is the confidence below which Language gives up and returns
+// no language at all.
+const MinConfidence = 0.5
+
+// Result is the outcome of a detection. Confidence goes from 0 to 1.
+type Result struct {
+	Language   string
+	Confidence float64
+}
+
+// feature is a pattern which hints at a language. Patterns are matched
+// against each line of the content separately, and each matching line adds
+// weight to the score of the language, up to maxMatches lines per feature so
+// that a single repeated construct can't outweigh everything else.
+type feature struct {
+	pattern *regexp.Regexp
+	weight  float64
+}
+
+const maxMatches = 5
+
+func f(pattern string, weight float64) feature {
+	return feature{pattern: regexp.MustCompile(pattern), weight: weight}
+}
+
+// features lists the features of each language. A language which extends
+// another one (like TypeScript extends JavaScript) also scores the features
+// of the other language, as long as some of its own features are found. The
+// order of the languages breaks ties.
+var features = []struct {
+	language string
+	extends  string
+	features []feature
+}{
+	{"go", "", []feature{
+		f(`^package \w+$`, 5),
+		f(`^import \($|^import "`, 4),
+		f(`^func (\([^)]*\) )?\w+\(`, 4),
+		f(`\w+ := `, 2),
+		f(`\berr != nil\b`, 3),
+		f(`\bfmt\.\w+\(`, 2),
+		f(`^type \w+ (struct|interface) \{`, 4),
+		f(`\bchan\b|\bgo func\(|\bdefer\b`, 2),
+	}},
+	{"python", "", []feature{
+		f(`^\s*def \w+\(.*\)( -> .+)?:\s*$`, 4),
+		f(`^\s*class \w+(\(.*\))?:\s*$`, 4),
+		f(`^\s*(import \w+(\.\w+)*( as \w+)?|from [\w.]+ import .+)\s*$`, 3),
+		f(`\bself\.\w+`, 2),
+		f(`^\s*(elif .+|else|try|except( \w+( as \w+)?)?|finally):\s*$`, 3),
+		f(`^\s*(if|for|while|with) .+:\s*$`, 2),
+		f(`\bprint\(`, 1),
+		f(`__name__ == ["']__main__["']|\bNone\b|\bTrue\b|\bFalse\b`, 2),
+	}},
+	{"javascript", "", []feature{
+		f(`\b(const|let|var) \w+ = `, 2),
+		f(`\bfunction\s*\w*\s*\(`, 3),
+		f(`\) => |\w+ => `, 2),
+		f(`\bconsole\.(log|error|warn)\(`, 3),
+		f(`\brequire\(["']|\bmodule\.exports\b`, 3),
+		f(`^import .+ from ["']|^export (default|const|function|class) `, 3),
+		f(`\bdocument\.\w+|\bwindow\.\w+`, 2),
+		f(` === | !== `, 2),
+		f(`;\s*$`, 0.5),
+	}},
+	{"typescript", "javascript", []feature{
+		f(`^\s*(export )?(interface|type) \w+(<[^>]+>)? (\{|=)`, 5),
+		f(`\w\??: (string|number|boolean|any|unknown|void|never)(\[\])?\b`, 4),
+		f(`\): (string|number|boolean|void|Promise<.+>)\s*(\{|=>)`, 4),
+		f(`\b(private|public|protected|readonly) \w+`, 2),
+		f(` as (string|number|any|unknown|const)\b`, 3),
+	}},
+	{"sql", "", []feature{
+		f(`(?i)^\s*(SELECT|INSERT INTO|UPDATE \w+ SET|DELETE FROM|CREATE (TABLE|INDEX|VIEW|DATABASE)|ALTER TABLE|DROP (TABLE|INDEX|VIEW))\b`, 5),
+		f(`(?i)\b(FROM|JOIN) \w+(\.\w+)?\b`, 1),
+		f(`(?i)\bWHERE\b|\bGROUP BY\b|\bORDER BY\b|\bVALUES\s*\(`, 2),
+		f(`(?i)\b(INTEGER|VARCHAR\(\d+\)|TEXT|DATETIME|PRIMARY KEY|NOT NULL)\b`, 2),
+		f(`^\s*--`, 1),
+	}},
+	{"shell", "", []feature{
+		f(`^\s*(echo|export|cd|sudo|apt-get|apt|yum|brew|curl|wget|chmod|chown|mkdir|rm|cp|mv|grep|source|set -\w+)\b`, 2),
+		f(`^\s*(if \[|elif \[|fi$|then$|do$|done$|esac$|case .+ in$)`, 4),
+		f(`\$\{?\w+\}?|\$\(`, 1),
+		f(` \| \w+| && \w+| > /dev/null`, 1),
+		f(`^\s*\w+\(\) \{`, 2),
+	}},
+	{"yaml", "", []feature{
+		f(`^---\s*$`, 2),
+		f(`^\s*[\w.-]+:(\s+[^\s{].*)?$`, 1),
+		f(`^\s*- [\w.-]+:\s`, 2),
+		f(`^\s*- \S`, 1),
+		f(`^\s*[\w.-]+: [|>]-?\s*$`, 3),
+	}},
+	{"html", "", []feature{
+		f(`(?i)^\s*<!DOCTYPE html>`, 10),
+		f(`(?i)<(html|head|body|div|span|p|a|ul|li|table|form|input|script|link|meta|h[1-6])(\s[^>]*)?>`, 2),
+		f(`</\w+>`, 1),
+	}},
+	{"dockerfile", "", []feature{
+		f(`^FROM \S+( AS \w+)?\s*$`, 6),
+		f(`^(RUN|CMD|COPY|ADD|ENTRYPOINT|WORKDIR|ENV|EXPOSE|ARG|LABEL|USER|VOLUME|HEALTHCHECK) `, 3),
+	}},
+}
+
+// shebangs maps the interpreters found in shebang lines to the language of
+// the scripts they run.
+var shebangs = map[string]string{
+	"sh":      "shell",
+	"bash":    "shell",
+	"zsh":     "shell",
+	"dash":    "shell",
+	"python":  "python",
+	"node":    "javascript",
+	"deno":    "typescript",
+	"ts-node": "typescript",
+}
+
+// Language guesses the language of content. If it can't tell with at least
+// MinConfidence, it returns a zero Result.
+func Language(content string) Result {
+	content = strings.TrimSpace(strings.ReplaceAll(content, "\r\n", "\n"))
+	if content == "" {
+		return Result{}
+	}
+
+	// A shebang names the interpreter of the script, so there's no need to
+	// look further.
+	if lang := fromShebang(content); lang != "" {
+		return Result{Language: lang, Confidence: 1}
+	}
+
+	// Anything a JSON parser accepts is JSON, as long as it's an object or
+	// an array (a lone string or number could be anything).
+	if (content[0] == '{' || content[0] == '[') && json.Valid([]byte(content)) {
+		return Result{Language: "json", Confidence: 1}
+	}
+
+	lines := strings.Split(content, "\n")
+	scores := make(map[string]float64, len(features))
+
+	for _, lang := range features {
+		for _, feat := range lang.features {
+			matches := 0
+			for _, line := range lines {
+				if feat.pattern.MatchString(line) {
+					matches++
+					if matches == maxMatches {
+						break
+					}
+				}
+			}
+			scores[lang.language] += float64(matches) * feat.weight
+		}
+	}
+
+	best := features[0]
+	for _, lang := range features {
+		score := scores[lang.language]
+		if score > 0 && lang.extends != "" {
+			score += scores[lang.extends]
+		}
+		if score > scores[best.language] {
+			best = lang
+		}
+		scores[lang.language] = score
+	}
+
+	if scores[best.language] == 0 {
+		return Result{}
+	}
+
+	// The language the winner extends doesn't compete with it.
+	var total float64
+	for lang, score := range scores {
+		if lang != best.extends {
+			total += score
+		}
+	}
+
+	// The confidence combines how much the winner stands out from the other
+	// languages with how much evidence there is for it at all: a single
+	// keyword isn't enough to be sure, even when no other language matched.
+	share := scores[best.language] / total
+	evidence := 1 - math.Exp(-scores[best.language]/6)
+	confidence := math.Round(share*evidence*100) / 100
+
+	if confidence < MinConfidence {
+		return Result{}
+	}
+
+	return Result{Language: best.language, Confidence: confidence}
+}
+
+// fromShebang returns the language named by the shebang line of content, if
+// it has one, handling both "#!/bin/bash" and "#!/usr/bin/env bash".
+func fromShebang(content string) string {
+	if !strings.HasPrefix(content, "#!") {
+		return ""
+	}
+
+	line, _, _ := strings.Cut(content[2:], "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := fields[0]
+	if strings.HasSuffix(interpreter, "/env") && len(fields) > 1 {
+		interpreter = fields[1]
+	}
+	if i := strings.LastIndex(interpreter, "/"); i >= 0 {
+		interpreter = interpreter[i+1:]
+	}
+	// Ignore version numbers, like in python3.12.
+	interpreter = strings.TrimRight(interpreter, "0123456789.")
+
+	return shebangs[interpreter]
+}
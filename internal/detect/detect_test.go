@@ -0,0 +1,91 @@
+package detect
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juliflorezg/lets-go/internal/assert"
+)
+
+// TestCorpus runs the classifier on every sample of the labelled corpus in
+// testdata/corpus, where each directory is named after the language of the
+// samples it holds. The samples of the plaintext directory aren't code, so
+// no language should be detected for them.
+func TestCorpus(t *testing.T) {
+	dirs, err := os.ReadDir("./testdata/corpus")
+	assert.NilError(t, err)
+
+	for _, dir := range dirs {
+		want := dir.Name()
+		if want == "plaintext" {
+			want = ""
+		}
+
+		samples, err := filepath.Glob(filepath.Join("./testdata/corpus", dir.Name(), "*.txt"))
+		assert.NilError(t, err)
+
+		for _, sample := range samples {
+			t.Run(filepath.ToSlash(sample), func(t *testing.T) {
+				content, err := os.ReadFile(sample)
+				assert.NilError(t, err)
+
+				got := Language(string(content))
+				assert.Equal(t, got.Language, want)
+
+				if want != "" && got.Confidence < MinConfidence {
+					t.Errorf("got confidence %v; want at least %v", got.Confidence, MinConfidence)
+				}
+			})
+		}
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		wantLanguage   string
+		wantConfidence float64
+	}{
+		{
+			name:    "Empty",
+			content: "  \n",
+		},
+		{
+			name:           "Shebang",
+			content:        "#!/bin/sh\nls",
+			wantLanguage:   "shell",
+			wantConfidence: 1,
+		},
+		{
+			name:           "Shebang through env with a version",
+			content:        "#!/usr/bin/env python3.12\nx = 1",
+			wantLanguage:   "python",
+			wantConfidence: 1,
+		},
+		{
+			name:           "JSON",
+			content:        `{"a": [1, 2, 3]}`,
+			wantLanguage:   "json",
+			wantConfidence: 1,
+		},
+		{
+			name:    "Lone JSON string",
+			content: `"hello"`,
+		},
+		{
+			name:    "Single keyword",
+			content: "x := 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Language(tt.content)
+
+			assert.Equal(t, got.Language, tt.wantLanguage)
+			assert.Equal(t, got.Confidence, tt.wantConfidence)
+		})
+	}
+}
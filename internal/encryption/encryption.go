@@ -0,0 +1,183 @@
+// Package encryption encrypts the content of snippets at rest with AES-GCM.
+//
+// Keys are identified by a short ID which is stored along with each
+// encrypted value, so that new keys can be introduced without losing access
+// to the values encrypted with the old ones. Keys are written one per line
+// (or separated by commas) as "<id>:<base64 of 32 random bytes>", for example:
+//
+//	2024-01:K34VFiiu0qar9xWICc9PPHYucWDzi02lang0kEUZDP4=
+//
+// A new key can be generated with:
+//
+//	echo "$(date +%Y-%m):$(head -c 32 /dev/urandom | base64)"
+//
+// New values are always encrypted with the last key, so rotating keys means
+// appending a new one and re-encrypting the old values with it.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySize is the size in bytes of the keys, which makes the cipher AES-256.
+const KeySize = 32
+
+// ErrUnknownKey is returned when a value was encrypted with a key which isn't
+// part of the keyring.
+var ErrUnknownKey = errors.New("encryption: unknown key")
+
+// Keyring holds the keys values can be encrypted and decrypted with.
+type Keyring struct {
+	aeads   map[string]cipher.AEAD
+	current string
+}
+
+// New returns a keyring with the given keys, indexed by their ID. Values are
+// encrypted with the key whose ID is current.
+func New(keys map[string][]byte, current string) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("encryption: no key with ID %q", current)
+	}
+
+	kr := &Keyring{aeads: make(map[string]cipher.AEAD, len(keys)), current: current}
+
+	for id, key := range keys {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("encryption: key %q is %d bytes long, want %d", id, len(key), KeySize)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		kr.aeads[id], err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return kr, nil
+}
+
+// Parse reads keys in the format described in the package documentation.
+// Blank lines and lines starting with # are ignored, and the last key is the
+// current one.
+func Parse(s string) (*Keyring, error) {
+	keys := make(map[string][]byte)
+	var current string
+
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == ',' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(line, ":")
+		if !ok || id == "" {
+			return nil, errors.New("encryption: keys must be written as <id>:<base64 key>")
+		}
+
+		if _, ok := keys[id]; ok {
+			return nil, fmt.Errorf("encryption: duplicate key ID %q", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption: key %q: %w", id, err)
+		}
+
+		keys[id] = key
+		current = id
+	}
+
+	if current == "" {
+		return nil, errors.New("encryption: no keys found")
+	}
+
+	return New(keys, current)
+}
+
+// Load reads keys from the file at path.
+func Load(path string) (*Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(string(b))
+}
+
+// EnvVar is the environment variable keys can be given in, instead of a file.
+const EnvVar = "SNIPPETBOX_KEYS"
+
+// FromConfig loads keys from the file at path if it isn't empty, or from the
+// EnvVar environment variable otherwise. If neither is set, it returns a nil
+// keyring and no error.
+func FromConfig(path string) (*Keyring, error) {
+	if path != "" {
+		return Load(path)
+	}
+
+	if keys := os.Getenv(EnvVar); keys != "" {
+		return Parse(keys)
+	}
+
+	return nil, nil
+}
+
+// Current returns the ID of the key new values are encrypted with.
+func (kr *Keyring) Current() string {
+	return kr.current
+}
+
+// Encrypt encrypts plaintext with the current key. It returns the ID of the
+// key and the ciphertext, encoded in base64 with the random nonce in front of
+// it so that it can be stored in a text column.
+func (kr *Keyring) Encrypt(plaintext string) (keyID, ciphertext string, err error) {
+	aead := kr.aeads[kr.current]
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return kr.current, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a ciphertext returned by Encrypt, using the key with the
+// given ID.
+func (kr *Keyring) Decrypt(keyID, ciphertext string) (string, error) {
+	aead, ok := kr.aeads[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("encryption: %w", err)
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encryption: ciphertext too short")
+	}
+
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("encryption: %w", err)
+	}
+
+	return string(plaintext), nil
+}
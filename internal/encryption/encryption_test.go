@@ -0,0 +1,103 @@
+package encryption
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/juliflorezg/lets-go/internal/assert"
+)
+
+const (
+	oldKey = "2024-01:K34VFiiu0qar9xWICc9PPHYucWDzi02lang0kEUZDP4="
+	newKey = "2024-06:YWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWFhYWE="
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	kr, err := Parse(oldKey)
+	assert.NilError(t, err)
+
+	keyID, ciphertext, err := kr.Encrypt("SELECT * FROM snippets;")
+	assert.NilError(t, err)
+	assert.Equal(t, keyID, "2024-01")
+
+	if strings.Contains(ciphertext, "snippets") {
+		t.Errorf("got plaintext in ciphertext %q", ciphertext)
+	}
+
+	// The nonce is random, so the same plaintext never gives the same
+	// ciphertext twice.
+	_, again, err := kr.Encrypt("SELECT * FROM snippets;")
+	assert.NilError(t, err)
+	if again == ciphertext {
+		t.Errorf("got the same ciphertext twice")
+	}
+
+	plaintext, err := kr.Decrypt(keyID, ciphertext)
+	assert.NilError(t, err)
+	assert.Equal(t, plaintext, "SELECT * FROM snippets;")
+
+	// Tampering with the ciphertext is detected.
+	tampered := []byte(ciphertext)
+	tampered[20] ^= 1
+	_, err = kr.Decrypt(keyID, string(tampered))
+	if err == nil {
+		t.Errorf("got no error for a tampered ciphertext")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old, err := Parse(oldKey)
+	assert.NilError(t, err)
+
+	keyID, ciphertext, err := old.Encrypt("hello")
+	assert.NilError(t, err)
+
+	kr, err := Parse("# keys\n" + oldKey + "\n\n" + newKey + "\n")
+	assert.NilError(t, err)
+	assert.Equal(t, kr.Current(), "2024-06")
+
+	plaintext, err := kr.Decrypt(keyID, ciphertext)
+	assert.NilError(t, err)
+	assert.Equal(t, plaintext, "hello")
+
+	newID, _, err := kr.Encrypt("hello")
+	assert.NilError(t, err)
+	assert.Equal(t, newID, "2024-06")
+
+	_, err = old.Decrypt("2024-06", ciphertext)
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("got %v; want ErrUnknownKey", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    string
+		current string
+		wantErr bool
+	}{
+		{name: "Comma separated", keys: oldKey + "," + newKey, current: "2024-06"},
+		{name: "Empty", keys: "\n# no keys yet\n", wantErr: true},
+		{name: "Missing ID", keys: "K34VFiiu0qar9xWICc9PPHYucWDzi02lang0kEUZDP4=", wantErr: true},
+		{name: "Invalid base64", keys: "a:not base64!", wantErr: true},
+		{name: "Short key", keys: "a:c2hvcnQ=", wantErr: true},
+		{name: "Duplicate ID", keys: oldKey + "\n" + oldKey, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := Parse(tt.keys)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got no error")
+				}
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, kr.Current(), tt.current)
+		})
+	}
+}
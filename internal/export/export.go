@@ -0,0 +1,184 @@
+// Package export defines the layout of the archive a user can download with
+// all of their data. An archive is a zip file containing:
+//
+//	profile.json      the user's profile (a Profile value)
+//	settings.json     the user's settings (a Settings value)
+//	snippets.json     the metadata of every snippet (a []Snippet value)
+//	snippets/<id>.txt the content of each snippet
+//	drafts.json       the metadata of every draft (a []Draft value)
+//	drafts/<id>.txt   the content of each draft
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	ProfileFile  = "profile.json"
+	SettingsFile = "settings.json"
+	SnippetsFile = "snippets.json"
+	DraftsFile   = "drafts.json"
+)
+
+// Profile holds the account details of the user the archive belongs to.
+type Profile struct {
+	ID      int       `json:"id"`
+	Name    string    `json:"name"`
+	Email   string    `json:"email"`
+	Bio     string    `json:"bio"`
+	Created time.Time `json:"created"`
+}
+
+// Settings holds the settings of the user the archive belongs to: the kinds
+// of notifications they opted out of, their webhooks, and how they can log
+// in besides their password.
+type Settings struct {
+	DisabledNotifications []string  `json:"disabled_notifications"`
+	Webhooks              []Webhook `json:"webhooks"`
+	TwoFactorMethods      []string  `json:"two_factor_methods"`
+	Passkeys              []Passkey `json:"passkeys"`
+}
+
+// Webhook describes a webhook of the user. Its secret is left out, along with
+// its deliveries.
+type Webhook struct {
+	URL     string    `json:"url"`
+	Events  []string  `json:"events"`
+	Created time.Time `json:"created"`
+}
+
+// Passkey describes a passkey of the user by its name. Its credential is
+// left out, and LastUsed is zero if it was never used to log in.
+type Passkey struct {
+	Name     string    `json:"name"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// Snippet holds the metadata of a snippet. File is the path, inside the
+// archive, of the file holding its content. For Encrypted snippets, that's
+// the ciphertext made by the browser, which can only be decrypted with the
+// key in the link the snippet was shared with.
+type Snippet struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Language  string    `json:"language"`
+	File      string    `json:"file"`
+	Encrypted bool      `json:"encrypted,omitempty"`
+	Pinned    bool      `json:"pinned,omitempty"`
+	Created   time.Time `json:"created"`
+	PublishAt time.Time `json:"publish_at"`
+	Expires   time.Time `json:"expires"`
+}
+
+// Draft holds the metadata of a draft. File is the path, inside the archive,
+// of the file holding its content, and Expires the number of days the
+// snippet is to be kept for once it's published.
+type Draft struct {
+	ID       int       `json:"id"`
+	Title    string    `json:"title"`
+	Language string    `json:"language"`
+	File     string    `json:"file"`
+	Expires  int       `json:"expires_days"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Archive is the data of a user, as written to a zip file by Write. The
+// Content and DraftContent maps hold the content of each snippet and draft,
+// keyed by their ID.
+type Archive struct {
+	Profile      Profile
+	Settings     Settings
+	Snippets     []Snippet
+	Content      map[int]string
+	Drafts       []Draft
+	DraftContent map[int]string
+}
+
+// SnippetPath returns the path, inside an archive, of the file holding the
+// content of the snippet with the given ID.
+func SnippetPath(id int) string {
+	return fmt.Sprintf("snippets/%d.txt", id)
+}
+
+// DraftPath returns the path, inside an archive, of the file holding the
+// content of the draft with the given ID.
+func DraftPath(id int) string {
+	return fmt.Sprintf("drafts/%d.txt", id)
+}
+
+// Write writes the archive as a zip file to w. The File field of each snippet
+// and draft is set by Write, so callers can leave it empty.
+func Write(w io.Writer, a Archive) error {
+	zw := zip.NewWriter(w)
+
+	err := writeJSON(zw, ProfileFile, a.Profile)
+	if err != nil {
+		return err
+	}
+
+	err = writeJSON(zw, SettingsFile, a.Settings)
+	if err != nil {
+		return err
+	}
+
+	snippets := make([]Snippet, len(a.Snippets))
+	for i, s := range a.Snippets {
+		s.File = SnippetPath(s.ID)
+		snippets[i] = s
+
+		err := writeFile(zw, s.File, a.Content[s.ID])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writeJSON(zw, SnippetsFile, snippets)
+	if err != nil {
+		return err
+	}
+
+	drafts := make([]Draft, len(a.Drafts))
+	for i, d := range a.Drafts {
+		d.File = DraftPath(d.ID)
+		drafts[i] = d
+
+		err := writeFile(zw, d.File, a.DraftContent[d.ID])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writeJSON(zw, DraftsFile, drafts)
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func writeFile(zw *zip.Writer, name, content string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(f, content)
+	return err
+}
+
+func writeJSON(zw *zip.Writer, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
@@ -0,0 +1,86 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/assert"
+)
+
+func TestWrite(t *testing.T) {
+	created := time.Date(2024, 2, 20, 12, 45, 32, 0, time.UTC)
+
+	archive := Archive{
+		Profile: Profile{ID: 1, Name: "Alice", Email: "alice@example.com", Created: created},
+		Settings: Settings{
+			DisabledNotifications: []string{"expiring"},
+			Webhooks:              []Webhook{{URL: "https://hooks.example.com", Events: []string{"snippet.created"}, Created: created}},
+			TwoFactorMethods:      []string{"authenticator app"},
+			Passkeys:              []Passkey{{Name: "Laptop", Created: created}},
+		},
+		Snippets: []Snippet{
+			{ID: 3, Title: "First", Created: created, PublishAt: created, Expires: created.AddDate(1, 0, 0)},
+			{ID: 7, Title: "Second", Pinned: true, Created: created, PublishAt: created.AddDate(0, 0, 1), Expires: created.AddDate(0, 0, 7)},
+		},
+		Content: map[int]string{3: "first content", 7: "second content"},
+		Drafts: []Draft{
+			{ID: 2, Title: "Draft", Language: "go", Expires: 7, Updated: created},
+		},
+		DraftContent: map[int]string{2: "draft content"},
+	}
+
+	buf := new(bytes.Buffer)
+	err := Write(buf, archive)
+	assert.NilError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NilError(t, err)
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		assert.NilError(t, err)
+		b, err := io.ReadAll(rc)
+		assert.NilError(t, err)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+
+	assert.Equal(t, len(files), 7)
+	assert.Equal(t, files["snippets/3.txt"], "first content")
+	assert.Equal(t, files["snippets/7.txt"], "second content")
+	assert.Equal(t, files["drafts/2.txt"], "draft content")
+
+	var profile Profile
+	err = json.Unmarshal([]byte(files[ProfileFile]), &profile)
+	assert.NilError(t, err)
+	assert.Equal(t, profile, archive.Profile)
+
+	var snippets []Snippet
+	err = json.Unmarshal([]byte(files[SnippetsFile]), &snippets)
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 2)
+	assert.Equal(t, snippets[1].Title, "Second")
+	assert.Equal(t, snippets[1].File, "snippets/7.txt")
+	assert.Equal(t, snippets[1].Pinned, true)
+	assert.Equal(t, snippets[1].PublishAt, archive.Snippets[1].PublishAt)
+
+	var drafts []Draft
+	err = json.Unmarshal([]byte(files[DraftsFile]), &drafts)
+	assert.NilError(t, err)
+	assert.Equal(t, len(drafts), 1)
+	assert.Equal(t, drafts[0].File, "drafts/2.txt")
+	assert.Equal(t, drafts[0].Expires, 7)
+
+	var settings Settings
+	err = json.Unmarshal([]byte(files[SettingsFile]), &settings)
+	assert.NilError(t, err)
+	assert.Equal(t, settings.DisabledNotifications[0], "expiring")
+	assert.Equal(t, settings.Webhooks[0].URL, "https://hooks.example.com")
+	assert.Equal(t, settings.TwoFactorMethods[0], "authenticator app")
+	assert.Equal(t, settings.Passkeys[0].Name, "Laptop")
+}
@@ -0,0 +1,90 @@
+// Package fingerprint computes fingerprints of snippet contents, used to
+// detect snippets which are identical or nearly identical to each other.
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+// NearDuplicateDistance is the maximum number of bits by which the simhashes
+// of two contents can differ for them to be considered near-duplicates.
+// Snippets are short documents, where changing a single word already flips a
+// few bits, so this is more lenient than the usual 3 bits. Unrelated contents
+// differ by about 32 bits.
+const NearDuplicateDistance = 6
+
+// shingleSize is the number of consecutive words hashed together as a single
+// feature by Simhash.
+const shingleSize = 3
+
+// Hash returns the SHA-256 hash of a content, as a hex string. Line endings
+// and trailing whitespace are normalized first, so that a content pasted from
+// another operating system still hashes the same.
+func Hash(content string) string {
+	sum := sha256.Sum256([]byte(normalize(content)))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalize(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// Simhash returns the 64-bit simhash of a content. Unlike with a
+// cryptographic hash, similar contents have simhashes which differ in only a
+// few bits, which Distance counts.
+//
+// The features hashed are the shingles of shingleSize consecutive words of
+// the content, ignoring case, punctuation and whitespace.
+func Simhash(content string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_'
+	})
+	if len(words) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+
+	n := max(len(words)-shingleSize+1, 1)
+	for i := 0; i < n; i++ {
+		end := min(i+shingleSize, len(words))
+
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:end], " ")))
+		sum := h.Sum64()
+
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var simhash uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			simhash |= 1 << bit
+		}
+	}
+
+	return simhash
+}
+
+// Distance returns the number of bits by which two simhashes differ.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,84 @@
+package fingerprint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/juliflorezg/lets-go/internal/assert"
+)
+
+const original = `package main
+
+import "fmt"
+
+// greet prints a greeting for each of the given names, one per line, so that
+// everybody in the room feels welcome when the program starts.
+func greet(names []string) {
+	for _, name := range names {
+		fmt.Printf("Hello, %s! Welcome to the party.\n", name)
+	}
+}
+
+func main() {
+	greet([]string{"Alice", "Bob", "Carol", "Dave", "Eve"})
+}
+`
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  string
+		equal bool
+	}{
+		{name: "Identical", a: original, b: original, equal: true},
+		{name: "Windows line endings", a: "a\nb\n", b: "a\r\nb\r\n", equal: true},
+		{name: "Trailing whitespace", a: "a\nb", b: "a  \nb\t\n\n", equal: true},
+		{name: "Different", a: "a\nb", b: "a\nc", equal: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Hash(tt.a) == Hash(tt.b), tt.equal)
+		})
+	}
+}
+
+func TestSimhash(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		similar bool
+	}{
+		{
+			name:    "Identical",
+			a:       original,
+			b:       original,
+			similar: true,
+		},
+		{
+			name:    "One word changed",
+			a:       original,
+			b:       strings.Replace(original, "party", "meeting", 1),
+			similar: true,
+		},
+		{
+			name:    "Different",
+			a:       original,
+			b:       "SELECT id, title, content FROM snippets WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10",
+			similar: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Distance(Simhash(tt.a), Simhash(tt.b))
+			assert.Equal(t, d <= NearDuplicateDistance, tt.similar)
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	assert.Equal(t, Distance(0, 0), 0)
+	assert.Equal(t, Distance(0b1011, 0b0001), 2)
+	assert.Equal(t, Distance(0, ^uint64(0)), 64)
+}
@@ -0,0 +1,97 @@
+// Package language knows about the programming and markup languages a
+// snippet can be written in.
+package language
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Language describes a language a snippet can be written in. Name is the
+// value stored with the snippet and Label is the human readable version of
+// it.
+type Language struct {
+	Name       string
+	Label      string
+	Extensions []string
+	Filenames  []string
+}
+
+// All lists the supported languages, in the order they should be offered to
+// users.
+var All = []Language{
+	{Name: "plaintext", Label: "Plain text", Extensions: []string{".txt", ".text"}},
+	{Name: "go", Label: "Go", Extensions: []string{".go"}, Filenames: []string{"go.mod", "go.sum"}},
+	{Name: "python", Label: "Python", Extensions: []string{".py", ".pyw"}},
+	{Name: "javascript", Label: "JavaScript", Extensions: []string{".js", ".mjs", ".cjs", ".jsx"}},
+	{Name: "typescript", Label: "TypeScript", Extensions: []string{".ts", ".tsx"}},
+	{Name: "sql", Label: "SQL", Extensions: []string{".sql"}},
+	{Name: "shell", Label: "Shell", Extensions: []string{".sh", ".bash", ".zsh"}},
+	{Name: "yaml", Label: "YAML", Extensions: []string{".yaml", ".yml"}},
+	{Name: "json", Label: "JSON", Extensions: []string{".json"}},
+	{Name: "html", Label: "HTML", Extensions: []string{".html", ".htm"}},
+	{Name: "css", Label: "CSS", Extensions: []string{".css"}},
+	{Name: "markdown", Label: "Markdown", Extensions: []string{".md", ".markdown"}},
+	{Name: "dockerfile", Label: "Dockerfile", Extensions: []string{".dockerfile"}, Filenames: []string{"Dockerfile", "Containerfile"}},
+	{Name: "c", Label: "C", Extensions: []string{".c", ".h"}},
+	{Name: "java", Label: "Java", Extensions: []string{".java"}},
+	{Name: "rust", Label: "Rust", Extensions: []string{".rs"}},
+	{Name: "ruby", Label: "Ruby", Extensions: []string{".rb"}},
+}
+
+// Names returns the Name of every supported language.
+func Names() []string {
+	names := make([]string, len(All))
+	for i, l := range All {
+		names[i] = l.Name
+	}
+	return names
+}
+
+// Label returns the human readable label of the language with the given name,
+// or the name itself if the language is unknown.
+func Label(name string) string {
+	for _, l := range All {
+		if l.Name == name {
+			return l.Label
+		}
+	}
+	return name
+}
+
+// FromFilename guesses the language of a file from its name, looking at
+// well-known file names first and at its extension then. It returns the empty
+// string if the language can't be guessed.
+func FromFilename(name string) string {
+	base := filepath.Base(name)
+	ext := strings.ToLower(filepath.Ext(base))
+
+	for _, l := range All {
+		for _, f := range l.Filenames {
+			if strings.EqualFold(base, f) {
+				return l.Name
+			}
+		}
+	}
+
+	for _, l := range All {
+		for _, e := range l.Extensions {
+			if ext == e {
+				return l.Name
+			}
+		}
+	}
+
+	return ""
+}
+
+// Extension returns the usual file extension of the language with the given
+// name, or ".txt" if the language is unknown.
+func Extension(name string) string {
+	for _, l := range All {
+		if l.Name == name && len(l.Extensions) > 0 {
+			return l.Extensions[0]
+		}
+	}
+	return ".txt"
+}
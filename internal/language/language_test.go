@@ -0,0 +1,47 @@
+package language
+
+import (
+	"testing"
+
+	"github.com/juliflorezg/lets-go/internal/assert"
+)
+
+func TestFromFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{name: "Extension", filename: "main.go", want: "go"},
+		{name: "Upper case extension", filename: "SCRIPT.PY", want: "python"},
+		{name: "Nested path", filename: "src/app/index.tsx", want: "typescript"},
+		{name: "Well-known file name", filename: "build/Dockerfile", want: "dockerfile"},
+		{name: "Unknown extension", filename: "notes.xyz", want: ""},
+		{name: "No extension", filename: "README", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, FromFilename(tt.filename), tt.want)
+		})
+	}
+}
+
+func TestExtension(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		want     string
+	}{
+		{name: "Known language", language: "go", want: ".go"},
+		{name: "First extension", language: "yaml", want: ".yaml"},
+		{name: "Unknown language", language: "cobol", want: ".txt"},
+		{name: "No language", language: "", want: ".txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Extension(tt.language), tt.want)
+		})
+	}
+}
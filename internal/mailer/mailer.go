@@ -0,0 +1,203 @@
+// Package mailer sends the emails of the application, such as the links
+// users follow to verify their email address. Mailer is implemented by SMTP
+// for production, FileDrop for development (which writes every message to a
+// .eml file instead of sending it) and Memory for tests.
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidHeader is returned when the recipient or the subject of a message
+// contains a line break, which would let them add headers of their own.
+var ErrInvalidHeader = errors.New("mailer: line break in header")
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTP sends messages through an SMTP server.
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTP returns a mailer which sends messages through the SMTP server at
+// addr (a "host:port" pair), from the given address. The server is only
+// authenticated with when a username is given.
+func NewSMTP(addr, username, password, from string) (*SMTP, error) {
+	_, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: invalid sender %q: %w", from, err)
+	}
+
+	m := &SMTP{addr: addr, from: from}
+
+	if username != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return m, nil
+}
+
+func (m *SMTP) Send(msg Message) error {
+	data, err := format(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// The envelope only takes bare addresses, without display names.
+	from, _ := mail.ParseAddress(m.from)
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.addr, m.auth, from.Address, []string{to.Address}, data)
+}
+
+// FileDrop writes every message to its own .eml file in a directory, which
+// can be opened with any email client.
+type FileDrop struct {
+	dir  string
+	from string
+}
+
+// NewFileDrop returns a mailer which writes messages from the given address
+// to dir, creating it if needed.
+func NewFileDrop(dir, from string) (*FileDrop, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileDrop{dir: dir, from: from}, nil
+}
+
+func (m *FileDrop) Send(msg Message) error {
+	now := time.Now()
+
+	data, err := format(m.from, msg, now)
+	if err != nil {
+		return err
+	}
+
+	// The time comes first so that the files sort in the order they were
+	// written.
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), randomHex(4))
+
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o600)
+}
+
+// Memory keeps messages instead of sending them, so that tests can read
+// them. It's safe for concurrent use.
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *Memory) Send(msg Message) error {
+	if hasLineBreak(msg.To) || hasLineBreak(msg.Subject) {
+		return ErrInvalidHeader
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
+
+// Last returns the latest message sent, and false if there's none.
+func (m *Memory) Last() (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.messages) == 0 {
+		return Message{}, false
+	}
+	return m.messages[len(m.messages)-1], true
+}
+
+// format returns a message as sent over SMTP: headers followed by the body,
+// with CRLF line endings. The body is quoted-printable encoded, so that it
+// can hold any text whatever the server supports.
+func format(from string, msg Message, date time.Time) ([]byte, error) {
+	if hasLineBreak(msg.To) || hasLineBreak(msg.Subject) {
+		return nil, ErrInvalidHeader
+	}
+
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		_, domain, _ = strings.Cut(addr.Address, "@")
+	}
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", randomHex(16), domain)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	b.WriteString("\r\n")
+
+	body := strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n")
+
+	qp := quotedprintable.NewWriter(&b)
+	_, err := qp.Write([]byte(body))
+	if err != nil {
+		return nil, err
+	}
+
+	err = qp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func hasLineBreak(s string) bool {
+	return strings.ContainsAny(s, "\r\n")
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
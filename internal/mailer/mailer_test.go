@@ -0,0 +1,102 @@
+package mailer
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juliflorezg/lets-go/internal/assert"
+)
+
+var testMessage = Message{
+	To:      "Rob <rob@example.com>",
+	Subject: "Vérifiez votre adresse",
+	Body:    "Hello Rob,\n\nPlease follow this link: https://example.com/user/verify/" + strings.Repeat("x", 100) + "\n",
+}
+
+func TestFileDrop(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := NewFileDrop(dir, "Snippetbox <no-reply@snippetbox.test>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send(testMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(files), 1)
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, msg.Header.Get("From"), "Snippetbox <no-reply@snippetbox.test>")
+	assert.Equal(t, msg.Header.Get("To"), testMessage.To)
+	assert.Equal(t, subject, testMessage.Subject)
+	assert.Equal(t, strings.HasSuffix(msg.Header.Get("Message-ID"), "@snippetbox.test>"), true)
+
+	// mail.ReadMessage leaves the body as it is, so it's decoded here.
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(body), strings.ReplaceAll(testMessage.Body, "\n", "\r\n"))
+}
+
+func TestMemory(t *testing.T) {
+	var m Memory
+
+	_, ok := m.Last()
+	assert.Equal(t, ok, false)
+
+	m.Send(Message{To: "a@example.com"})
+	m.Send(testMessage)
+
+	last, ok := m.Last()
+	assert.Equal(t, ok, true)
+	assert.Equal(t, last, testMessage)
+	assert.Equal(t, len(m.Messages()), 2)
+}
+
+func TestHeaderInjection(t *testing.T) {
+	messages := []Message{
+		{To: "rob@example.com\r\nBcc: eve@example.com", Subject: "Hello"},
+		{To: "rob@example.com", Subject: "Hello\nBcc: eve@example.com"},
+	}
+
+	for _, msg := range messages {
+		var m Memory
+		assert.Equal(t, errors.Is(m.Send(msg), ErrInvalidHeader), true)
+
+		fd, err := NewFileDrop(t.TempDir(), "no-reply@snippetbox.test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, errors.Is(fd.Send(msg), ErrInvalidHeader), true)
+	}
+}
@@ -0,0 +1,319 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The kinds of hits recorded for a snippet: views of its page, requests of
+// its raw content (or downloads of it), and views of its embed.
+const (
+	HitView     = "view"
+	HitRaw      = "raw"
+	HitDownload = "download"
+	HitEmbed    = "embed"
+)
+
+// hitColumns maps each kind of hit to the column counting it.
+var hitColumns = map[string]string{
+	HitView:     "views",
+	HitRaw:      "raw",
+	HitDownload: "downloads",
+	HitEmbed:    "embeds",
+}
+
+type AnalyticsModelInterface interface {
+	Record(hit Hit) error
+	Daily(snippetID int, from, to time.Time) ([]DailyHitCounts, error)
+	Totals(snippetID int) (HitCounts, error)
+	TopReferrers(snippetID, limit int) ([]Referrer, error)
+	RollUp(before time.Time) error
+	DeleteVisitors(before time.Time) error
+}
+
+// Hit is a request for a snippet. Kind is one of the Hit constants. IP and
+// UserAgent identify the visitor, and are only kept as a hash salted with a
+// random value which changes every day, so that visitors can be counted once
+// a day without being tracked. ReferrerHost is the host of the page which
+// linked to (or embedded) the snippet, if it's another site.
+type Hit struct {
+	SnippetID    int
+	Kind         string
+	IP           string
+	UserAgent    string
+	ReferrerHost string
+}
+
+// HitCounts holds the number of hits of each kind for a snippet. Visitors is
+// the number of unique visitors of each day, added up.
+type HitCounts struct {
+	Views     int
+	Visitors  int
+	Raw       int
+	Downloads int
+	Embeds    int
+}
+
+// DailyHitCounts holds the hits of a snippet on a given day (in UTC).
+type DailyHitCounts struct {
+	Day time.Time
+	HitCounts
+}
+
+// Referrer is a site which sent visitors to a snippet.
+type Referrer struct {
+	Host string
+	Hits int
+}
+
+// AnalyticsModel records hits in daily rows, which RollUp later turns into
+// monthly ones. The salt of the current day is cached, along with the day it
+// was made for.
+type AnalyticsModel struct {
+	DB *sql.DB
+
+	mu      sync.Mutex
+	saltDay string
+	salt    string
+}
+
+// dayLayout is the format of the DATE columns.
+const dayLayout = "2006-01-02"
+
+// Record counts a hit of a snippet for the current day.
+func (am *AnalyticsModel) Record(hit Hit) error {
+	column, ok := hitColumns[hit.Kind]
+	if !ok {
+		return fmt.Errorf("models: unknown kind of hit %q", hit.Kind)
+	}
+
+	day := time.Now().UTC().Format(dayLayout)
+
+	salt, err := am.daySalt(day)
+	if err != nil {
+		return err
+	}
+
+	visitor := sha256.Sum256([]byte(salt + "\x00" + hit.IP + "\x00" + hit.UserAgent))
+
+	// The visitor is only counted if it's the first time they're seen today.
+	result, err := am.DB.Exec(`INSERT IGNORE INTO snippet_visitors (snippet_id, day, visitor) VALUES (?, ?, ?)`,
+		hit.SnippetID, day, hex.EncodeToString(visitor[:]))
+	if err != nil {
+		return err
+	}
+
+	newVisitors, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	stmt := fmt.Sprintf(`INSERT INTO snippet_daily_stats (snippet_id, day, %[1]s, visitors) VALUES (?, ?, 1, ?)
+	ON DUPLICATE KEY UPDATE %[1]s = %[1]s + 1, visitors = visitors + VALUES(visitors)`, column)
+
+	_, err = am.DB.Exec(stmt, hit.SnippetID, day, newVisitors)
+	if err != nil {
+		return err
+	}
+
+	if hit.ReferrerHost == "" {
+		return nil
+	}
+
+	_, err = am.DB.Exec(`INSERT INTO snippet_referrers (snippet_id, day, host, hits) VALUES (?, ?, ?, 1)
+	ON DUPLICATE KEY UPDATE hits = hits + 1`, hit.SnippetID, day, hit.ReferrerHost)
+	return err
+}
+
+// daySalt returns the salt visitors are hashed with on the given day. It's
+// stored in the database so that every instance of the application (and
+// every restart) uses the same one, and deleted by DeleteVisitors once the
+// day is over.
+func (am *AnalyticsModel) daySalt(day string) (string, error) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	if am.saltDay == day {
+		return am.salt, nil
+	}
+
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	// Another instance may have made the salt of the day already, in which
+	// case this one is ignored.
+	_, err = am.DB.Exec(`INSERT IGNORE INTO analytics_salts (day, salt) VALUES (?, ?)`, day, hex.EncodeToString(b))
+	if err != nil {
+		return "", err
+	}
+
+	var salt string
+	err = am.DB.QueryRow(`SELECT salt FROM analytics_salts WHERE day = ?`, day).Scan(&salt)
+	if err != nil {
+		return "", err
+	}
+
+	am.saltDay, am.salt = day, salt
+
+	return salt, nil
+}
+
+// Daily returns the hits of a snippet for each day from from to to, both
+// included, with zero counts for the days without hits.
+func (am *AnalyticsModel) Daily(snippetID int, from, to time.Time) ([]DailyHitCounts, error) {
+	stmt := `SELECT day, views, visitors, raw, downloads, embeds FROM snippet_daily_stats
+	WHERE snippet_id = ? AND day BETWEEN ? AND ?`
+
+	rows, err := am.DB.Query(stmt, snippetID, from.Format(dayLayout), to.Format(dayLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]HitCounts)
+
+	for rows.Next() {
+		var day time.Time
+		var c HitCounts
+
+		err := rows.Scan(&day, &c.Views, &c.Visitors, &c.Raw, &c.Downloads, &c.Embeds)
+		if err != nil {
+			return nil, err
+		}
+
+		counts[day.Format(dayLayout)] = c
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var days []DailyHitCounts
+
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, DailyHitCounts{Day: day, HitCounts: counts[day.Format(dayLayout)]})
+	}
+
+	return days, nil
+}
+
+// Totals returns all the hits of a snippet, from the daily and the monthly
+// rows.
+func (am *AnalyticsModel) Totals(snippetID int) (HitCounts, error) {
+	stmt := `SELECT COALESCE(SUM(views), 0), COALESCE(SUM(visitors), 0), COALESCE(SUM(raw), 0),
+	COALESCE(SUM(downloads), 0), COALESCE(SUM(embeds), 0)
+	FROM (
+		SELECT views, visitors, raw, downloads, embeds FROM snippet_daily_stats WHERE snippet_id = ?
+		UNION ALL
+		SELECT views, visitors, raw, downloads, embeds FROM snippet_monthly_stats WHERE snippet_id = ?
+	) AS s`
+
+	var c HitCounts
+	err := am.DB.QueryRow(stmt, snippetID, snippetID).Scan(&c.Views, &c.Visitors, &c.Raw, &c.Downloads, &c.Embeds)
+
+	return c, err
+}
+
+// TopReferrers returns the sites which sent the most visitors to a snippet,
+// up to limit of them.
+func (am *AnalyticsModel) TopReferrers(snippetID, limit int) ([]Referrer, error) {
+	stmt := `SELECT host, SUM(hits) AS total
+	FROM (
+		SELECT host, hits FROM snippet_referrers WHERE snippet_id = ?
+		UNION ALL
+		SELECT host, hits FROM snippet_monthly_referrers WHERE snippet_id = ?
+	) AS r
+	GROUP BY host ORDER BY total DESC, host LIMIT ?`
+
+	rows, err := am.DB.Query(stmt, snippetID, snippetID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var referrers []Referrer
+
+	for rows.Next() {
+		var r Referrer
+
+		err := rows.Scan(&r.Host, &r.Hits)
+		if err != nil {
+			return nil, err
+		}
+
+		referrers = append(referrers, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return referrers, nil
+}
+
+// RollUp adds the daily rows of the days before the given one to the monthly
+// rows of their month, and deletes them. before should be the first day of a
+// month, so that the daily rows of a month are rolled up all at once.
+func (am *AnalyticsModel) RollUp(before time.Time) error {
+	tx, err := am.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	day := before.Format(dayLayout)
+
+	_, err = tx.Exec(`INSERT INTO snippet_monthly_stats (snippet_id, month, views, visitors, raw, downloads, embeds)
+	SELECT snippet_id, DATE_FORMAT(day, '%Y-%m-01') AS month, SUM(views), SUM(visitors), SUM(raw), SUM(downloads), SUM(embeds)
+	FROM snippet_daily_stats WHERE day < ? GROUP BY snippet_id, month
+	ON DUPLICATE KEY UPDATE views = snippet_monthly_stats.views + VALUES(views),
+	visitors = snippet_monthly_stats.visitors + VALUES(visitors), raw = snippet_monthly_stats.raw + VALUES(raw),
+	downloads = snippet_monthly_stats.downloads + VALUES(downloads), embeds = snippet_monthly_stats.embeds + VALUES(embeds)`, day)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM snippet_daily_stats WHERE day < ?`, day)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO snippet_monthly_referrers (snippet_id, month, host, hits)
+	SELECT snippet_id, DATE_FORMAT(day, '%Y-%m-01') AS month, host, SUM(hits)
+	FROM snippet_referrers WHERE day < ? GROUP BY snippet_id, month, host
+	ON DUPLICATE KEY UPDATE hits = snippet_monthly_referrers.hits + VALUES(hits)`, day)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM snippet_referrers WHERE day < ?`, day)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteVisitors deletes the hashes of the visitors of the days before the
+// given one, along with the salts of those days. Visitors are already counted
+// in the daily rows by then, and without the salts the hashes can't be
+// matched against IP addresses anymore.
+func (am *AnalyticsModel) DeleteVisitors(before time.Time) error {
+	day := before.Format(dayLayout)
+
+	_, err := am.DB.Exec(`DELETE FROM snippet_visitors WHERE day < ?`, day)
+	if err != nil {
+		return err
+	}
+
+	_, err = am.DB.Exec(`DELETE FROM analytics_salts WHERE day < ?`, day)
+	return err
+}
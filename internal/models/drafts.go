@@ -0,0 +1,245 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/encryption"
+)
+
+type DraftModelInterface interface {
+	Save(id, userID int, title, content, language string, expires int) (int, error)
+	Get(id int) (Draft, error)
+	ByUser(userID int) ([]Draft, error)
+	Delete(id, userID int) error
+}
+
+// Draft holds a snippet which is still being written. Drafts live in their
+// own table so they never show up where snippets are listed, and they have no
+// expiry date yet: Expires is the number of days the snippet will be kept for
+// once it's published.
+type Draft struct {
+	ID       int
+	UserID   int
+	Title    string
+	Content  string
+	Language string
+	Expires  int
+	Updated  time.Time
+}
+
+// DraftModel stores drafts, whose contents are encrypted with the current key
+// of Keys like the ones of snippets (see SnippetModel).
+type DraftModel struct {
+	DB   *sql.DB
+	Keys *encryption.Keyring
+}
+
+// Save creates a new draft for the user if id is 0, or updates the draft with
+// the given ID otherwise. It returns the ID of the draft, or ErrNoRecord if
+// the draft to update doesn't exist or belongs to somebody else.
+func (dm *DraftModel) Save(id, userID int, title, content, language string, expires int) (int, error) {
+	keyID, stored, err := dm.encrypt(content)
+	if err != nil {
+		return 0, err
+	}
+
+	if id == 0 {
+		stmt := `INSERT INTO drafts (user_id, title, content, key_id, language, expires, updated)
+		VALUES(?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+		result, err := dm.DB.Exec(stmt, userID, title, stored, keyID, language, expires)
+		if err != nil {
+			return 0, err
+		}
+
+		newID, err := result.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+
+		return int(newID), nil
+	}
+
+	stmt := `UPDATE drafts SET title = ?, content = ?, key_id = ?, language = ?, expires = ?, updated = UTC_TIMESTAMP()
+	WHERE id = ? AND user_id = ?`
+
+	result, err := dm.DB.Exec(stmt, title, stored, keyID, language, expires, id, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	// A draft which is saved twice with the same values isn't counted as
+	// affected by MySQL, so check whether it exists rather than relying on
+	// RowsAffected() alone.
+	if n, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		d, err := dm.Get(id)
+		if err != nil {
+			return 0, err
+		}
+		if d.UserID != userID {
+			return 0, ErrNoRecord
+		}
+	}
+
+	return id, nil
+}
+
+func (dm *DraftModel) Get(id int) (Draft, error) {
+	stmt := `SELECT id, user_id, title, content, key_id, language, expires, updated FROM drafts
+	WHERE id = ?`
+
+	d, err := dm.scan(dm.DB.QueryRow(stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Draft{}, ErrNoRecord
+		} else {
+			return Draft{}, err
+		}
+	}
+
+	return d, nil
+}
+
+// ByUser returns the drafts of the given user, most recently updated first.
+func (dm *DraftModel) ByUser(userID int) ([]Draft, error) {
+	stmt := `SELECT id, user_id, title, content, key_id, language, expires, updated FROM drafts
+	WHERE user_id = ? ORDER BY updated DESC`
+
+	rows, err := dm.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []Draft
+
+	for rows.Next() {
+		d, err := dm.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		drafts = append(drafts, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return drafts, nil
+}
+
+// Delete removes a draft, provided it belongs to the given user.
+func (dm *DraftModel) Delete(id, userID int) error {
+	stmt := `DELETE FROM drafts WHERE id = ? AND user_id = ?`
+
+	_, err := dm.DB.Exec(stmt, id, userID)
+	return err
+}
+
+// Rekey re-encrypts the contents of up to batchSize drafts which aren't
+// encrypted with the current key yet. Like SnippetModel.Rekey, it returns
+// how many drafts it looked at, so that callers can keep calling it until it
+// returns 0.
+func (dm *DraftModel) Rekey(batchSize int) (int, error) {
+	if dm.Keys == nil {
+		return 0, errors.New("models: no keys to re-encrypt drafts with")
+	}
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id, content, key_id FROM drafts WHERE key_id <> ? ORDER BY id LIMIT ? FOR UPDATE`,
+		dm.Keys.Current(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type storedContent struct {
+		id      int
+		content string
+		keyID   string
+	}
+
+	var contents []storedContent
+
+	for rows.Next() {
+		var c storedContent
+
+		err := rows.Scan(&c.id, &c.content, &c.keyID)
+		if err != nil {
+			return 0, err
+		}
+
+		contents = append(contents, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, c := range contents {
+		content, err := dm.decrypt(c.keyID, c.content)
+		if err != nil {
+			return 0, fmt.Errorf("models: draft %d: %w", c.id, err)
+		}
+
+		keyID, stored, err := dm.encrypt(content)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(`UPDATE drafts SET content = ?, key_id = ? WHERE id = ?`, stored, keyID, c.id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(contents), tx.Commit()
+}
+
+// scan scans a row of the drafts table, selected in the order of the Draft
+// fields with key_id after content, and decrypts its content.
+func (dm *DraftModel) scan(row interface{ Scan(dest ...any) error }) (Draft, error) {
+	var d Draft
+	var keyID string
+
+	err := row.Scan(&d.ID, &d.UserID, &d.Title, &d.Content, &keyID, &d.Language, &d.Expires, &d.Updated)
+	if err != nil {
+		return Draft{}, err
+	}
+
+	d.Content, err = dm.decrypt(keyID, d.Content)
+	if err != nil {
+		return Draft{}, fmt.Errorf("models: draft %d: %w", d.ID, err)
+	}
+
+	return d, nil
+}
+
+// encrypt and decrypt work like the ones of SnippetModel.
+func (dm *DraftModel) encrypt(content string) (keyID, stored string, err error) {
+	if dm.Keys == nil {
+		return "", content, nil
+	}
+	return dm.Keys.Encrypt(content)
+}
+
+func (dm *DraftModel) decrypt(keyID, stored string) (string, error) {
+	if keyID == "" {
+		return stored, nil
+	}
+	if dm.Keys == nil {
+		return "", encryption.ErrUnknownKey
+	}
+	return dm.Keys.Decrypt(keyID, stored)
+}
@@ -11,4 +11,16 @@ var (
 	// Add a new ErrDuplicateEmail error. We'll use this later if a user
 	// tries to signup with an email address that's already in use.
 	ErrDuplicateEmail = errors.New("models: duplicate email")
+
+	// ErrDuplicateReport is returned when a user reports a snippet they
+	// already reported, and which no moderator has looked into yet.
+	ErrDuplicateReport = errors.New("models: duplicate report")
+
+	// ErrSuspendedUser is returned when a suspended user tries to log in
+	// with the right credentials.
+	ErrSuspendedUser = errors.New("models: suspended user")
+
+	// ErrDuplicatePasskey is returned when a user registers a passkey whose
+	// credential is already registered.
+	ErrDuplicatePasskey = errors.New("models: duplicate passkey")
 )
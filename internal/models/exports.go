@@ -0,0 +1,147 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// The possible values for the status of an export.
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+	ExportExpired = "expired"
+)
+
+type ExportModelInterface interface {
+	Insert(userID int) (int, error)
+	SetStatus(id int, status string) error
+	Get(id int) (Export, error)
+	LatestByUser(userID int) (Export, error)
+	Expire(before time.Time) ([]int, error)
+}
+
+// Export records a request from a user to download an archive of their data.
+// The archive itself is built in the background and lives on disk; Status
+// tells whether it's ready to be downloaded yet, or whether it expired and
+// its archive was deleted.
+type Export struct {
+	ID      int
+	UserID  int
+	Status  string
+	Created time.Time
+}
+
+type ExportModel struct {
+	DB *sql.DB
+}
+
+func (em *ExportModel) Insert(userID int) (int, error) {
+	stmt := `INSERT INTO exports (user_id, status, created)
+	VALUES(?, ?, UTC_TIMESTAMP())`
+
+	result, err := em.DB.Exec(stmt, userID, ExportPending)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (em *ExportModel) SetStatus(id int, status string) error {
+	stmt := `UPDATE exports SET status = ? WHERE id = ?`
+
+	_, err := em.DB.Exec(stmt, status, id)
+	return err
+}
+
+func (em *ExportModel) Get(id int) (Export, error) {
+	stmt := `SELECT id, user_id, status, created FROM exports WHERE id = ?`
+
+	var e Export
+	err := em.DB.QueryRow(stmt, id).Scan(&e.ID, &e.UserID, &e.Status, &e.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Export{}, ErrNoRecord
+		} else {
+			return Export{}, err
+		}
+	}
+
+	return e, nil
+}
+
+// LatestByUser returns the most recent export requested by the given user.
+func (em *ExportModel) LatestByUser(userID int) (Export, error) {
+	stmt := `SELECT id, user_id, status, created FROM exports
+	WHERE user_id = ? ORDER BY id DESC LIMIT 1`
+
+	var e Export
+	err := em.DB.QueryRow(stmt, userID).Scan(&e.ID, &e.UserID, &e.Status, &e.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Export{}, ErrNoRecord
+		} else {
+			return Export{}, err
+		}
+	}
+
+	return e, nil
+}
+
+// Expire marks the ready exports created before the given time as expired,
+// and returns their IDs so that their archives can be deleted.
+func (em *ExportModel) Expire(before time.Time) ([]int, error) {
+	tx, err := em.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The exports are locked until they're marked as expired, so that
+	// several instances of the application don't expire them twice.
+	stmt := `SELECT id FROM exports WHERE status = ? AND created < ? ORDER BY id FOR UPDATE`
+
+	rows, err := tx.Query(stmt, ExportReady, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+
+	for rows.Next() {
+		var id int
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		_, err = tx.Exec(`UPDATE exports SET status = ? WHERE id = ?`, ExportExpired, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
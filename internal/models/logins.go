@@ -0,0 +1,166 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type LoginFailureModelInterface interface {
+	Begin(email, ip string, since time.Time) (LoginAttempt, error)
+	Delete(id int64) error
+	Locked(emails []string, since time.Time, threshold int) ([]string, error)
+	Clear(email string) error
+	DeleteBefore(before time.Time) (int64, error)
+}
+
+// LoginFailures counts the failed login attempts made on an account or from
+// an IP address, and when the last one was made.
+type LoginFailures struct {
+	Count int
+	Last  time.Time
+}
+
+// LoginAttempt is a login attempt being made, which is recorded as a failure
+// until it succeeds. Account and IP are the other failures made with its
+// email address and from its IP address, including the attempts being made
+// at the same time, which would otherwise all get through before any of
+// them fails.
+type LoginAttempt struct {
+	ID      int64
+	Account LoginFailures
+	IP      LoginFailures
+}
+
+// LoginFailureModel records failed login attempts, to slow down and lock out
+// the ones guessing passwords. Attempts are recorded by the email address
+// they were made with rather than by user, so that unknown addresses are
+// treated like the ones of existing accounts and can't be told apart.
+type LoginFailureModel struct {
+	DB *sql.DB
+}
+
+// normalizeEmail returns an email address the way it's stored, since
+// addresses are matched regardless of case when logging in.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Begin records a login attempt with the given email address, from the
+// given IP address, and counts the other failures made with them since the
+// given time.
+func (lm *LoginFailureModel) Begin(email, ip string, since time.Time) (LoginAttempt, error) {
+	email = normalizeEmail(email)
+
+	stmt := `INSERT INTO login_failures (email, ip, created) VALUES (?, ?, UTC_TIMESTAMP())`
+
+	result, err := lm.DB.Exec(stmt, email, ip)
+	if err != nil {
+		return LoginAttempt{}, err
+	}
+
+	attempt := LoginAttempt{}
+
+	attempt.ID, err = result.LastInsertId()
+	if err != nil {
+		return LoginAttempt{}, err
+	}
+
+	stmt = `SELECT COUNT(*), MAX(created) FROM login_failures WHERE email = ? AND created > ? AND id <> ?`
+
+	attempt.Account, err = lm.count(stmt, email, since, attempt.ID)
+	if err != nil {
+		return LoginAttempt{}, err
+	}
+
+	stmt = `SELECT COUNT(*), MAX(created) FROM login_failures WHERE ip = ? AND created > ? AND id <> ?`
+
+	attempt.IP, err = lm.count(stmt, ip, since, attempt.ID)
+	if err != nil {
+		return LoginAttempt{}, err
+	}
+
+	return attempt, nil
+}
+
+func (lm *LoginFailureModel) count(stmt, key string, since time.Time, id int64) (LoginFailures, error) {
+	var f LoginFailures
+	var last sql.NullTime
+
+	err := lm.DB.QueryRow(stmt, key, since.UTC(), id).Scan(&f.Count, &last)
+	if err != nil {
+		return LoginFailures{}, err
+	}
+	f.Last = last.Time
+
+	return f, nil
+}
+
+// Delete forgets a login attempt, which either succeeded or was refused
+// before the password was checked.
+func (lm *LoginFailureModel) Delete(id int64) error {
+	_, err := lm.DB.Exec(`DELETE FROM login_failures WHERE id = ?`, id)
+	return err
+}
+
+// Locked returns which of the given email addresses had at least threshold
+// failed login attempts since the given time, normalized.
+func (lm *LoginFailureModel) Locked(emails []string, since time.Time, threshold int) ([]string, error) {
+	if len(emails) == 0 {
+		return nil, nil
+	}
+
+	args := []any{since.UTC()}
+	for _, email := range emails {
+		args = append(args, normalizeEmail(email))
+	}
+	args = append(args, threshold)
+
+	stmt := `SELECT email FROM login_failures
+	WHERE created > ? AND email IN (?` + strings.Repeat(", ?", len(emails)-1) + `)
+	GROUP BY email HAVING COUNT(*) >= ?`
+
+	rows, err := lm.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locked []string
+
+	for rows.Next() {
+		var email string
+
+		err := rows.Scan(&email)
+		if err != nil {
+			return nil, err
+		}
+
+		locked = append(locked, email)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return locked, nil
+}
+
+// Clear forgets the failed login attempts with the given email address, once
+// its owner logged in or an admin unlocked their account. The attempts still
+// count for the IP addresses they were made from.
+func (lm *LoginFailureModel) Clear(email string) error {
+	_, err := lm.DB.Exec(`UPDATE login_failures SET email = '' WHERE email = ?`, normalizeEmail(email))
+	return err
+}
+
+// DeleteBefore deletes the failed login attempts made before the given time,
+// which don't count anymore, and returns how many there were.
+func (lm *LoginFailureModel) DeleteBefore(before time.Time) (int64, error) {
+	result, err := lm.DB.Exec(`DELETE FROM login_failures WHERE created < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
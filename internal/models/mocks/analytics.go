@@ -0,0 +1,49 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+type AnalyticsModel struct{}
+
+func (am *AnalyticsModel) Record(hit models.Hit) error {
+	return nil
+}
+
+// Daily returns a few views every other day, so that charts have something
+// to show.
+func (am *AnalyticsModel) Daily(snippetID int, from, to time.Time) ([]models.DailyHitCounts, error) {
+	var days []models.DailyHitCounts
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.AddDate(0, 0, 1) {
+		var counts models.HitCounts
+		if snippetID == mockSnippet.ID && day.Day()%2 == 0 {
+			counts = models.HitCounts{Views: 4, Visitors: 3, Raw: 1}
+		}
+		days = append(days, models.DailyHitCounts{Day: day, HitCounts: counts})
+	}
+	return days, nil
+}
+
+func (am *AnalyticsModel) Totals(snippetID int) (models.HitCounts, error) {
+	if snippetID != mockSnippet.ID {
+		return models.HitCounts{}, nil
+	}
+	return models.HitCounts{Views: 120, Visitors: 87, Raw: 12, Downloads: 5, Embeds: 40}, nil
+}
+
+func (am *AnalyticsModel) TopReferrers(snippetID, limit int) ([]models.Referrer, error) {
+	if snippetID != mockSnippet.ID {
+		return nil, nil
+	}
+	return []models.Referrer{{Host: "news.ycombinator.com", Hits: 30}, {Host: "example.org", Hits: 10}}, nil
+}
+
+func (am *AnalyticsModel) RollUp(before time.Time) error {
+	return nil
+}
+
+func (am *AnalyticsModel) DeleteVisitors(before time.Time) error {
+	return nil
+}
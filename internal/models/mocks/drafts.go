@@ -0,0 +1,55 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+var mockDraft = models.Draft{
+	ID:       1,
+	UserID:   1,
+	Title:    "Draft snippet",
+	Content:  "Unfinished content",
+	Language: "go",
+	Expires:  7,
+	Updated:  time.Now(),
+}
+
+type DraftModel struct{}
+
+func (dm *DraftModel) Save(id, userID int, title, content, language string, expires int) (int, error) {
+	switch id {
+	case 0:
+		return 2, nil
+	case 1:
+		if userID != mockDraft.UserID {
+			return 0, models.ErrNoRecord
+		}
+		return 1, nil
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
+
+func (dm *DraftModel) Get(id int) (models.Draft, error) {
+	switch id {
+	case 1:
+		return mockDraft, nil
+	default:
+		return models.Draft{}, models.ErrNoRecord
+	}
+}
+
+func (dm *DraftModel) ByUser(userID int) ([]models.Draft, error) {
+	switch userID {
+	case 1:
+		return []models.Draft{mockDraft}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (dm *DraftModel) Delete(id, userID int) error {
+	return nil
+}
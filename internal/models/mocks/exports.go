@@ -0,0 +1,46 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+var mockExport = models.Export{
+	ID:      1,
+	UserID:  1,
+	Status:  models.ExportReady,
+	Created: time.Now(),
+}
+
+type ExportModel struct{}
+
+func (em *ExportModel) Insert(userID int) (int, error) {
+	return 2, nil
+}
+
+func (em *ExportModel) SetStatus(id int, status string) error {
+	return nil
+}
+
+func (em *ExportModel) Get(id int) (models.Export, error) {
+	switch id {
+	case 1:
+		return mockExport, nil
+	default:
+		return models.Export{}, models.ErrNoRecord
+	}
+}
+
+func (em *ExportModel) LatestByUser(userID int) (models.Export, error) {
+	switch userID {
+	case 1:
+		return mockExport, nil
+	default:
+		return models.Export{}, models.ErrNoRecord
+	}
+}
+
+func (em *ExportModel) Expire(before time.Time) ([]int, error) {
+	return nil, nil
+}
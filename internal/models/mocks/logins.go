@@ -0,0 +1,29 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+type LoginFailureModel struct{}
+
+func (lm *LoginFailureModel) Begin(email, ip string, since time.Time) (models.LoginAttempt, error) {
+	return models.LoginAttempt{ID: 1}, nil
+}
+
+func (lm *LoginFailureModel) Delete(id int64) error {
+	return nil
+}
+
+func (lm *LoginFailureModel) Locked(emails []string, since time.Time, threshold int) ([]string, error) {
+	return nil, nil
+}
+
+func (lm *LoginFailureModel) Clear(email string) error {
+	return nil
+}
+
+func (lm *LoginFailureModel) DeleteBefore(before time.Time) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,77 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+var mockNotifications = []models.Notification{
+	{
+		ID:             2,
+		UserID:         1,
+		Kind:           models.NotificationExpiring,
+		SnippetID:      mockSnippet.ID,
+		SnippetTitle:   mockSnippet.Title,
+		SnippetExpires: time.Now().Add(12 * time.Hour),
+		Created:        time.Now(),
+	},
+	{
+		ID:             1,
+		UserID:         1,
+		Kind:           models.NotificationExpiring,
+		SnippetID:      mockHiddenSnippet.ID,
+		SnippetTitle:   mockHiddenSnippet.Title,
+		SnippetExpires: time.Now().Add(20 * time.Hour),
+		Read:           true,
+		Created:        time.Now().Add(-time.Hour),
+	},
+}
+
+type NotificationModel struct{}
+
+func (nm *NotificationModel) ByUser(userID, limit int) ([]models.Notification, error) {
+	if userID != 1 {
+		return nil, nil
+	}
+	return mockNotifications, nil
+}
+
+func (nm *NotificationModel) CountUnread(userID int) (int, error) {
+	if userID != 1 {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (nm *NotificationModel) MarkRead(id, userID int) error {
+	return nil
+}
+
+func (nm *NotificationModel) MarkAllRead(userID int) error {
+	return nil
+}
+
+func (nm *NotificationModel) Delete(id, userID int) error {
+	return nil
+}
+
+func (nm *NotificationModel) DeleteAll(userID int) error {
+	return nil
+}
+
+func (nm *NotificationModel) NotifyExpiring(within time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (nm *NotificationModel) NotifyLocked(userID int) error {
+	return nil
+}
+
+func (nm *NotificationModel) DisabledKinds(userID int) ([]string, error) {
+	return nil, nil
+}
+
+func (nm *NotificationModel) SetDisabledKinds(userID int, kinds []string) error {
+	return nil
+}
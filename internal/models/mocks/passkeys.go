@@ -0,0 +1,63 @@
+package mocks
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+// mockPasskey is the passkey of the mock user. Its public key isn't a real
+// one, so it can't be used to log in.
+var mockPasskey = models.Passkey{
+	ID:           1,
+	UserID:       mockUser.ID,
+	Name:         "Laptop",
+	CredentialID: []byte("mock-credential"),
+	PublicKey:    []byte{0xa0},
+	Created:      time.Now(),
+}
+
+type PasskeyModel struct{}
+
+func (pm *PasskeyModel) Insert(userID int, name string, credentialID, publicKey []byte, signCount uint32) (int, error) {
+	if bytes.Equal(credentialID, mockPasskey.CredentialID) {
+		return 0, models.ErrDuplicatePasskey
+	}
+	return 2, nil
+}
+
+func (pm *PasskeyModel) ByUser(userID int) ([]models.Passkey, error) {
+	if userID != mockPasskey.UserID {
+		return nil, nil
+	}
+	return []models.Passkey{mockPasskey}, nil
+}
+
+func (pm *PasskeyModel) GetByCredentialID(credentialID []byte) (models.Passkey, error) {
+	if !bytes.Equal(credentialID, mockPasskey.CredentialID) {
+		return models.Passkey{}, models.ErrNoRecord
+	}
+	return mockPasskey, nil
+}
+
+func (pm *PasskeyModel) Use(id int, signCount uint32) error {
+	if id != mockPasskey.ID {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (pm *PasskeyModel) Delete(id, userID int) error {
+	if id != mockPasskey.ID || userID != mockPasskey.UserID {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (pm *PasskeyModel) DeleteAll(userID int) (int, error) {
+	if userID != mockPasskey.UserID {
+		return 0, nil
+	}
+	return 1, nil
+}
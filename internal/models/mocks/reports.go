@@ -0,0 +1,62 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+var mockReport = models.Report{
+	ID:        1,
+	SnippetID: 1,
+	UserID:    4,
+	Reason:    "spam",
+	Details:   "Posted in every thread",
+	Created:   time.Now(),
+}
+
+var mockDecision = models.Decision{
+	ID:          1,
+	SnippetID:   5,
+	ModeratorID: 4,
+	Action:      models.DecisionHide,
+	Note:        "Contains somebody else's AWS keys",
+	Created:     time.Now(),
+}
+
+type ReportModel struct{}
+
+func (rm *ReportModel) Insert(snippetID, userID int, reason, details string) (int, error) {
+	if snippetID == mockReport.SnippetID && userID == mockReport.UserID {
+		return 0, models.ErrDuplicateReport
+	}
+	return 2, nil
+}
+
+func (rm *ReportModel) Queue() ([]models.ReportedSnippet, error) {
+	return []models.ReportedSnippet{{
+		SnippetID:     mockReport.SnippetID,
+		Title:         mockSnippet.Title,
+		Reports:       1,
+		Reasons:       []string{mockReport.Reason},
+		FirstReported: mockReport.Created,
+	}}, nil
+}
+
+func (rm *ReportModel) BySnippet(snippetID int) ([]models.Report, error) {
+	if snippetID != mockReport.SnippetID {
+		return nil, nil
+	}
+	return []models.Report{mockReport}, nil
+}
+
+func (rm *ReportModel) Decide(snippetID, moderatorID int, action, note string) error {
+	return nil
+}
+
+func (rm *ReportModel) LatestDecision(snippetID int) (models.Decision, error) {
+	if snippetID != mockDecision.SnippetID {
+		return models.Decision{}, models.ErrNoRecord
+	}
+	return mockDecision, nil
+}
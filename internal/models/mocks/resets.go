@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+// validResetToken is the password reset token of the mock user.
+const validResetToken = "valid-reset-token"
+
+type PasswordResetModel struct{}
+
+func (pm *PasswordResetModel) Insert(userID int, token string, expires time.Time) error {
+	return nil
+}
+
+func (pm *PasswordResetModel) UserID(token string) (int, error) {
+	if token != validResetToken {
+		return 0, models.ErrNoRecord
+	}
+	return mockUser.ID, nil
+}
+
+func (pm *PasswordResetModel) Reset(token, password string) (int, error) {
+	if token != validResetToken {
+		return 0, models.ErrNoRecord
+	}
+	return mockUser.ID, nil
+}
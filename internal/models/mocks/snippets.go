@@ -1,34 +1,209 @@
 package mocks
 
 import (
+	"strings"
 	"time"
 
 	"github.com/juliflorezg/lets-go/internal/models"
 )
 
 var mockSnippet = models.Snippet{
-	ID:      1,
-	Title:   "Sample Snippet 1",
-	Content: "Sample content for snippet 1",
-	Created: time.Now(),
-	Expires: time.Now(),
+	ID:        1,
+	UserID:    1,
+	Title:     "Sample Snippet 1",
+	Content:   "Sample content for snippet 1",
+	Language:  "plaintext",
+	Pinned:    true,
+	Created:   time.Now(),
+	PublishAt: time.Now(),
+	Expires:   time.Now(),
+}
+
+var mockScheduledSnippet = models.Snippet{
+	ID:                 3,
+	UserID:             1,
+	Title:              "Scheduled Snippet 3",
+	Content:            "package main\n\nfunc main() {}",
+	DetectedLanguage:   "go",
+	DetectedConfidence: 0.86,
+	Created:            time.Now(),
+	PublishAt:          time.Now().Add(24 * time.Hour),
+	Expires:            time.Now().Add(48 * time.Hour),
+}
+
+var mockHiddenSnippet = models.Snippet{
+	ID:        5,
+	UserID:    1,
+	Title:     "Hidden Snippet 5",
+	Content:   "Sample content for snippet 5",
+	Hidden:    true,
+	Created:   time.Now(),
+	PublishAt: time.Now(),
+	Expires:   time.Now().Add(48 * time.Hour),
+}
+
+var mockEncryptedSnippet = models.Snippet{
+	ID:              8,
+	UserID:          1,
+	Title:           "Encrypted Snippet 8",
+	Content:         "q1/3n8cmnyL1hVJ5tBD2uHfm0B8kmOclTyrvH3HQx6s9yU0z5Ywn8g==",
+	ClientEncrypted: true,
+	Created:         time.Now(),
+	PublishAt:       time.Now(),
+	Expires:         time.Now().Add(48 * time.Hour),
+}
+
+var mockRelatedSnippet = models.Snippet{
+	ID:        9,
+	UserID:    4,
+	Title:     "Related Snippet 9",
+	Content:   "More sample content",
+	Language:  "plaintext",
+	Created:   time.Now(),
+	PublishAt: time.Now(),
+	Expires:   time.Now().Add(48 * time.Hour),
 }
 
 type SnippetModel struct{}
 
-func (sm *SnippetModel) Insert(title, content string, expires int) (int, error) {
+func (sm *SnippetModel) Insert(userID int, title, content, language string, expires int, publishAt time.Time) (int, error) {
 	return 2, nil
 }
 
+func (sm *SnippetModel) InsertEncrypted(userID int, title, ciphertext, language string, expires int, publishAt time.Time) (int, error) {
+	return 2, nil
+}
+
+func (sm *SnippetModel) Update(id, userID int, title, content, language string) error {
+	return nil
+}
+
 func (sm *SnippetModel) Get(id int) (models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 3:
+		return mockScheduledSnippet, nil
+	case 5:
+		return mockHiddenSnippet, nil
+	case 8:
+		return mockEncryptedSnippet, nil
+	case 9:
+		return mockRelatedSnippet, nil
 	default:
 		return models.Snippet{}, models.ErrNoRecord
 	}
 }
 
+func (sm *SnippetModel) FindDuplicate(userID int, content string) (models.Snippet, error) {
+	if userID == mockSnippet.UserID && content == mockSnippet.Content {
+		return mockSnippet, nil
+	}
+	return models.Snippet{}, models.ErrNoRecord
+}
+
 func (sm *SnippetModel) Latest() ([]models.Snippet, error) {
 	return []models.Snippet{mockSnippet, mockSnippet, mockSnippet}, nil
 }
+
+func (sm *SnippetModel) LatestByUser(userID int) ([]models.Snippet, error) {
+	switch userID {
+	case 1:
+		return []models.Snippet{mockSnippet}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (sm *SnippetModel) PublicByUser(userID, offset, limit int) ([]models.Snippet, error) {
+	if userID != mockSnippet.UserID || offset > 0 || limit < 1 {
+		return nil, nil
+	}
+	return []models.Snippet{mockSnippet}, nil
+}
+
+func (sm *SnippetModel) CountPublicByUser(userID int) (int, error) {
+	if userID != mockSnippet.UserID {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (sm *SnippetModel) PinnedByUser(userID int) ([]models.Snippet, error) {
+	if userID != mockSnippet.UserID {
+		return nil, nil
+	}
+	return []models.Snippet{mockSnippet}, nil
+}
+
+func (sm *SnippetModel) SetPinned(id, userID int, pinned bool) error {
+	return nil
+}
+
+func (sm *SnippetModel) ScheduledByUser(userID int) ([]models.Snippet, error) {
+	switch userID {
+	case 1:
+		return []models.Snippet{mockScheduledSnippet}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (sm *SnippetModel) AllByUser(userID int) ([]models.Snippet, error) {
+	switch userID {
+	case 1:
+		return []models.Snippet{mockSnippet, mockScheduledSnippet}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (sm *SnippetModel) CountPublic() (int, error) {
+	return 1, nil
+}
+
+func (sm *SnippetModel) PublicRefs(offset, limit int) ([]models.SnippetRef, error) {
+	if offset > 0 || limit < 1 {
+		return nil, nil
+	}
+	return []models.SnippetRef{{ID: mockSnippet.ID, Updated: mockSnippet.PublishAt}}, nil
+}
+
+func (sm *SnippetModel) Search(query string, limit int) ([]models.Snippet, error) {
+	var snippets []models.Snippet
+	for _, s := range []models.Snippet{mockHiddenSnippet, mockScheduledSnippet, mockSnippet} {
+		if strings.Contains(s.Title, query) || strings.Contains(s.Content, query) {
+			snippets = append(snippets, s)
+		}
+	}
+	return snippets, nil
+}
+
+func (sm *SnippetModel) SetHidden(id int, hidden bool) error {
+	return nil
+}
+
+func (sm *SnippetModel) MostDuplicated(limit int) ([]models.DuplicateGroup, error) {
+	return []models.DuplicateGroup{{
+		Hash:      "0b1c4d2e8f3a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c",
+		Snippets:  3,
+		Users:     2,
+		SnippetID: mockSnippet.ID,
+		Title:     mockSnippet.Title,
+	}}, nil
+}
+
+func (sm *SnippetModel) AllPublic(limit int) ([]models.Snippet, error) {
+	return []models.Snippet{mockSnippet, mockRelatedSnippet}, nil
+}
+
+func (sm *SnippetModel) Related(id, limit int) ([]models.Snippet, error) {
+	if id != mockSnippet.ID || limit < 1 {
+		return nil, nil
+	}
+	return []models.Snippet{mockRelatedSnippet}, nil
+}
+
+func (sm *SnippetModel) SetRelated(related map[int][]int) error {
+	return nil
+}
@@ -0,0 +1,22 @@
+package mocks
+
+import (
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+type StatsModel struct{}
+
+func (sm *StatsModel) Get() (models.Stats, error) {
+	return models.Stats{
+		Users:             4,
+		SuspendedUsers:    1,
+		NewUsers:          4,
+		Snippets:          3,
+		PublicSnippets:    1,
+		HiddenSnippets:    1,
+		NewSnippets:       3,
+		PendingReports:    1,
+		ReportedSnippets:  1,
+		ModerationActions: 1,
+	}, nil
+}
@@ -0,0 +1,42 @@
+package mocks
+
+import "time"
+
+// The mock user with two-factor authentication enabled accepts these codes.
+const (
+	mockTOTPCode     = "123456"
+	mockRecoveryCode = "abcd-efgh-ijkl-mnop"
+)
+
+type TwoFactorModel struct{}
+
+func (tm *TwoFactorModel) Enabled(userID int) (bool, error) {
+	return userID == mockTwoFactorUser.ID, nil
+}
+
+func (tm *TwoFactorModel) Enable(userID int, secret string, step int64, recoveryCodes []string) error {
+	return nil
+}
+
+func (tm *TwoFactorModel) Disable(userID int) error {
+	return nil
+}
+
+func (tm *TwoFactorModel) Validate(userID int, code string, now time.Time) (bool, error) {
+	return userID == mockTwoFactorUser.ID && code == mockTOTPCode, nil
+}
+
+func (tm *TwoFactorModel) UseRecoveryCode(userID int, code string) (bool, error) {
+	return userID == mockTwoFactorUser.ID && code == mockRecoveryCode, nil
+}
+
+func (tm *TwoFactorModel) ReplaceRecoveryCodes(userID int, recoveryCodes []string) error {
+	return nil
+}
+
+func (tm *TwoFactorModel) RecoveryCodesLeft(userID int) (int, error) {
+	if userID != mockTwoFactorUser.ID {
+		return 0, nil
+	}
+	return 9, nil
+}
@@ -1,6 +1,7 @@
 package mocks
 
 import (
+	"strings"
 	"time"
 
 	"github.com/juliflorezg/lets-go/internal/models"
@@ -11,28 +12,92 @@ var mockUser = models.User{
 	Name:           "Alice",
 	Email:          "alice@example.com",
 	HashedPassword: []byte("pa$$word"),
+	Bio:            "Gopher and haiku enthusiast.",
+	Role:           models.RoleUser,
+	Verified:       true,
 	Created:        time.Now(),
 }
 
+var mockModerator = models.User{
+	ID:             4,
+	Name:           "Mo",
+	Email:          "mo@example.com",
+	HashedPassword: []byte("pa$$word"),
+	Role:           models.RoleModerator,
+	Verified:       true,
+	Created:        time.Now(),
+}
+
+var mockAdmin = models.User{
+	ID:             6,
+	Name:           "Ada",
+	Email:          "ada@example.com",
+	HashedPassword: []byte("pa$$word"),
+	Role:           models.RoleAdmin,
+	Verified:       true,
+	Created:        time.Now(),
+}
+
+var mockSuspendedUser = models.User{
+	ID:             7,
+	Name:           "Sam",
+	Email:          "sam@example.com",
+	HashedPassword: []byte("pa$$word"),
+	Role:           models.RoleUser,
+	Suspended:      true,
+	Verified:       true,
+	Created:        time.Now(),
+}
+
+// mockUnverifiedUser hasn't followed the link sent to their email address
+// yet.
+var mockUnverifiedUser = models.User{
+	ID:             8,
+	Name:           "Una",
+	Email:          "una@example.com",
+	HashedPassword: []byte("pa$$word"),
+	Role:           models.RoleUser,
+	Created:        time.Now(),
+}
+
+// mockTwoFactorUser has enabled two-factor authentication (see
+// TwoFactorModel).
+var mockTwoFactorUser = models.User{
+	ID:             10,
+	Name:           "Tess",
+	Email:          "tess@example.com",
+	HashedPassword: []byte("pa$$word"),
+	Role:           models.RoleUser,
+	Verified:       true,
+	Created:        time.Now(),
+}
+
+var mockUsers = []models.User{mockUser, mockModerator, mockAdmin, mockSuspendedUser, mockUnverifiedUser, mockTwoFactorUser}
+
 type UserModel struct{}
 
-func (m *UserModel) Insert(name, email, password string) error {
+func (m *UserModel) Insert(name, email, password string) (int, error) {
 	switch email {
 	case "dupe@example.com":
-		return models.ErrDuplicateEmail
+		return 0, models.ErrDuplicateEmail
 	default:
-		return nil
+		return 9, nil
 	}
 }
 func (m *UserModel) Authenticate(email, password string) (int, error) {
-	if email == "alice@example.com" && password == "pa$$word" {
-		return 1, nil
+	for _, u := range mockUsers {
+		if email == u.Email && password == string(u.HashedPassword) {
+			if u.Suspended {
+				return 0, models.ErrSuspendedUser
+			}
+			return u.ID, nil
+		}
 	}
 	return 0, models.ErrInvalidCredentials
 }
 func (m *UserModel) Exists(id int) (bool, error) {
 	switch id {
-	case 1:
+	case 1, 4, 6, 8, 10:
 		return true, nil
 	default:
 		return false, nil
@@ -40,13 +105,12 @@ func (m *UserModel) Exists(id int) (bool, error) {
 }
 
 func (m *UserModel) Get(id int) (models.User, error) {
-	switch id {
-	case 1:
-		return mockUser, nil
-	default:
-		return models.User{}, nil
+	for _, u := range mockUsers {
+		if id == u.ID {
+			return u, nil
+		}
 	}
-
+	return models.User{}, models.ErrNoRecord
 }
 
 func (um *UserModel) UpdatePassword(id int, currentPassword, newPassword string) error {
@@ -62,3 +126,58 @@ func (um *UserModel) UpdatePassword(id int, currentPassword, newPassword string)
 	}
 
 }
+
+func (um *UserModel) UpdateBio(id int, bio string) error {
+	switch id {
+	case 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (um *UserModel) Search(query string, limit int) ([]models.User, error) {
+	var users []models.User
+	for _, u := range mockUsers {
+		if strings.Contains(u.Name, query) || strings.Contains(u.Email, query) {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (um *UserModel) SetSuspended(id int, suspended bool) error {
+	for _, u := range mockUsers {
+		if id == u.ID {
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (um *UserModel) VerifyEmail(id int, email string) error {
+	for _, u := range mockUsers {
+		if id == u.ID && email == u.Email {
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *UserModel) GetByEmail(email string) (models.User, error) {
+	for _, u := range mockUsers {
+		if email == u.Email {
+			return u, nil
+		}
+	}
+	return models.User{}, models.ErrNoRecord
+}
+
+func (m *UserModel) SessionVersion(id int) (int, error) {
+	for _, u := range mockUsers {
+		if id == u.ID {
+			return 0, nil
+		}
+	}
+	return 0, models.ErrNoRecord
+}
@@ -0,0 +1,78 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/models"
+)
+
+var mockWebhook = models.Webhook{
+	ID:      1,
+	UserID:  1,
+	URL:     "https://hooks.example.com/snippetbox",
+	Secret:  "5f2b8a9c0d1e3f4a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a",
+	Events:  []string{"snippet.created", "snippet.updated"},
+	Created: time.Now(),
+}
+
+type WebhookModel struct{}
+
+func (wm *WebhookModel) Insert(userID int, url, secret string, events []string) (int, error) {
+	return 2, nil
+}
+
+func (wm *WebhookModel) Get(id, userID int) (models.Webhook, error) {
+	if id != mockWebhook.ID || userID != mockWebhook.UserID {
+		return models.Webhook{}, models.ErrNoRecord
+	}
+	return mockWebhook, nil
+}
+
+func (wm *WebhookModel) ByUser(userID int) ([]models.Webhook, error) {
+	if userID != mockWebhook.UserID {
+		return nil, nil
+	}
+	return []models.Webhook{mockWebhook}, nil
+}
+
+func (wm *WebhookModel) Delete(id, userID int) error {
+	if id != mockWebhook.ID || userID != mockWebhook.UserID {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (wm *WebhookModel) Enqueue(userID int, event string, payload []byte) error {
+	return nil
+}
+
+func (wm *WebhookModel) Due(limit int) ([]models.Delivery, error) {
+	return nil, nil
+}
+
+func (wm *WebhookModel) RecordAttempt(deliveryID int, attempt models.DeliveryAttempt, status string, nextAttempt time.Time) error {
+	return nil
+}
+
+func (wm *WebhookModel) Deliveries(webhookID, limit int) ([]models.Delivery, error) {
+	if webhookID != mockWebhook.ID {
+		return nil, nil
+	}
+	return []models.Delivery{{
+		ID:          3,
+		WebhookID:   mockWebhook.ID,
+		Event:       "snippet.created",
+		Status:      models.DeliveryPending,
+		Attempts:    2,
+		NextAttempt: time.Now().Add(time.Minute),
+		Created:     time.Now(),
+		Log: []models.DeliveryAttempt{
+			{ResponseCode: 503, Error: "webhook: unexpected status 503", Created: time.Now()},
+			{ResponseCode: 0, Error: "connection refused", Created: time.Now()},
+		},
+	}}, nil
+}
+
+func (wm *WebhookModel) DeleteDeliveriesBefore(before time.Time) (int, error) {
+	return 0, nil
+}
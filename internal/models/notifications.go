@@ -0,0 +1,257 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// The kinds of notifications users get. Users can't opt out of the ones
+// about the security of their account, which aren't about a snippet either.
+const (
+	NotificationExpiring = "expiring"
+	NotificationLocked   = "locked"
+)
+
+// NotificationKind is a kind of notification users can opt out of. Name is
+// the value stored with the notification and Label describes it in the
+// settings.
+type NotificationKind struct {
+	Name  string
+	Label string
+}
+
+// NotificationKinds lists the kinds of notifications, in the order they
+// should be shown in the settings.
+var NotificationKinds = []NotificationKind{
+	{Name: NotificationExpiring, Label: "One of my snippets is about to expire"},
+}
+
+type NotificationModelInterface interface {
+	ByUser(userID, limit int) ([]Notification, error)
+	CountUnread(userID int) (int, error)
+	MarkRead(id, userID int) error
+	MarkAllRead(userID int) error
+	Delete(id, userID int) error
+	DeleteAll(userID int) error
+	NotifyExpiring(within time.Duration) (int, error)
+	NotifyLocked(userID int) error
+	DisabledKinds(userID int) ([]string, error)
+	SetDisabledKinds(userID int, kinds []string) error
+}
+
+// Notification tells a user about something which happened to one of their
+// snippets. The title and expiry of the snippet are read along with it, and
+// are empty if the snippet doesn't exist anymore.
+type Notification struct {
+	ID             int
+	UserID         int
+	Kind           string
+	SnippetID      int
+	SnippetTitle   string
+	SnippetExpires time.Time
+	Read           bool
+	Created        time.Time
+}
+
+type NotificationModel struct {
+	DB *sql.DB
+}
+
+// ByUser returns up to limit of the notifications of the given user, newest
+// first.
+func (nm *NotificationModel) ByUser(userID, limit int) ([]Notification, error) {
+	stmt := `SELECT n.id, n.user_id, n.kind, n.snippet_id, COALESCE(s.title, ''), s.expires, n.is_read, n.created
+	FROM notifications AS n LEFT JOIN snippets AS s ON s.id = n.snippet_id
+	WHERE n.user_id = ? ORDER BY n.created DESC, n.id DESC LIMIT ?`
+
+	rows, err := nm.DB.Query(stmt, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+
+	for rows.Next() {
+		var n Notification
+		var expires sql.NullTime
+
+		err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.SnippetID, &n.SnippetTitle, &expires, &n.Read, &n.Created)
+		if err != nil {
+			return nil, err
+		}
+		n.SnippetExpires = expires.Time
+
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// CountUnread returns the number of notifications the given user hasn't read
+// yet.
+func (nm *NotificationModel) CountUnread(userID int) (int, error) {
+	var count int
+	err := nm.DB.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND NOT is_read`, userID).Scan(&count)
+
+	return count, err
+}
+
+// MarkRead marks a notification as read, as long as it belongs to the given
+// user.
+func (nm *NotificationModel) MarkRead(id, userID int) error {
+	_, err := nm.DB.Exec(`UPDATE notifications SET is_read = TRUE WHERE id = ? AND user_id = ?`, id, userID)
+	return err
+}
+
+// MarkAllRead marks every notification of the given user as read.
+func (nm *NotificationModel) MarkAllRead(userID int) error {
+	_, err := nm.DB.Exec(`UPDATE notifications SET is_read = TRUE WHERE user_id = ?`, userID)
+	return err
+}
+
+// Delete deletes a notification, as long as it belongs to the given user.
+func (nm *NotificationModel) Delete(id, userID int) error {
+	_, err := nm.DB.Exec(`DELETE FROM notifications WHERE id = ? AND user_id = ?`, id, userID)
+	return err
+}
+
+// DeleteAll deletes every notification of the given user.
+func (nm *NotificationModel) DeleteAll(userID int) error {
+	_, err := nm.DB.Exec(`DELETE FROM notifications WHERE user_id = ?`, userID)
+	return err
+}
+
+// NotifyExpiring notifies the owners of the snippets which expire within the
+// given duration, unless they opted out, and returns the number of
+// notifications added. Each snippet is only notified about once, which is
+// recorded on the snippet itself so that deleting the notification doesn't
+// bring it back, and the ones which never lived longer than the duration
+// (like snippets which expire after a day) aren't notified about at all.
+func (nm *NotificationModel) NotifyExpiring(within time.Duration) (int, error) {
+	tx, err := nm.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The snippets are locked until they're marked as notified, so that
+	// several instances of the application don't notify them twice.
+	stmt := `SELECT s.id, s.user_id FROM snippets AS s
+	WHERE s.expires > UTC_TIMESTAMP() AND s.expires <= DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND)
+	AND s.created < DATE_SUB(s.expires, INTERVAL ? SECOND)
+	AND NOT s.expiry_notified
+	AND NOT EXISTS (SELECT 1 FROM notification_opt_outs AS o WHERE o.user_id = s.user_id AND o.kind = ?)
+	ORDER BY s.id FOR UPDATE`
+
+	seconds := int(within.Seconds())
+
+	rows, err := tx.Query(stmt, seconds, seconds, NotificationExpiring)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type expiring struct {
+		snippetID int
+		userID    int
+	}
+
+	var snippets []expiring
+
+	for rows.Next() {
+		var e expiring
+
+		err := rows.Scan(&e.snippetID, &e.userID)
+		if err != nil {
+			return 0, err
+		}
+
+		snippets = append(snippets, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, e := range snippets {
+		_, err = tx.Exec(`INSERT INTO notifications (user_id, kind, snippet_id, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`,
+			e.userID, NotificationExpiring, e.snippetID)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(`UPDATE snippets SET expiry_notified = TRUE WHERE id = ?`, e.snippetID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(snippets), tx.Commit()
+}
+
+// NotifyLocked notifies the given user that their account was locked after
+// too many failed login attempts.
+func (nm *NotificationModel) NotifyLocked(userID int) error {
+	stmt := `INSERT INTO notifications (user_id, kind, snippet_id, created) VALUES (?, ?, 0, UTC_TIMESTAMP())`
+
+	_, err := nm.DB.Exec(stmt, userID, NotificationLocked)
+	return err
+}
+
+// DisabledKinds returns the kinds of notifications the given user opted out
+// of.
+func (nm *NotificationModel) DisabledKinds(userID int) ([]string, error) {
+	rows, err := nm.DB.Query(`SELECT kind FROM notification_opt_outs WHERE user_id = ? ORDER BY kind`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var kinds []string
+
+	for rows.Next() {
+		var kind string
+
+		err := rows.Scan(&kind)
+		if err != nil {
+			return nil, err
+		}
+
+		kinds = append(kinds, kind)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return kinds, nil
+}
+
+// SetDisabledKinds replaces the kinds of notifications the given user opted
+// out of.
+func (nm *NotificationModel) SetDisabledKinds(userID int, kinds []string) error {
+	tx, err := nm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM notification_opt_outs WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, kind := range kinds {
+		_, err = tx.Exec(`INSERT INTO notification_opt_outs (user_id, kind) VALUES (?, ?)`, userID, kind)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
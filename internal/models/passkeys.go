@@ -0,0 +1,183 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type PasskeyModelInterface interface {
+	Insert(userID int, name string, credentialID, publicKey []byte, signCount uint32) (int, error)
+	ByUser(userID int) ([]Passkey, error)
+	GetByCredentialID(credentialID []byte) (Passkey, error)
+	Use(id int, signCount uint32) error
+	Delete(id, userID int) error
+	DeleteAll(userID int) (int, error)
+}
+
+// Passkey is a WebAuthn credential a user logs in with. PublicKey is the
+// public key of the credential, CBOR encoded as a COSE_Key, and SignCount
+// the last value of its signature counter. LastUsed is zero if it was never
+// used to log in.
+type Passkey struct {
+	ID           int
+	UserID       int
+	Name         string
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    uint32
+	Created      time.Time
+	LastUsed     time.Time
+}
+
+type PasskeyModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a passkey to the given user. ErrDuplicatePasskey is returned
+// if its credential is already registered.
+func (pm *PasskeyModel) Insert(userID int, name string, credentialID, publicKey []byte, signCount uint32) (int, error) {
+	stmt := `INSERT INTO passkeys (user_id, name, credential_id, public_key, sign_count, created)
+	VALUES (?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := pm.DB.Exec(stmt, userID, name, credentialID, publicKey, signCount)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "passkeys_uc_credential_id") {
+				return 0, ErrDuplicatePasskey
+			}
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// ByUser returns the passkeys of the given user, oldest first.
+func (pm *PasskeyModel) ByUser(userID int) ([]Passkey, error) {
+	stmt := `SELECT id, user_id, name, credential_id, public_key, sign_count, created, last_used
+	FROM passkeys WHERE user_id = ? ORDER BY id`
+
+	rows, err := pm.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passkeys []Passkey
+
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return passkeys, nil
+}
+
+// GetByCredentialID returns the passkey with the given credential ID, or
+// ErrNoRecord if there's none.
+func (pm *PasskeyModel) GetByCredentialID(credentialID []byte) (Passkey, error) {
+	stmt := `SELECT id, user_id, name, credential_id, public_key, sign_count, created, last_used
+	FROM passkeys WHERE credential_id = ?`
+
+	p, err := scanPasskey(pm.DB.QueryRow(stmt, credentialID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Passkey{}, ErrNoRecord
+		}
+		return Passkey{}, err
+	}
+
+	return p, nil
+}
+
+// Use records that a passkey was used to log in, with the new value of its
+// signature counter. The counter is only ever raised, so that a signature
+// can't be used twice even if it's checked by two requests at once:
+// ErrNoRecord is returned if it's already at least signCount. Passkeys whose
+// authenticator doesn't have a counter keep it at 0.
+func (pm *PasskeyModel) Use(id int, signCount uint32) error {
+	stmt := `UPDATE passkeys SET sign_count = ?, last_used = UTC_TIMESTAMP()
+	WHERE id = ? AND (sign_count < ? OR ? = 0)`
+
+	result, err := pm.DB.Exec(stmt, signCount, id, signCount, signCount)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Delete removes a passkey of the given user, or returns ErrNoRecord if they
+// don't have it.
+func (pm *PasskeyModel) Delete(id, userID int) error {
+	result, err := pm.DB.Exec(`DELETE FROM passkeys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// DeleteAll removes every passkey of the given user, and returns how many
+// there were.
+func (pm *PasskeyModel) DeleteAll(userID int) (int, error) {
+	result, err := pm.DB.Exec(`DELETE FROM passkeys WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// scanPasskey scans a row of the passkeys table, selected in the order of
+// the Passkey fields.
+func scanPasskey(row interface{ Scan(dest ...any) error }) (Passkey, error) {
+	var p Passkey
+	var lastUsed sql.NullTime
+
+	err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.CredentialID, &p.PublicKey, &p.SignCount, &p.Created, &lastUsed)
+	if err != nil {
+		return Passkey{}, err
+	}
+	p.LastUsed = lastUsed.Time
+
+	return p, nil
+}
@@ -0,0 +1,233 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ReportReason is a reason a snippet can be reported for. Name is the value
+// stored with the report and Label is the human readable version of it.
+type ReportReason struct {
+	Name  string
+	Label string
+}
+
+// ReportReasons lists the reasons a snippet can be reported for, in the order
+// they should be offered to users.
+var ReportReasons = []ReportReason{
+	{Name: "spam", Label: "Spam"},
+	{Name: "malware", Label: "Malware"},
+	{Name: "credentials", Label: "Leaked credentials"},
+	{Name: "harassment", Label: "Harassment"},
+}
+
+// The actions a moderator can take on a reported snippet.
+const (
+	DecisionDismiss = "dismiss"
+	DecisionHide    = "hide"
+	DecisionDelete  = "delete"
+)
+
+type ReportModelInterface interface {
+	Insert(snippetID, userID int, reason, details string) (int, error)
+	Queue() ([]ReportedSnippet, error)
+	BySnippet(snippetID int) ([]Report, error)
+	Decide(snippetID, moderatorID int, action, note string) error
+	LatestDecision(snippetID int) (Decision, error)
+}
+
+// Report is a report of a snippet by a user. A user can only report a given
+// snippet once, until a moderator makes a decision about it.
+type Report struct {
+	ID        int
+	SnippetID int
+	UserID    int
+	Reason    string
+	Details   string
+	Created   time.Time
+}
+
+// ReportedSnippet is an entry of the moderation queue: a snippet with reports
+// no moderator has made a decision about yet. Reasons lists the distinct
+// reasons it was reported for.
+type ReportedSnippet struct {
+	SnippetID     int
+	Title         string
+	Reports       int
+	Reasons       []string
+	FirstReported time.Time
+}
+
+// Decision records what a moderator decided to do about the reports of a
+// snippet, and why.
+type Decision struct {
+	ID          int
+	SnippetID   int
+	ModeratorID int
+	Action      string
+	Note        string
+	Created     time.Time
+}
+
+type ReportModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a report of a snippet. If the user already has a pending report
+// of the same snippet, ErrDuplicateReport is returned.
+func (rm *ReportModel) Insert(snippetID, userID int, reason, details string) (int, error) {
+	// pending_key is only set while the report is pending, so the unique
+	// index on it keeps one pending report per user and snippet while
+	// still letting users report a snippet again once it's been decided
+	// on.
+	stmt := `INSERT INTO reports (snippet_id, user_id, reason, details, pending_key, created)
+	VALUES(?, ?, ?, ?, CONCAT(?, '-', ?), UTC_TIMESTAMP())`
+
+	result, err := rm.DB.Exec(stmt, snippetID, userID, reason, details, snippetID, userID)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "reports_uc_pending_key") {
+				return 0, ErrDuplicateReport
+			}
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Queue returns the snippets with pending reports, the most reported first.
+func (rm *ReportModel) Queue() ([]ReportedSnippet, error) {
+	stmt := `SELECT s.id, s.title, COUNT(*), GROUP_CONCAT(DISTINCT r.reason ORDER BY r.reason), MIN(r.created)
+	FROM reports AS r JOIN snippets AS s ON s.id = r.snippet_id
+	WHERE r.decision_id IS NULL
+	GROUP BY s.id, s.title
+	ORDER BY COUNT(*) DESC, MIN(r.created)`
+
+	rows, err := rm.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queue []ReportedSnippet
+
+	for rows.Next() {
+		var rs ReportedSnippet
+		var reasons string
+
+		err := rows.Scan(&rs.SnippetID, &rs.Title, &rs.Reports, &reasons, &rs.FirstReported)
+		if err != nil {
+			return nil, err
+		}
+		rs.Reasons = strings.Split(reasons, ",")
+
+		queue = append(queue, rs)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+// BySnippet returns the pending reports of a snippet, oldest first.
+func (rm *ReportModel) BySnippet(snippetID int) ([]Report, error) {
+	stmt := `SELECT id, snippet_id, user_id, reason, details, created FROM reports
+	WHERE snippet_id = ? AND decision_id IS NULL ORDER BY id`
+
+	rows, err := rm.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []Report
+
+	for rows.Next() {
+		var r Report
+
+		err := rows.Scan(&r.ID, &r.SnippetID, &r.UserID, &r.Reason, &r.Details, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		reports = append(reports, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// Decide records the decision of a moderator about the pending reports of a
+// snippet, closes those reports, and applies the decision to the snippet:
+// hiding it from everybody but its author, deleting it, or leaving it as it
+// is if the reports are dismissed.
+func (rm *ReportModel) Decide(snippetID, moderatorID int, action, note string) error {
+	tx, err := rm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO moderation_decisions (snippet_id, moderator_id, action, note, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`, snippetID, moderatorID, action, note)
+	if err != nil {
+		return err
+	}
+
+	decisionID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE reports SET decision_id = ?, pending_key = NULL
+	WHERE snippet_id = ? AND decision_id IS NULL`, decisionID, snippetID)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case DecisionHide:
+		_, err = tx.Exec(`UPDATE snippets SET hidden = TRUE WHERE id = ?`, snippetID)
+	case DecisionDelete:
+		_, err = tx.Exec(`DELETE FROM snippets WHERE id = ?`, snippetID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// LatestDecision returns the latest decision made about a snippet.
+func (rm *ReportModel) LatestDecision(snippetID int) (Decision, error) {
+	stmt := `SELECT id, snippet_id, moderator_id, action, note, created FROM moderation_decisions
+	WHERE snippet_id = ? ORDER BY id DESC LIMIT 1`
+
+	var d Decision
+	err := rm.DB.QueryRow(stmt, snippetID).Scan(&d.ID, &d.SnippetID, &d.ModeratorID, &d.Action, &d.Note, &d.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Decision{}, ErrNoRecord
+		} else {
+			return Decision{}, err
+		}
+	}
+
+	return d, nil
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordResetModelInterface interface {
+	Insert(userID int, token string, expires time.Time) error
+	UserID(token string) (int, error)
+	Reset(token, password string) (int, error)
+}
+
+type PasswordResetModel struct {
+	DB *sql.DB
+}
+
+// hashResetToken returns the hash a password reset token is stored as, so
+// that the tokens can't be used by anyone who gets to read the database.
+// They're random enough for a plain SHA-256 to be safe.
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Insert stores a token the given user can reset their password with until
+// it expires.
+func (pm *PasswordResetModel) Insert(userID int, token string, expires time.Time) error {
+	stmt := `INSERT INTO password_resets (user_id, token_hash, expires, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := pm.DB.Exec(stmt, userID, hashResetToken(token), expires.UTC())
+	return err
+}
+
+// UserID returns the ID of the user a token was made for, or ErrNoRecord if
+// there's no such token or it has expired.
+func (pm *PasswordResetModel) UserID(token string) (int, error) {
+	stmt := `SELECT user_id FROM password_resets WHERE token_hash = ? AND expires > UTC_TIMESTAMP()`
+
+	var userID int
+	err := pm.DB.QueryRow(stmt, hashResetToken(token)).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// Reset sets the password of the user a token was made for and returns
+// their ID. Every token of the user is used up, and so are their sessions:
+// their session version is bumped, so that the sessions started before
+// don't count anymore. ErrNoRecord is returned if there's no such token or
+// it has expired.
+func (pm *PasswordResetModel) Reset(token, password string) (int, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := pm.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Lock the token, so that it can't be used twice at once.
+	stmt := `SELECT user_id FROM password_resets WHERE token_hash = ? AND expires > UTC_TIMESTAMP() FOR UPDATE`
+
+	var userID int
+	err = tx.QueryRow(stmt, hashResetToken(token)).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM password_resets WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE users SET hashed_password = ?, session_version = session_version + 1 WHERE id = ?`,
+		string(hashedPassword), userID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
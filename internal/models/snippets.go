@@ -3,37 +3,160 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/juliflorezg/lets-go/internal/detect"
+	"github.com/juliflorezg/lets-go/internal/encryption"
+	"github.com/juliflorezg/lets-go/internal/fingerprint"
 )
 
 type SnippetModelInterface interface {
-	Insert(title, content string, expires int) (int, error)
+	Insert(userID int, title, content, language string, expires int, publishAt time.Time) (int, error)
+	InsertEncrypted(userID int, title, ciphertext, language string, expires int, publishAt time.Time) (int, error)
+	Update(id, userID int, title, content, language string) error
 	Get(id int) (Snippet, error)
+	FindDuplicate(userID int, content string) (Snippet, error)
 	Latest() ([]Snippet, error)
+	LatestByUser(userID int) ([]Snippet, error)
+	PublicByUser(userID, offset, limit int) ([]Snippet, error)
+	CountPublicByUser(userID int) (int, error)
+	PinnedByUser(userID int) ([]Snippet, error)
+	SetPinned(id, userID int, pinned bool) error
+	ScheduledByUser(userID int) ([]Snippet, error)
+	AllByUser(userID int) ([]Snippet, error)
+	CountPublic() (int, error)
+	PublicRefs(offset, limit int) ([]SnippetRef, error)
+	Search(query string, limit int) ([]Snippet, error)
+	SetHidden(id int, hidden bool) error
+	MostDuplicated(limit int) ([]DuplicateGroup, error)
+	AllPublic(limit int) ([]Snippet, error)
+	Related(id, limit int) ([]Snippet, error)
+	SetRelated(related map[int][]int) error
 }
 
 // Define a Snippet type to hold the data for an individual snippet.
 // The fields of the struct correspond to the fields in the MySQL snippets table
+// PublishAt is the time at which the snippet becomes public, which is the
+// same as Created unless its publication was scheduled. When the author
+// didn't choose a Language, DetectedLanguage is the one guessed from the
+// content (if any), with a DetectedConfidence between 0 and 1. Pinned
+// snippets are shown first on the profile page of their author. Hidden
+// snippets were hidden by a moderator, and are only visible to their author.
+// ClientEncrypted snippets were encrypted in the author's browser with a key
+// the server never sees, so their Content is a ciphertext (see
+// InsertEncrypted).
 type Snippet struct {
+	ID                 int
+	UserID             int
+	Title              string
+	Content            string
+	Language           string
+	DetectedLanguage   string
+	DetectedConfidence float64
+	Pinned             bool
+	Hidden             bool
+	ClientEncrypted    bool
+	Created            time.Time
+	PublishAt          time.Time
+	Expires            time.Time
+}
+
+// DisplayLanguage returns the language of the snippet, as chosen by its
+// author or else as detected from its content.
+func (s Snippet) DisplayLanguage() string {
+	if s.Language != "" {
+		return s.Language
+	}
+	return s.DetectedLanguage
+}
+
+// IsScheduled reports whether the snippet is scheduled to be published in the
+// future, and should therefore only be visible to its owner.
+func (s Snippet) IsScheduled() bool {
+	return s.PublishAt.After(time.Now())
+}
+
+// SnippetRef is a lightweight reference to a snippet, used where only its
+// location and modification time are needed (like in the sitemap).
+type SnippetRef struct {
 	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	Updated time.Time
 }
 
+// publicSnippet is the condition a snippet must meet to be listed publicly
+// (on the home page, in feeds, in the sitemap...). Every query which lists
+// snippets to everybody should include it in its WHERE clause.
+const publicSnippet = `publish_at <= UTC_TIMESTAMP() AND expires > UTC_TIMESTAMP() AND NOT hidden`
+
+// SnippetModel stores the content of snippets encrypted with the current key
+// of Keys, along with the ID of that key. If Keys is nil, new contents are
+// stored in plain text, but the contents already encrypted can't be read.
+// Titles, fingerprints and detected languages are never encrypted, so that
+// snippets can still be listed and compared in SQL.
 type SnippetModel struct {
-	DB *sql.DB
+	DB   *sql.DB
+	Keys *encryption.Keyring
 }
 
-func (sm *SnippetModel) Insert(title, content string, expires int) (int, error) {
+// Insert adds a new snippet. If publishAt is the zero time the snippet is
+// published right away, otherwise it stays hidden until then. Either way, the
+// snippet expires the given number of days after it's published.
+func (sm *SnippetModel) Insert(userID int, title, content, language string, expires int, publishAt time.Time) (int, error) {
 
 	// the SQL statement we want to execute on the DB
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP, INTERVAL ? DAY))`
+	stmt := `INSERT INTO snippets (user_id, title, content, key_id, language, detected_language, detected_confidence, content_hash, simhash, created, publish_at, expires)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), COALESCE(?, UTC_TIMESTAMP()), DATE_ADD(COALESCE(?, UTC_TIMESTAMP()), INTERVAL ? DAY))`
+
+	publish := sql.NullTime{Time: publishAt.UTC(), Valid: !publishAt.IsZero()}
+
+	// Store the fingerprints of the content along with it, so that
+	// duplicates can be found without comparing whole contents.
+	hash := fingerprint.Hash(content)
+	simhash := fingerprint.Simhash(content)
+
+	detected := detectLanguage(language, content)
+
+	keyID, stored, err := sm.encrypt(content)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := sm.DB.Exec(stmt, userID, title, stored, keyID, language, detected.Language, detected.Confidence, hash, simhash, publish, publish, expires)
 
-	result, err := sm.DB.Exec(stmt, title, content, expires)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// InsertEncrypted adds a new snippet whose content was encrypted in the
+// author's browser. The ciphertext is stored as it is, without fingerprints
+// or a detected language, and the snippet is left out of everything which
+// reads contents on the server, like finding duplicates or searching.
+// Otherwise it works like Insert.
+func (sm *SnippetModel) InsertEncrypted(userID int, title, ciphertext, language string, expires int, publishAt time.Time) (int, error) {
+	stmt := `INSERT INTO snippets (user_id, title, content, key_id, language, client_encrypted, content_hash, simhash, created, publish_at, expires)
+	VALUES(?, ?, ?, ?, ?, TRUE, ?, 0, UTC_TIMESTAMP(), COALESCE(?, UTC_TIMESTAMP()), DATE_ADD(COALESCE(?, UTC_TIMESTAMP()), INTERVAL ? DAY))`
+
+	publish := sql.NullTime{Time: publishAt.UTC(), Valid: !publishAt.IsZero()}
+
+	// The ciphertext is encrypted again like any other content, so that
+	// rotating keys works the same for every snippet.
+	keyID, stored, err := sm.encrypt(ciphertext)
+	if err != nil {
+		return 0, err
+	}
 
+	// Ciphertexts are random, so their hash never matches another one.
+	result, err := sm.DB.Exec(stmt, userID, title, stored, keyID, language, fingerprint.Hash(ciphertext), publish, publish, expires)
 	if err != nil {
 		return 0, err
 	}
@@ -46,22 +169,73 @@ func (sm *SnippetModel) Insert(title, content string, expires int) (int, error)
 	return int(id), nil
 }
 
+// Update replaces the title, content and language of a snippet, as long as it
+// belongs to the given user. Its fingerprints and detected language are
+// recomputed along with it. Snippets encrypted in the browser can't be
+// updated.
+func (sm *SnippetModel) Update(id, userID int, title, content, language string) error {
+	stmt := `UPDATE snippets SET title = ?, content = ?, key_id = ?, language = ?, detected_language = ?, detected_confidence = ?,
+	content_hash = ?, simhash = ? WHERE id = ? AND user_id = ? AND NOT client_encrypted`
+
+	detected := detectLanguage(language, content)
+
+	keyID, stored, err := sm.encrypt(content)
+	if err != nil {
+		return err
+	}
+
+	_, err = sm.DB.Exec(stmt, title, stored, keyID, language, detected.Language, detected.Confidence,
+		fingerprint.Hash(content), fingerprint.Simhash(content), id, userID)
+	return err
+}
+
+// encrypt returns the value to store in the content column for content,
+// along with the ID of the key it was encrypted with, or an empty ID if
+// there are no keys.
+func (sm *SnippetModel) encrypt(content string) (keyID, stored string, err error) {
+	if sm.Keys == nil {
+		return "", content, nil
+	}
+	return sm.Keys.Encrypt(content)
+}
+
+// decrypt returns the plain text of a content stored by encrypt.
+func (sm *SnippetModel) decrypt(keyID, stored string) (string, error) {
+	if keyID == "" {
+		return stored, nil
+	}
+	if sm.Keys == nil {
+		return "", encryption.ErrUnknownKey
+	}
+	return sm.Keys.Decrypt(keyID, stored)
+}
+
+// detectLanguage guesses the language of a snippet's content, unless its
+// author chose one already.
+func detectLanguage(language, content string) detect.Result {
+	if language != "" {
+		return detect.Result{}
+	}
+	return detect.Language(content)
+}
+
 func (sm *SnippetModel) Get(id int) (Snippet, error) {
 	// return Snippet{}, nil
 
-	stmt := `SELECT id, title, content, created, expires FROM snippets
+	stmt := `SELECT id, user_id, title, content, language, detected_language, detected_confidence, pinned, hidden, client_encrypted, created, publish_at, expires, key_id FROM snippets
 	WHERE expires > UTC_TIMESTAMP() AND id = ?;`
 
 	row := sm.DB.QueryRow(stmt, id)
 
 	var s Snippet
+	var keyID string
 
 	// Here, we use row.Scan() to copy the values from each field in sql.Row to the
 	// corresponding field in the Snippet struct. The arguments
 	// to row.Scan are *pointers* to the place we want to copy the data into,
 	// and the number of arguments must be exactly the same as the number of
 	// columns returned by your statement
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := row.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Language, &s.DetectedLanguage, &s.DetectedConfidence, &s.Pinned, &s.Hidden, &s.ClientEncrypted, &s.Created, &s.PublishAt, &s.Expires, &keyID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Snippet{}, ErrNoRecord
@@ -70,14 +244,98 @@ func (sm *SnippetModel) Get(id int) (Snippet, error) {
 		}
 	}
 
+	s.Content, err = sm.decrypt(keyID, s.Content)
+	if err != nil {
+		return Snippet{}, err
+	}
+
 	return s, nil
 }
 
+// FindDuplicate looks for a non-expired snippet of the given user whose
+// content is identical or nearly identical to the given content. Identical
+// snippets are preferred over nearly identical ones, and recent ones over old
+// ones. If there is none, ErrNoRecord is returned.
+func (sm *SnippetModel) FindDuplicate(userID int, content string) (Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, language, detected_language, detected_confidence, pinned, hidden, client_encrypted, created, publish_at, expires, key_id FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND user_id = ? AND NOT client_encrypted
+	AND (content_hash = ? OR BIT_COUNT(simhash ^ ?) <= ?)
+	ORDER BY content_hash = ? DESC, id DESC LIMIT 1`
+
+	hash := fingerprint.Hash(content)
+
+	var s Snippet
+	var keyID string
+	err := sm.DB.QueryRow(stmt, userID, hash, fingerprint.Simhash(content), fingerprint.NearDuplicateDistance, hash).
+		Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Language, &s.DetectedLanguage, &s.DetectedConfidence, &s.Pinned, &s.Hidden, &s.ClientEncrypted, &s.Created, &s.PublishAt, &s.Expires, &keyID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Snippet{}, ErrNoRecord
+		} else {
+			return Snippet{}, err
+		}
+	}
+
+	s.Content, err = sm.decrypt(keyID, s.Content)
+	if err != nil {
+		return Snippet{}, err
+	}
+
+	return s, nil
+}
+
+// DuplicateGroup describes a content which has been posted several times
+// across the instance. SnippetID is the ID of the first snippet posted with it.
+type DuplicateGroup struct {
+	Hash      string
+	Snippets  int
+	Users     int
+	SnippetID int
+	Title     string
+}
+
+// MostDuplicated returns the contents which have been posted the most times,
+// expired snippets included, up to limit of them.
+func (sm *SnippetModel) MostDuplicated(limit int) ([]DuplicateGroup, error) {
+	stmt := `SELECT d.content_hash, d.snippets, d.users, s.id, s.title
+	FROM (
+		SELECT content_hash, COUNT(*) AS snippets, COUNT(DISTINCT user_id) AS users, MIN(id) AS first_id
+		FROM snippets GROUP BY content_hash HAVING COUNT(*) > 1
+	) AS d
+	JOIN snippets AS s ON s.id = d.first_id
+	ORDER BY d.snippets DESC, d.users DESC LIMIT ?`
+
+	rows, err := sm.DB.Query(stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []DuplicateGroup
+
+	for rows.Next() {
+		var g DuplicateGroup
+
+		err := rows.Scan(&g.Hash, &g.Snippets, &g.Users, &g.SnippetID, &g.Title)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
 func (sm *SnippetModel) Latest() ([]Snippet, error) {
 	// return nil, nil
 
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP ORDER BY id DESC LIMIT 10`
+	stmt := `SELECT id, user_id, title, content, language, detected_language, detected_confidence, pinned, hidden, client_encrypted, created, publish_at, expires, key_id FROM snippets
+	WHERE ` + publicSnippet + ` ORDER BY publish_at DESC, id DESC LIMIT 10`
 
 	rows, err := sm.DB.Query(stmt)
 	if err != nil {
@@ -91,12 +349,335 @@ func (sm *SnippetModel) Latest() ([]Snippet, error) {
 	// trying to close a nil resultset.
 	defer rows.Close()
 
+	return sm.scanSnippets(rows)
+}
+
+// LatestByUser returns the 10 most recently created non-expired snippets
+// which belong to the given user.
+func (sm *SnippetModel) LatestByUser(userID int) ([]Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, language, detected_language, detected_confidence, pinned, hidden, client_encrypted, created, publish_at, expires, key_id FROM snippets
+	WHERE ` + publicSnippet + ` AND user_id = ? ORDER BY publish_at DESC, id DESC LIMIT 10`
+
+	rows, err := sm.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return sm.scanSnippets(rows)
+}
+
+// PublicByUser returns up to limit of the publicly listed snippets of the
+// given user, newest first and skipping the first offset of them.
+func (sm *SnippetModel) PublicByUser(userID, offset, limit int) ([]Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, language, detected_language, detected_confidence, pinned, hidden, client_encrypted, created, publish_at, expires, key_id FROM snippets
+	WHERE ` + publicSnippet + ` AND user_id = ? ORDER BY publish_at DESC, id DESC LIMIT ? OFFSET ?`
+
+	rows, err := sm.DB.Query(stmt, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return sm.scanSnippets(rows)
+}
+
+// CountPublicByUser returns the number of publicly listed snippets of the
+// given user.
+func (sm *SnippetModel) CountPublicByUser(userID int) (int, error) {
+	stmt := `SELECT COUNT(*) FROM snippets WHERE ` + publicSnippet + ` AND user_id = ?`
+
+	var count int
+	err := sm.DB.QueryRow(stmt, userID).Scan(&count)
+
+	return count, err
+}
+
+// PinnedByUser returns the publicly listed snippets the given user pinned,
+// newest first.
+func (sm *SnippetModel) PinnedByUser(userID int) ([]Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, language, detected_language, detected_confidence, pinned, hidden, client_encrypted, created, publish_at, expires, key_id FROM snippets
+	WHERE ` + publicSnippet + ` AND user_id = ? AND pinned ORDER BY publish_at DESC, id DESC`
+
+	rows, err := sm.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return sm.scanSnippets(rows)
+}
+
+// SetPinned pins or unpins a snippet, as long as it belongs to the given
+// user.
+func (sm *SnippetModel) SetPinned(id, userID int, pinned bool) error {
+	stmt := `UPDATE snippets SET pinned = ? WHERE id = ? AND user_id = ?`
+
+	_, err := sm.DB.Exec(stmt, pinned, id, userID)
+	return err
+}
+
+// SetHidden hides the snippet with the given ID from everybody but its owner,
+// or makes it visible again.
+func (sm *SnippetModel) SetHidden(id int, hidden bool) error {
+	stmt := `UPDATE snippets SET hidden = ? WHERE id = ?`
+
+	_, err := sm.DB.Exec(stmt, hidden, id)
+	return err
+}
+
+// Rekey re-encrypts the contents of up to batchSize snippets which aren't
+// encrypted with the current key yet, including the plain text ones and the
+// expired ones. It returns how many snippets it looked at, so that callers can
+// keep calling it until it returns 0.
+func (sm *SnippetModel) Rekey(batchSize int) (int, error) {
+	if sm.Keys == nil {
+		return 0, errors.New("models: no keys to encrypt snippets with")
+	}
+
+	stmt := `SELECT id, content, key_id FROM snippets WHERE key_id <> ? ORDER BY id LIMIT ?`
+
+	rows, err := sm.DB.Query(stmt, sm.Keys.Current(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type storedContent struct {
+		id      int
+		content string
+		keyID   string
+	}
+
+	var contents []storedContent
+
+	for rows.Next() {
+		var c storedContent
+
+		err := rows.Scan(&c.id, &c.content, &c.keyID)
+		if err != nil {
+			return 0, err
+		}
+
+		contents = append(contents, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, c := range contents {
+		content, err := sm.decrypt(c.keyID, c.content)
+		if err != nil {
+			return 0, fmt.Errorf("models: snippet %d: %w", c.id, err)
+		}
+
+		keyID, stored, err := sm.encrypt(content)
+		if err != nil {
+			return 0, err
+		}
+
+		// Only replace the content if it didn't change in the meantime.
+		stmt := `UPDATE snippets SET content = ?, key_id = ? WHERE id = ? AND key_id = ? AND content = ?`
+
+		_, err = sm.DB.Exec(stmt, stored, keyID, c.id, c.keyID, c.content)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(contents), nil
+}
+
+// Search returns the snippets of every user whose title or content contains
+// query, up to limit of them, newest first. Unlike the other listings, it
+// includes the hidden, scheduled and expired snippets.
+//
+// Encrypted contents can't be searched in SQL, so every encrypted snippet is
+// read and decrypted until enough of them match. This is fine for the
+// occasional search of an admin, but shouldn't be used anywhere else. The
+// snippets encrypted in the browser can only be found by their title.
+func (sm *SnippetModel) Search(query string, limit int) ([]Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, language, detected_language, detected_confidence, pinned, hidden, client_encrypted, created, publish_at, expires, key_id FROM snippets
+	WHERE title LIKE ? OR (NOT client_encrypted AND (content LIKE ? OR key_id <> '')) ORDER BY id DESC`
+
+	pattern := containsPattern(query)
+
+	rows, err := sm.DB.Query(stmt, pattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Match the way the default collation compares strings in LIKE.
+	query = strings.ToLower(query)
+
 	var snippets []Snippet
 
+	for rows.Next() && len(snippets) < limit {
+		s, err := sm.scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.Contains(strings.ToLower(s.Title), query) || (!s.ClientEncrypted && strings.Contains(strings.ToLower(s.Content), query)) {
+			snippets = append(snippets, s)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// ScheduledByUser returns the snippets of the given user which are scheduled
+// to be published in the future, soonest first.
+func (sm *SnippetModel) ScheduledByUser(userID int) ([]Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, language, detected_language, detected_confidence, pinned, hidden, client_encrypted, created, publish_at, expires, key_id FROM snippets
+	WHERE publish_at > UTC_TIMESTAMP() AND user_id = ? ORDER BY publish_at`
+
+	rows, err := sm.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return sm.scanSnippets(rows)
+}
+
+// AllByUser returns every snippet which belongs to the given user, including
+// the expired ones, oldest first.
+func (sm *SnippetModel) AllByUser(userID int) ([]Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, language, detected_language, detected_confidence, pinned, hidden, client_encrypted, created, publish_at, expires, key_id FROM snippets
+	WHERE user_id = ? ORDER BY id`
+
+	rows, err := sm.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return sm.scanSnippets(rows)
+}
+
+// CountPublic returns the number of snippets which are listed publicly.
+func (sm *SnippetModel) CountPublic() (int, error) {
+	stmt := `SELECT COUNT(*) FROM snippets WHERE ` + publicSnippet
+
+	var count int
+	err := sm.DB.QueryRow(stmt).Scan(&count)
+
+	return count, err
+}
+
+// PublicRefs returns up to limit references to publicly listed snippets,
+// ordered by ID and skipping the first offset of them.
+func (sm *SnippetModel) PublicRefs(offset, limit int) ([]SnippetRef, error) {
+	stmt := `SELECT id, publish_at FROM snippets
+	WHERE ` + publicSnippet + ` ORDER BY id LIMIT ? OFFSET ?`
+
+	rows, err := sm.DB.Query(stmt, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refs []SnippetRef
+
 	for rows.Next() {
-		var s Snippet
+		var ref SnippetRef
+
+		err := rows.Scan(&ref.ID, &ref.Updated)
+		if err != nil {
+			return nil, err
+		}
+
+		refs = append(refs, ref)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// AllPublic returns up to limit of the newest publicly listed snippets which
+// aren't encrypted in the browser, newest first. It's meant for background
+// jobs which need to read the contents, like the one computing related
+// snippets.
+func (sm *SnippetModel) AllPublic(limit int) ([]Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, language, detected_language, detected_confidence, pinned, hidden, client_encrypted, created, publish_at, expires, key_id FROM snippets
+	WHERE ` + publicSnippet + ` AND NOT client_encrypted ORDER BY id DESC LIMIT ?`
+
+	rows, err := sm.DB.Query(stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return sm.scanSnippets(rows)
+}
+
+// Related returns up to limit of the snippets related to the one with the
+// given ID, most related first, as last saved by SetRelated. The snippets
+// which stopped being public since then are left out.
+func (sm *SnippetModel) Related(id, limit int) ([]Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, language, detected_language, detected_confidence, pinned, hidden, client_encrypted, created, publish_at, expires, key_id
+	FROM related_snippets JOIN snippets ON snippets.id = related_snippets.related_id
+	WHERE related_snippets.snippet_id = ? AND ` + publicSnippet + ` AND NOT client_encrypted
+	ORDER BY related_snippets.position LIMIT ?`
+
+	rows, err := sm.DB.Query(stmt, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return sm.scanSnippets(rows)
+}
+
+// SetRelated replaces the saved related snippets of every snippet with the
+// given ones, which are keyed by snippet ID and ordered from the most related.
+func (sm *SnippetModel) SetRelated(related map[int][]int) error {
+	tx, err := sm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM related_snippets`)
+	if err != nil {
+		return err
+	}
+
+	insert, err := tx.Prepare(`INSERT INTO related_snippets (snippet_id, related_id, position) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	for id, relatedIDs := range related {
+		for position, relatedID := range relatedIDs {
+			_, err = insert.Exec(id, relatedID, position)
+			if err != nil {
+				return err
+			}
+		}
+	}
 
-		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	return tx.Commit()
+}
+
+// scanSnippets copies every row of a snippets resultset into a Snippet. The
+// columns must be selected in the same order as in Latest().
+func (sm *SnippetModel) scanSnippets(rows *sql.Rows) ([]Snippet, error) {
+	var snippets []Snippet
+
+	for rows.Next() {
+		s, err := sm.scanSnippet(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -104,9 +685,28 @@ func (sm *SnippetModel) Latest() ([]Snippet, error) {
 		snippets = append(snippets, s)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
 	return snippets, nil
 }
+
+// scanSnippet copies the current row of a snippets resultset into a Snippet,
+// decrypting its content.
+func (sm *SnippetModel) scanSnippet(rows *sql.Rows) (Snippet, error) {
+	var s Snippet
+	var keyID string
+
+	err := rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Language, &s.DetectedLanguage, &s.DetectedConfidence, &s.Pinned, &s.Hidden, &s.ClientEncrypted, &s.Created, &s.PublishAt, &s.Expires, &keyID)
+	if err != nil {
+		return Snippet{}, err
+	}
+
+	s.Content, err = sm.decrypt(keyID, s.Content)
+	if err != nil {
+		return Snippet{}, err
+	}
+
+	return s, nil
+}
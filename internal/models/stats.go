@@ -0,0 +1,67 @@
+package models
+
+import "database/sql"
+
+type StatsModelInterface interface {
+	Get() (Stats, error)
+}
+
+// Stats are figures about the whole instance, for its administrators.
+// Snippets counts every snippet, including the expired ones, and
+// PublicSnippets only the ones currently listed.
+type Stats struct {
+	Users             int
+	SuspendedUsers    int
+	NewUsers          int
+	Snippets          int
+	PublicSnippets    int
+	HiddenSnippets    int
+	NewSnippets       int
+	PendingReports    int
+	ReportedSnippets  int
+	ModerationActions int
+}
+
+type StatsModel struct {
+	DB *sql.DB
+}
+
+// Get computes the statistics of the instance. New users and snippets are
+// the ones created in the last 7 days.
+func (sm *StatsModel) Get() (Stats, error) {
+	var s Stats
+
+	stmt := `SELECT COUNT(*), COALESCE(SUM(suspended), 0),
+	COALESCE(SUM(created > UTC_TIMESTAMP() - INTERVAL 7 DAY), 0)
+	FROM users`
+
+	err := sm.DB.QueryRow(stmt).Scan(&s.Users, &s.SuspendedUsers, &s.NewUsers)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stmt = `SELECT COUNT(*), COALESCE(SUM(` + publicSnippet + `), 0), COALESCE(SUM(hidden), 0),
+	COALESCE(SUM(created > UTC_TIMESTAMP() - INTERVAL 7 DAY), 0)
+	FROM snippets`
+
+	err = sm.DB.QueryRow(stmt).Scan(&s.Snippets, &s.PublicSnippets, &s.HiddenSnippets, &s.NewSnippets)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stmt = `SELECT COUNT(*), COUNT(DISTINCT snippet_id) FROM reports WHERE decision_id IS NULL`
+
+	err = sm.DB.QueryRow(stmt).Scan(&s.PendingReports, &s.ReportedSnippets)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stmt = `SELECT COUNT(*) FROM moderation_decisions`
+
+	err = sm.DB.QueryRow(stmt).Scan(&s.ModerationActions)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	return s, nil
+}
@@ -1,27 +1,260 @@
 CREATE TABLE snippets (
   id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id INTEGER NOT NULL,
   title VARCHAR(100) NOT NULL,
-  content TEXT NOT NULL,
+  content MEDIUMTEXT NOT NULL,
+  key_id VARCHAR(30) NOT NULL DEFAULT '',
+  language VARCHAR(30) NOT NULL DEFAULT '',
+  detected_language VARCHAR(30) NOT NULL DEFAULT '',
+  detected_confidence DECIMAL(3, 2) NOT NULL DEFAULT 0,
+  pinned BOOLEAN NOT NULL DEFAULT FALSE,
+  hidden BOOLEAN NOT NULL DEFAULT FALSE,
+  client_encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+  expiry_notified BOOLEAN NOT NULL DEFAULT FALSE,
+  content_hash CHAR(64) NOT NULL,
+  simhash BIGINT UNSIGNED NOT NULL,
   created DATETIME NOT NULL,
+  publish_at DATETIME NOT NULL,
   EXPIRES DATETIME NOT NULL
 );
 
 CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_publish_at ON snippets(publish_at);
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
+CREATE INDEX idx_snippets_content_hash ON snippets(content_hash);
 
 CREATE TABLE users (
   id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
   name VARCHAR(255) NOT NULL,
   email VARCHAR(255) NOT NULL, 
   hashed_password CHAR(60) NOT NULL,
+  bio TEXT NOT NULL,
+  role VARCHAR(20) NOT NULL DEFAULT 'user',
+  suspended BOOLEAN NOT NULL DEFAULT FALSE,
+  verified BOOLEAN NOT NULL DEFAULT FALSE,
+  session_version INTEGER NOT NULL DEFAULT 0,
   created DATETIME NOT NULL
 );
 
 ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE(email);
 
-INSERT INTO users (name, email, hashed_password, created)
+CREATE TABLE exports (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id INTEGER NOT NULL,
+  status VARCHAR(20) NOT NULL,
+  created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_exports_user_id ON exports(user_id);
+CREATE INDEX idx_exports_created ON exports(created);
+
+CREATE TABLE drafts (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id INTEGER NOT NULL,
+  title VARCHAR(100) NOT NULL,
+  content MEDIUMTEXT NOT NULL,
+  key_id VARCHAR(30) NOT NULL DEFAULT '',
+  language VARCHAR(30) NOT NULL DEFAULT '',
+  expires INTEGER NOT NULL,
+  updated DATETIME NOT NULL
+);
+
+CREATE INDEX idx_drafts_user_id ON drafts(user_id);
+
+CREATE TABLE reports (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  snippet_id INTEGER NOT NULL,
+  user_id INTEGER NOT NULL,
+  reason VARCHAR(20) NOT NULL,
+  details TEXT NOT NULL,
+  pending_key VARCHAR(30),
+  decision_id INTEGER,
+  created DATETIME NOT NULL
+);
+
+ALTER TABLE reports ADD CONSTRAINT reports_uc_pending_key UNIQUE(pending_key);
+CREATE INDEX idx_reports_snippet_id ON reports(snippet_id);
+
+CREATE TABLE moderation_decisions (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  snippet_id INTEGER NOT NULL,
+  moderator_id INTEGER NOT NULL,
+  action VARCHAR(20) NOT NULL,
+  note TEXT NOT NULL,
+  created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_moderation_decisions_snippet_id ON moderation_decisions(snippet_id);
+
+CREATE TABLE snippet_daily_stats (
+  snippet_id INTEGER NOT NULL,
+  day DATE NOT NULL,
+  views INTEGER NOT NULL DEFAULT 0,
+  visitors INTEGER NOT NULL DEFAULT 0,
+  raw INTEGER NOT NULL DEFAULT 0,
+  downloads INTEGER NOT NULL DEFAULT 0,
+  embeds INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (snippet_id, day)
+);
+
+CREATE TABLE snippet_monthly_stats (
+  snippet_id INTEGER NOT NULL,
+  month DATE NOT NULL,
+  views INTEGER NOT NULL DEFAULT 0,
+  visitors INTEGER NOT NULL DEFAULT 0,
+  raw INTEGER NOT NULL DEFAULT 0,
+  downloads INTEGER NOT NULL DEFAULT 0,
+  embeds INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (snippet_id, month)
+);
+
+CREATE TABLE snippet_referrers (
+  snippet_id INTEGER NOT NULL,
+  day DATE NOT NULL,
+  host VARCHAR(255) NOT NULL,
+  hits INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (snippet_id, day, host)
+);
+
+CREATE TABLE snippet_monthly_referrers (
+  snippet_id INTEGER NOT NULL,
+  month DATE NOT NULL,
+  host VARCHAR(255) NOT NULL,
+  hits INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (snippet_id, month, host)
+);
+
+CREATE TABLE snippet_visitors (
+  snippet_id INTEGER NOT NULL,
+  day DATE NOT NULL,
+  visitor CHAR(64) NOT NULL,
+  PRIMARY KEY (snippet_id, day, visitor)
+);
+
+CREATE TABLE analytics_salts (
+  day DATE NOT NULL PRIMARY KEY,
+  salt CHAR(64) NOT NULL
+);
+
+CREATE TABLE related_snippets (
+  snippet_id INTEGER NOT NULL,
+  related_id INTEGER NOT NULL,
+  position INTEGER NOT NULL,
+  PRIMARY KEY (snippet_id, related_id)
+);
+
+CREATE TABLE notifications (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id INTEGER NOT NULL,
+  kind VARCHAR(20) NOT NULL,
+  snippet_id INTEGER NOT NULL,
+  is_read BOOLEAN NOT NULL DEFAULT FALSE,
+  created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_notifications_user_id ON notifications(user_id, created);
+CREATE INDEX idx_notifications_snippet_id ON notifications(snippet_id);
+
+CREATE TABLE notification_opt_outs (
+  user_id INTEGER NOT NULL,
+  kind VARCHAR(20) NOT NULL,
+  PRIMARY KEY (user_id, kind)
+);
+
+CREATE TABLE webhooks (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id INTEGER NOT NULL,
+  url VARCHAR(2000) NOT NULL,
+  secret CHAR(64) NOT NULL,
+  events VARCHAR(255) NOT NULL,
+  created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_webhooks_user_id ON webhooks(user_id);
+
+CREATE TABLE webhook_deliveries (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  webhook_id INTEGER NOT NULL,
+  event VARCHAR(50) NOT NULL,
+  payload MEDIUMBLOB NOT NULL,
+  key_id VARCHAR(30) NOT NULL DEFAULT '',
+  status VARCHAR(20) NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt DATETIME NOT NULL,
+  created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id);
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt);
+CREATE INDEX idx_webhook_deliveries_created ON webhook_deliveries(created);
+
+CREATE TABLE webhook_attempts (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  delivery_id INTEGER NOT NULL,
+  response_code INTEGER NOT NULL,
+  error VARCHAR(500) NOT NULL,
+  created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_webhook_attempts_delivery_id ON webhook_attempts(delivery_id);
+
+CREATE TABLE password_resets (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id INTEGER NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  expires DATETIME NOT NULL,
+  created DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_password_resets_token_hash ON password_resets(token_hash);
+CREATE INDEX idx_password_resets_user_id ON password_resets(user_id);
+
+CREATE TABLE two_factor (
+  user_id INTEGER NOT NULL PRIMARY KEY,
+  secret VARCHAR(255) NOT NULL,
+  key_id VARCHAR(30) NOT NULL DEFAULT '',
+  last_step BIGINT NOT NULL,
+  created DATETIME NOT NULL
+);
+
+CREATE TABLE recovery_codes (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id INTEGER NOT NULL,
+  code_hash CHAR(64) NOT NULL
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes(user_id, code_hash);
+
+CREATE TABLE passkeys (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  user_id INTEGER NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  credential_id VARBINARY(1023) NOT NULL,
+  public_key BLOB NOT NULL,
+  sign_count INTEGER UNSIGNED NOT NULL DEFAULT 0,
+  created DATETIME NOT NULL,
+  last_used DATETIME
+);
+
+ALTER TABLE passkeys ADD CONSTRAINT passkeys_uc_credential_id UNIQUE (credential_id);
+CREATE INDEX idx_passkeys_user_id ON passkeys(user_id);
+
+CREATE TABLE login_failures (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  email VARCHAR(255) NOT NULL,
+  ip VARCHAR(45) NOT NULL,
+  created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_login_failures_email ON login_failures(email, created);
+CREATE INDEX idx_login_failures_ip ON login_failures(ip, created);
+
+INSERT INTO users (name, email, hashed_password, bio, verified, created)
   VALUES (
     'Alice Jones',
     'alice@example.com',
     '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG',
+    '',
+    TRUE,
     '2024-02-20 12:45:32'
-  )
\ No newline at end of file
+  );
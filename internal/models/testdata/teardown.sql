@@ -1,2 +1,23 @@
+DROP TABLE login_failures;
+DROP TABLE passkeys;
+DROP TABLE recovery_codes;
+DROP TABLE two_factor;
+DROP TABLE password_resets;
+DROP TABLE webhook_attempts;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
+DROP TABLE notification_opt_outs;
+DROP TABLE notifications;
+DROP TABLE related_snippets;
+DROP TABLE analytics_salts;
+DROP TABLE snippet_visitors;
+DROP TABLE snippet_monthly_referrers;
+DROP TABLE snippet_referrers;
+DROP TABLE snippet_monthly_stats;
+DROP TABLE snippet_daily_stats;
+DROP TABLE moderation_decisions;
+DROP TABLE reports;
+DROP TABLE drafts;
+DROP TABLE exports;
 DROP TABLE users;
 DROP TABLE snippets;
\ No newline at end of file
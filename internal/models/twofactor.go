@@ -0,0 +1,296 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/encryption"
+	"github.com/juliflorezg/lets-go/internal/totp"
+)
+
+type TwoFactorModelInterface interface {
+	Enabled(userID int) (bool, error)
+	Enable(userID int, secret string, step int64, recoveryCodes []string) error
+	Disable(userID int) error
+	Validate(userID int, code string, now time.Time) (bool, error)
+	UseRecoveryCode(userID int, code string) (bool, error)
+	ReplaceRecoveryCodes(userID int, recoveryCodes []string) error
+	RecoveryCodesLeft(userID int) (int, error)
+}
+
+// TwoFactorModel stores the TOTP secrets of the users who enabled two-factor
+// authentication, encrypted with the current key of Keys like the contents
+// of snippets (see SnippetModel), along with their recovery codes. Recovery
+// codes are random enough to be stored as plain SHA-256 hashes.
+type TwoFactorModel struct {
+	DB   *sql.DB
+	Keys *encryption.Keyring
+}
+
+// normalizeRecoveryCode returns a recovery code the way it's hashed, so that
+// it can be typed in any case and with or without its dashes.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Enabled reports whether the given user enabled two-factor authentication.
+func (tm *TwoFactorModel) Enabled(userID int) (bool, error) {
+	var enabled bool
+	err := tm.DB.QueryRow(`SELECT EXISTS(SELECT true FROM two_factor WHERE user_id = ?)`, userID).Scan(&enabled)
+
+	return enabled, err
+}
+
+// Enable turns on two-factor authentication for the given user, with the
+// secret they confirmed a code of. step is the time step of that code, so
+// that it can't be used to log in. Any previous secret and recovery codes
+// are replaced.
+func (tm *TwoFactorModel) Enable(userID int, secret string, step int64, recoveryCodes []string) error {
+	keyID, stored, err := tm.encrypt(secret)
+	if err != nil {
+		return err
+	}
+
+	tx, err := tm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM two_factor WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO two_factor (user_id, secret, key_id, last_step, created) VALUES (?, ?, ?, ?, UTC_TIMESTAMP())`,
+		userID, stored, keyID, step)
+	if err != nil {
+		return err
+	}
+
+	err = replaceRecoveryCodes(tx, userID, recoveryCodes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Disable turns off two-factor authentication for the given user, deleting
+// their secret and recovery codes.
+func (tm *TwoFactorModel) Disable(userID int) error {
+	tx, err := tm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM two_factor WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Validate checks a code of the authenticator app of the given user. Each
+// code is only accepted once: the time step of the last code accepted is
+// stored, and the codes of that step and the ones before are refused. The
+// row is locked meanwhile, so that the same code can't be used by two
+// requests at once.
+func (tm *TwoFactorModel) Validate(userID int, code string, now time.Time) (bool, error) {
+	tx, err := tm.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var stored, keyID string
+	var lastStep int64
+
+	err = tx.QueryRow(`SELECT secret, key_id, last_step FROM two_factor WHERE user_id = ? FOR UPDATE`, userID).Scan(&stored, &keyID, &lastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrNoRecord
+		}
+		return false, err
+	}
+
+	secret, err := tm.decrypt(keyID, stored)
+	if err != nil {
+		return false, fmt.Errorf("models: secret of user %d: %w", userID, err)
+	}
+
+	step, ok := totp.Validate(secret, code, now, lastStep)
+	if !ok {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`UPDATE two_factor SET last_step = ? WHERE user_id = ?`, step, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// UseRecoveryCode checks a recovery code of the given user, and deletes it
+// if it's valid so that it can't be used again.
+func (tm *TwoFactorModel) UseRecoveryCode(userID int, code string) (bool, error) {
+	result, err := tm.DB.Exec(`DELETE FROM recovery_codes WHERE user_id = ? AND code_hash = ?`, userID, hashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// ReplaceRecoveryCodes replaces the recovery codes of the given user.
+func (tm *TwoFactorModel) ReplaceRecoveryCodes(userID int, recoveryCodes []string) error {
+	tx, err := tm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(tx, userID, recoveryCodes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecoveryCodesLeft returns the number of recovery codes the given user
+// hasn't used yet.
+func (tm *TwoFactorModel) RecoveryCodesLeft(userID int) (int, error) {
+	var count int
+	err := tm.DB.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?`, userID).Scan(&count)
+
+	return count, err
+}
+
+// Rekey re-encrypts up to batchSize of the secrets which aren't encrypted
+// with the current key yet. Like SnippetModel.Rekey, it returns how many
+// secrets it looked at, so that callers can keep calling it until it
+// returns 0.
+func (tm *TwoFactorModel) Rekey(batchSize int) (int, error) {
+	if tm.Keys == nil {
+		return 0, errNoSecretKeys
+	}
+
+	tx, err := tm.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT user_id, secret, key_id FROM two_factor WHERE key_id <> ? ORDER BY user_id LIMIT ? FOR UPDATE`,
+		tm.Keys.Current(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type storedSecret struct {
+		userID int
+		secret string
+		keyID  string
+	}
+
+	var secrets []storedSecret
+
+	for rows.Next() {
+		var s storedSecret
+
+		err := rows.Scan(&s.userID, &s.secret, &s.keyID)
+		if err != nil {
+			return 0, err
+		}
+
+		secrets = append(secrets, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, s := range secrets {
+		secret, err := tm.decrypt(s.keyID, s.secret)
+		if err != nil {
+			return 0, fmt.Errorf("models: secret of user %d: %w", s.userID, err)
+		}
+
+		keyID, stored, err := tm.encrypt(secret)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(`UPDATE two_factor SET secret = ?, key_id = ? WHERE user_id = ?`, stored, keyID, s.userID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(secrets), tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, recoveryCodes []string) error {
+	_, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hashRecoveryCode(code))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// errNoSecretKeys is returned when a secret is stored without keys to
+// encrypt it with, since unlike snippets secrets are never stored in plain
+// text.
+var errNoSecretKeys = errors.New("models: no keys to encrypt secrets with")
+
+// encrypt and decrypt work like the ones of SnippetModel, except that there
+// must be keys to encrypt secrets with.
+func (tm *TwoFactorModel) encrypt(secret string) (keyID, stored string, err error) {
+	if tm.Keys == nil {
+		return "", "", errNoSecretKeys
+	}
+	return tm.Keys.Encrypt(secret)
+}
+
+func (tm *TwoFactorModel) decrypt(keyID, stored string) (string, error) {
+	if keyID == "" {
+		return stored, nil
+	}
+	if tm.Keys == nil {
+		return "", encryption.ErrUnknownKey
+	}
+	return tm.Keys.Decrypt(keyID, stored)
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
@@ -11,40 +12,73 @@ import (
 )
 
 type UserModelInterface interface {
-	Insert(name, email, password string) error
+	Insert(name, email, password string) (int, error)
 	Authenticate(email, password string) (int, error)
 	Exists(id int) (bool, error)
 	Get(id int) (User, error)
+	GetByEmail(email string) (User, error)
+	SessionVersion(id int) (int, error)
 	UpdatePassword(id int, currentPassword, newPassword string) error
+	UpdateBio(id int, bio string) error
+	Search(query string, limit int) ([]User, error)
+	SetSuspended(id int, suspended bool) error
+	VerifyEmail(id int, email string) error
 }
 
+// The roles a user can have.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Bio is a short text the user writes about themselves, shown on their
+// public profile. Role is one of the Role constants. Suspended users can't
+// log in anymore. Verified is set once the user has followed the link sent to
+// their email address.
 type User struct {
 	ID             int
 	Name           string
 	Email          string
 	HashedPassword []byte
+	Bio            string
+	Role           string
+	Suspended      bool
+	Verified       bool
 	Created        time.Time
 }
 
+// IsModerator reports whether the user can handle reports of snippets.
+// Admins can do everything moderators can.
+func (u User) IsModerator() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
+}
+
+// IsAdmin reports whether the user can access the administration area.
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
 type UserModel struct {
 	DB *sql.DB
 }
 
-// We'll use the Insert method to add a new record to the "users" table.
-func (um *UserModel) Insert(name, email, password string) error {
+// We'll use the Insert method to add a new record to the "users" table. It
+// returns the ID of the new user.
+func (um *UserModel) Insert(name, email, password string) (int, error) {
 	// Create a bcrypt hash of the plain-text password.
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	stmt := `INSERT INTO users (name, email, hashed_password, created) 
-	VALUES(?, ?, ?, UTC_TIMESTAMP())`
+	stmt := `INSERT INTO users (name, email, hashed_password, bio, created) 
+	VALUES(?, ?, ?, '', UTC_TIMESTAMP())`
 
 	// Use the Exec() method to insert the user details and hashed password
 	// into the users table.
-	_, err = um.DB.Exec(stmt, name, email, string(hashedPassword))
+	result, err := um.DB.Exec(stmt, name, email, string(hashedPassword))
 	if err != nil {
 		// If this returns an error, we use the errors.As() function to check
 		// whether the error has the type *mysql.MySQLError. If it does, the
@@ -55,30 +89,51 @@ func (um *UserModel) Insert(name, email, password string) error {
 		var mySQLError *mysql.MySQLError
 		if errors.As(err, &mySQLError) {
 			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
+				return 0, ErrDuplicateEmail
 			}
 		}
-		return err
+		return 0, err
 	}
 
-	return nil
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
 }
 
+// dummyPasswordHash returns the hash unknown users' passwords are compared
+// with. It's made with the same cost as the real ones (see Insert), the
+// first time it's needed.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("not the password of anyone"), 12)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
 // We'll use the Authenticate method to verify whether a user exists with
 // the provided email address and password. This will return the relevant
-// user ID if they do.
+// user ID if they do. If the password is right but the user has been
+// suspended, ErrSuspendedUser is returned.
 func (um *UserModel) Authenticate(email, password string) (int, error) {
 	// return 0, nil
 
-	stmt := `SELECT id, email, hashed_password FROM users WHERE email = ?`
+	stmt := `SELECT id, email, hashed_password, suspended FROM users WHERE email = ?`
 
 	var user User
-	err := um.DB.QueryRow(stmt, email).Scan(&user.ID, &user.Email, &user.HashedPassword)
+	err := um.DB.QueryRow(stmt, email).Scan(&user.ID, &user.Email, &user.HashedPassword, &user.Suspended)
 
 	// err := row.Scan(&user.ID, &user.Email, &user.HashedPassword)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
+			// Compare the password with a hash anyway, so that it takes as
+			// long as for existing users and the time it takes doesn't tell
+			// whether there's an account with this email address.
+			bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
 			return 0, ErrInvalidCredentials
 		} else {
 			return 0, err
@@ -94,6 +149,11 @@ func (um *UserModel) Authenticate(email, password string) (int, error) {
 			return 0, err
 		}
 	}
+
+	if user.Suspended {
+		return 0, ErrSuspendedUser
+	}
+
 	return user.ID, nil
 }
 
@@ -102,7 +162,9 @@ func (um *UserModel) Exists(id int) (bool, error) {
 
 	var exists bool
 
-	stmt := `SELECT EXISTS(SELECT true FROM users WHERE id = ?)`
+	// Suspended users are treated as if they didn't exist, so that they're
+	// logged out of the sessions they already had.
+	stmt := `SELECT EXISTS(SELECT true FROM users WHERE id = ? AND NOT suspended)`
 
 	err := um.DB.QueryRow(stmt, id).Scan(&exists)
 
@@ -110,10 +172,10 @@ func (um *UserModel) Exists(id int) (bool, error) {
 }
 
 func (um *UserModel) Get(id int) (User, error) {
-	stmt := `SELECT id, name, email, created FROM users WHERE id = ?`
+	stmt := `SELECT id, name, email, bio, role, suspended, verified, created FROM users WHERE id = ?`
 
 	var user User
-	err := um.DB.QueryRow(stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.Created)
+	err := um.DB.QueryRow(stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.Bio, &user.Role, &user.Suspended, &user.Verified, &user.Created)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -127,6 +189,38 @@ func (um *UserModel) Get(id int) (User, error) {
 
 }
 
+// GetByEmail returns the user with the given email address.
+func (um *UserModel) GetByEmail(email string) (User, error) {
+	stmt := `SELECT id, name, email, bio, role, suspended, verified, created FROM users WHERE email = ?`
+
+	var user User
+	err := um.DB.QueryRow(stmt, email).Scan(&user.ID, &user.Name, &user.Email, &user.Bio, &user.Role, &user.Suspended, &user.Verified, &user.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNoRecord
+		}
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// SessionVersion returns the session version of the user with the given ID.
+// It's stored in the sessions of the user when they log in, and bumped to
+// end all of them at once (for example when their password is reset).
+func (um *UserModel) SessionVersion(id int) (int, error) {
+	var version int
+	err := um.DB.QueryRow(`SELECT session_version FROM users WHERE id = ?`, id).Scan(&version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return version, nil
+}
+
 func (um *UserModel) UpdatePassword(id int, currentPassword, newPassword string) error {
 	stmt := `SELECT id, hashed_password FROM users WHERE id = ?`
 
@@ -167,3 +261,101 @@ func (um *UserModel) UpdatePassword(id int, currentPassword, newPassword string)
 
 	return nil
 }
+
+func (um *UserModel) UpdateBio(id int, bio string) error {
+	stmt := `UPDATE users SET bio = ? WHERE id = ?`
+
+	_, err := um.DB.Exec(stmt, bio, id)
+	return err
+}
+
+// Search returns the users whose name or email address contains query, up to
+// limit of them, newest first.
+func (um *UserModel) Search(query string, limit int) ([]User, error) {
+	stmt := `SELECT id, name, email, bio, role, suspended, verified, created FROM users
+	WHERE name LIKE ? OR email LIKE ? ORDER BY id DESC LIMIT ?`
+
+	pattern := containsPattern(query)
+
+	rows, err := um.DB.Query(stmt, pattern, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Bio, &user.Role, &user.Suspended, &user.Verified, &user.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// SetSuspended suspends the user with the given ID, or lifts their
+// suspension.
+func (um *UserModel) SetSuspended(id int, suspended bool) error {
+	stmt := `UPDATE users SET suspended = ? WHERE id = ?`
+
+	result, err := um.DB.Exec(stmt, suspended, id)
+	if err != nil {
+		return err
+	}
+
+	// Setting the same value again doesn't count as an affected row, so
+	// check that the user exists when nothing changed.
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		exists := false
+		err := um.DB.QueryRow(`SELECT EXISTS(SELECT true FROM users WHERE id = ?)`, id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNoRecord
+		}
+	}
+
+	return nil
+}
+
+// VerifyEmail marks the email address of the user with the given ID as
+// verified, as long as it's still the given one. Otherwise ErrNoRecord is
+// returned.
+func (um *UserModel) VerifyEmail(id int, email string) error {
+	stmt := `SELECT EXISTS(SELECT true FROM users WHERE id = ? AND email = ?)`
+
+	var exists bool
+	err := um.DB.QueryRow(stmt, id, email).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNoRecord
+	}
+
+	_, err = um.DB.Exec(`UPDATE users SET verified = TRUE WHERE id = ?`, id)
+	return err
+}
+
+// containsPattern returns a LIKE pattern matching the values which contain s,
+// with the wildcards in s escaped.
+func containsPattern(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return "%" + r.Replace(s) + "%"
+}
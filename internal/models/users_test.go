@@ -53,3 +53,32 @@ func TestUserModelExists(t *testing.T) {
 		})
 	}
 }
+
+func TestUserModelAuthenticate(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantID   int
+		wantErr  error
+	}{
+		{name: "Valid credentials", email: "alice@example.com", password: "pa$$word", wantID: 1},
+		{name: "Wrong password", email: "alice@example.com", password: "wrong-password", wantErr: ErrInvalidCredentials},
+		{name: "Unknown email", email: "nobody@example.com", password: "pa$$word", wantErr: ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if testing.Short() {
+				t.Skip("models: skipping integration test")
+			}
+
+			db := newTestDB(t)
+			m := UserModel{DB: db}
+
+			id, err := m.Authenticate(tt.email, tt.password)
+			assert.Equal(t, id, tt.wantID)
+			assert.Equal(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,477 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/encryption"
+)
+
+// The states of a webhook delivery. Pending deliveries are attempted again
+// at their NextAttempt, until they're delivered or failed for good.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// deliveryLease is how long a delivery handed out by Due is kept from being
+// handed out again, so that an instance sending it has time to record the
+// attempt.
+const deliveryLease = time.Minute
+
+type WebhookModelInterface interface {
+	Insert(userID int, url, secret string, events []string) (int, error)
+	Get(id, userID int) (Webhook, error)
+	ByUser(userID int) ([]Webhook, error)
+	Delete(id, userID int) error
+	Enqueue(userID int, event string, payload []byte) error
+	Due(limit int) ([]Delivery, error)
+	RecordAttempt(deliveryID int, attempt DeliveryAttempt, status string, nextAttempt time.Time) error
+	Deliveries(webhookID, limit int) ([]Delivery, error)
+	DeleteDeliveriesBefore(before time.Time) (int, error)
+}
+
+// Webhook is a URL the events of the snippets of a user are posted to.
+// Events are the ones it subscribes to, and Secret is what requests to it are
+// signed with.
+type Webhook struct {
+	ID      int
+	UserID  int
+	URL     string
+	Secret  string
+	Events  []string
+	Created time.Time
+}
+
+// Delivery is an event to post to a webhook. Payload, and the URL and Secret
+// of the webhook, are only set for the deliveries returned by Due. Log holds
+// the attempts made so far, for the deliveries returned by Deliveries.
+type Delivery struct {
+	ID          int
+	WebhookID   int
+	Event       string
+	Payload     []byte
+	Status      string
+	Attempts    int
+	NextAttempt time.Time
+	Created     time.Time
+	URL         string
+	Secret      string
+	Log         []DeliveryAttempt
+}
+
+// DeliveryAttempt is an attempt to post a delivery. ResponseCode is 0 when
+// there was no response, in which case Error tells why.
+type DeliveryAttempt struct {
+	ResponseCode int
+	Error        string
+	Created      time.Time
+}
+
+// WebhookModel stores webhooks and their deliveries. The payloads of the
+// deliveries hold the contents of snippets, so they're encrypted with the
+// current key of Keys like the contents themselves (see SnippetModel).
+type WebhookModel struct {
+	DB   *sql.DB
+	Keys *encryption.Keyring
+}
+
+// Insert adds a webhook to the given user.
+func (wm *WebhookModel) Insert(userID int, url, secret string, events []string) (int, error) {
+	stmt := `INSERT INTO webhooks (user_id, url, secret, events, created) VALUES (?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := wm.DB.Exec(stmt, userID, url, secret, strings.Join(events, ","))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Get returns the webhook with the given ID, as long as it belongs to the
+// given user.
+func (wm *WebhookModel) Get(id, userID int) (Webhook, error) {
+	stmt := `SELECT id, user_id, url, secret, events, created FROM webhooks WHERE id = ? AND user_id = ?`
+
+	var w Webhook
+	var events string
+
+	err := wm.DB.QueryRow(stmt, id, userID).Scan(&w.ID, &w.UserID, &w.URL, &w.Secret, &events, &w.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Webhook{}, ErrNoRecord
+		}
+		return Webhook{}, err
+	}
+	w.Events = strings.Split(events, ",")
+
+	return w, nil
+}
+
+// ByUser returns the webhooks of the given user, oldest first.
+func (wm *WebhookModel) ByUser(userID int) ([]Webhook, error) {
+	stmt := `SELECT id, user_id, url, secret, events, created FROM webhooks WHERE user_id = ? ORDER BY id`
+
+	rows, err := wm.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+
+	for rows.Next() {
+		var w Webhook
+		var events string
+
+		err := rows.Scan(&w.ID, &w.UserID, &w.URL, &w.Secret, &events, &w.Created)
+		if err != nil {
+			return nil, err
+		}
+		w.Events = strings.Split(events, ",")
+
+		webhooks = append(webhooks, w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Delete deletes a webhook along with its deliveries, as long as it belongs
+// to the given user.
+func (wm *WebhookModel) Delete(id, userID int) error {
+	tx, err := wm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM webhooks WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	_, err = tx.Exec(`DELETE webhook_attempts FROM webhook_attempts
+	JOIN webhook_deliveries ON webhook_deliveries.id = webhook_attempts.delivery_id
+	WHERE webhook_deliveries.webhook_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Enqueue adds a delivery of the given event to each webhook of the user
+// which subscribes to it. They're sent as soon as possible.
+func (wm *WebhookModel) Enqueue(userID int, event string, payload []byte) error {
+	keyID, stored, err := wm.encrypt(payload)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO webhook_deliveries (webhook_id, event, payload, key_id, status, attempts, next_attempt, created)
+	SELECT id, ?, ?, ?, ?, 0, UTC_TIMESTAMP(), UTC_TIMESTAMP() FROM webhooks
+	WHERE user_id = ? AND FIND_IN_SET(?, events)`
+
+	_, err = wm.DB.Exec(stmt, event, stored, keyID, DeliveryPending, userID, event)
+	return err
+}
+
+// Due returns up to limit of the pending deliveries whose next attempt is
+// due, oldest first, along with the URL and secret of their webhook. They
+// aren't handed out again for a while, so that several instances of the
+// application don't send the same delivery at once.
+func (wm *WebhookModel) Due(limit int) ([]Delivery, error) {
+	tx, err := wm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `SELECT d.id, d.webhook_id, d.event, d.payload, d.key_id, d.status, d.attempts, d.next_attempt, d.created, w.url, w.secret
+	FROM webhook_deliveries AS d JOIN webhooks AS w ON w.id = d.webhook_id
+	WHERE d.status = ? AND d.next_attempt <= UTC_TIMESTAMP()
+	ORDER BY d.next_attempt, d.id LIMIT ? FOR UPDATE SKIP LOCKED`
+
+	rows, err := tx.Query(stmt, DeliveryPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+
+	for rows.Next() {
+		var d Delivery
+		var stored, keyID string
+
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &stored, &keyID, &d.Status, &d.Attempts, &d.NextAttempt, &d.Created, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, err
+		}
+
+		d.Payload, err = wm.decrypt(keyID, stored)
+		if err != nil {
+			return nil, fmt.Errorf("models: payload of delivery %d: %w", d.ID, err)
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, d := range deliveries {
+		_, err = tx.Exec(`UPDATE webhook_deliveries SET next_attempt = DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND) WHERE id = ?`,
+			int(deliveryLease.Seconds()), d.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordAttempt logs an attempt to send a delivery and moves it to the given
+// status. Pending deliveries are attempted again at nextAttempt.
+func (wm *WebhookModel) RecordAttempt(deliveryID int, attempt DeliveryAttempt, status string, nextAttempt time.Time) error {
+	tx, err := wm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO webhook_attempts (delivery_id, response_code, error, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`,
+		deliveryID, attempt.ResponseCode, attempt.Error)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, next_attempt = ? WHERE id = ?`,
+		status, nextAttempt.UTC(), deliveryID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Deliveries returns up to limit of the latest deliveries of a webhook,
+// newest first, with the log of their attempts.
+func (wm *WebhookModel) Deliveries(webhookID, limit int) ([]Delivery, error) {
+	stmt := `SELECT id, webhook_id, event, status, attempts, next_attempt, created FROM webhook_deliveries
+	WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`
+
+	rows, err := wm.DB.Query(stmt, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	index := make(map[int]int)
+
+	for rows.Next() {
+		var d Delivery
+
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Status, &d.Attempts, &d.NextAttempt, &d.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		index[d.ID] = len(deliveries)
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(deliveries) == 0 {
+		return nil, nil
+	}
+
+	// The attempts of every delivery are read at once. The deliveries are
+	// the latest ones, so their attempts come after the first of them.
+	stmt = `SELECT a.delivery_id, a.response_code, a.error, a.created FROM webhook_attempts AS a
+	JOIN webhook_deliveries AS d ON d.id = a.delivery_id
+	WHERE d.webhook_id = ? AND d.id >= ? ORDER BY a.id`
+
+	attempts, err := wm.DB.Query(stmt, webhookID, deliveries[len(deliveries)-1].ID)
+	if err != nil {
+		return nil, err
+	}
+	defer attempts.Close()
+
+	for attempts.Next() {
+		var deliveryID int
+		var a DeliveryAttempt
+
+		err := attempts.Scan(&deliveryID, &a.ResponseCode, &a.Error, &a.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		i := index[deliveryID]
+		deliveries[i].Log = append(deliveries[i].Log, a)
+	}
+
+	if err := attempts.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// DeleteDeliveriesBefore deletes the deliveries which were delivered or
+// failed for good, along with their attempts, if they were created before
+// the given time, and returns how many there were. Pending deliveries are
+// kept until they're sent.
+func (wm *WebhookModel) DeleteDeliveriesBefore(before time.Time) (int, error) {
+	tx, err := wm.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE webhook_attempts FROM webhook_attempts
+	JOIN webhook_deliveries ON webhook_deliveries.id = webhook_attempts.delivery_id
+	WHERE webhook_deliveries.status IN (?, ?) AND webhook_deliveries.created < ?`,
+		DeliveryDelivered, DeliveryFailed, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`DELETE FROM webhook_deliveries WHERE status IN (?, ?) AND created < ?`,
+		DeliveryDelivered, DeliveryFailed, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), tx.Commit()
+}
+
+// Rekey re-encrypts the payloads of up to batchSize deliveries which aren't
+// encrypted with the current key yet. Like SnippetModel.Rekey, it returns
+// how many deliveries it looked at, so that callers can keep calling it
+// until it returns 0.
+func (wm *WebhookModel) Rekey(batchSize int) (int, error) {
+	if wm.Keys == nil {
+		return 0, errors.New("models: no keys to re-encrypt payloads with")
+	}
+
+	tx, err := wm.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id, payload, key_id FROM webhook_deliveries WHERE key_id <> ? ORDER BY id LIMIT ? FOR UPDATE`,
+		wm.Keys.Current(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type storedPayload struct {
+		id      int
+		payload string
+		keyID   string
+	}
+
+	var payloads []storedPayload
+
+	for rows.Next() {
+		var p storedPayload
+
+		err := rows.Scan(&p.id, &p.payload, &p.keyID)
+		if err != nil {
+			return 0, err
+		}
+
+		payloads = append(payloads, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range payloads {
+		payload, err := wm.decrypt(p.keyID, p.payload)
+		if err != nil {
+			return 0, fmt.Errorf("models: payload of delivery %d: %w", p.id, err)
+		}
+
+		keyID, stored, err := wm.encrypt(payload)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(`UPDATE webhook_deliveries SET payload = ?, key_id = ? WHERE id = ?`, stored, keyID, p.id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(payloads), tx.Commit()
+}
+
+// encrypt and decrypt work like the ones of SnippetModel, for payloads.
+func (wm *WebhookModel) encrypt(payload []byte) (keyID, stored string, err error) {
+	if wm.Keys == nil {
+		return "", string(payload), nil
+	}
+	return wm.Keys.Encrypt(string(payload))
+}
+
+func (wm *WebhookModel) decrypt(keyID, stored string) ([]byte, error) {
+	if keyID == "" {
+		return []byte(stored), nil
+	}
+	if wm.Keys == nil {
+		return nil, encryption.ErrUnknownKey
+	}
+
+	payload, err := wm.Keys.Decrypt(keyID, stored)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(payload), nil
+}
@@ -0,0 +1,102 @@
+// Package pubsub is an in-process hub which delivers events published on a
+// topic to every subscriber of that topic, like the browsers following a
+// snippet through Server-Sent Events.
+package pubsub
+
+import "sync"
+
+// bufferSize is the number of events a subscriber can fall behind by before
+// it's dropped.
+const bufferSize = 16
+
+// Event is a message published on a topic. Name is the kind of event and Data
+// its payload.
+type Event struct {
+	Name string
+	Data []byte
+}
+
+// Hub keeps track of the subscribers of each topic. Its zero value isn't
+// usable, use New instead.
+type Hub struct {
+	mu     sync.Mutex
+	topics map[string]map[*Subscription]struct{}
+}
+
+// New returns an empty hub.
+func New() *Hub {
+	return &Hub{topics: make(map[string]map[*Subscription]struct{})}
+}
+
+// Subscription receives the events published on a topic on C, until it's
+// closed. C is also closed by the hub if the subscriber doesn't keep up with
+// the events, so that a slow client can't hold the publishers back.
+type Subscription struct {
+	C <-chan Event
+
+	c     chan Event
+	hub   *Hub
+	topic string
+	once  sync.Once
+}
+
+// Subscribe starts delivering the events published on the given topic.
+// Subscriptions must be closed once they're not needed anymore.
+func (h *Hub) Subscribe(topic string) *Subscription {
+	c := make(chan Event, bufferSize)
+	s := &Subscription{C: c, c: c, hub: h, topic: topic}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*Subscription]struct{})
+	}
+	h.topics[topic][s] = struct{}{}
+
+	return s
+}
+
+// Close stops the delivery of events and closes C. It can be called more than
+// once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.remove(s)
+}
+
+// remove must be called with the lock of the hub held.
+func (h *Hub) remove(s *Subscription) {
+	s.once.Do(func() {
+		delete(h.topics[s.topic], s)
+		if len(h.topics[s.topic]) == 0 {
+			delete(h.topics, s.topic)
+		}
+		close(s.c)
+	})
+}
+
+// Publish delivers an event to every subscriber of the topic, without
+// waiting for any of them. The subscribers which are too far behind are
+// dropped.
+func (h *Hub) Publish(topic string, e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.topics[topic] {
+		select {
+		case s.c <- e:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// Subscribers returns the number of subscribers of a topic.
+func (h *Hub) Subscribers(topic string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.topics[topic])
+}
@@ -0,0 +1,68 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/juliflorezg/lets-go/internal/assert"
+)
+
+func TestPublish(t *testing.T) {
+	hub := New()
+
+	a := hub.Subscribe("snippet:1")
+	defer a.Close()
+	b := hub.Subscribe("snippet:2")
+	defer b.Close()
+
+	hub.Publish("snippet:1", Event{Name: "update", Data: []byte("hello")})
+
+	select {
+	case e := <-a.C:
+		assert.Equal(t, e.Name, "update")
+		assert.Equal(t, string(e.Data), "hello")
+	default:
+		t.Fatal("the event wasn't delivered")
+	}
+
+	select {
+	case e := <-b.C:
+		t.Fatalf("the event of another topic was delivered: %v", e)
+	default:
+	}
+}
+
+func TestClose(t *testing.T) {
+	hub := New()
+
+	s := hub.Subscribe("latest")
+	assert.Equal(t, hub.Subscribers("latest"), 1)
+
+	s.Close()
+	s.Close()
+	assert.Equal(t, hub.Subscribers("latest"), 0)
+
+	_, ok := <-s.C
+	assert.Equal(t, ok, false)
+
+	// Publishing to a topic without subscribers is fine.
+	hub.Publish("latest", Event{Name: "snippet"})
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	hub := New()
+
+	s := hub.Subscribe("latest")
+	defer s.Close()
+
+	for i := 0; i <= bufferSize; i++ {
+		hub.Publish("latest", Event{Name: "snippet"})
+	}
+
+	assert.Equal(t, hub.Subscribers("latest"), 0)
+
+	received := 0
+	for range s.C {
+		received++
+	}
+	assert.Equal(t, received, bufferSize)
+}
@@ -0,0 +1,248 @@
+// Package related finds the snippets related to each other, by comparing the
+// words of their contents with TF-IDF and favouring the ones written in the
+// same language.
+package related
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// languageWeight is added to the similarity of two documents written in the
+// same language. TF-IDF similarities of related snippets are usually between
+// 0.1 and 0.5, so a shared language decides between otherwise similar
+// candidates, and fills in the list when there are too few of them.
+const languageWeight = 0.1
+
+// maxDocumentFrequency is the share of the documents above which a word is
+// too common (like "the", or "func" among Go snippets) to tell which ones are
+// related. Such words are ignored.
+const maxDocumentFrequency = 0.5
+
+// maxQueryWords is the number of words of a document, the ones which weigh
+// the most in it, which related documents are looked for with.
+const maxQueryWords = 30
+
+// maxPostings is the number of documents above which a word isn't used to
+// look for related documents, however large the share they are. Along with
+// maxQueryWords, it bounds the number of documents each one is compared to.
+const maxPostings = 500
+
+// Document is the text of a snippet to compare to the others, with its
+// language if it has one.
+type Document struct {
+	ID       int
+	Language string
+	Text     string
+}
+
+// Compute returns the IDs of up to limit documents related to each document,
+// most related first, keyed by the ID of the document. Documents which share
+// no rare word nor their language with any other have no entry.
+//
+// Each document is only compared to the ones which share its words, and to
+// the newest ones written in its language, but this is still meant to be run
+// in the background rather than while serving a request.
+func Compute(docs []Document, limit int) map[int][]int {
+	vectors := vectorize(docs)
+
+	// languages lists the documents written in each language, newest first,
+	// for the ones which share no word with a document.
+	languages := make(map[string][]int)
+	for i, doc := range docs {
+		if doc.Language != "" {
+			languages[doc.Language] = append(languages[doc.Language], i)
+		}
+	}
+	for _, group := range languages {
+		sort.Slice(group, func(a, b int) bool {
+			return docs[group[a]].ID > docs[group[b]].ID
+		})
+	}
+
+	// postings lists the documents each word appears in, with its weight in
+	// them, so that only the documents sharing words are compared.
+	postings := make(map[string][]posting)
+	for i, v := range vectors {
+		for word, weight := range v {
+			postings[word] = append(postings[word], posting{doc: i, weight: weight})
+		}
+	}
+
+	related := make(map[int][]int)
+
+	for i, doc := range docs {
+		scores := make(map[int]float64)
+
+		for _, word := range queryWords(vectors[i]) {
+			if len(postings[word]) > maxPostings {
+				continue
+			}
+			for _, p := range postings[word] {
+				if p.doc != i {
+					scores[p.doc] += vectors[i][word] * p.weight
+				}
+			}
+		}
+
+		if doc.Language != "" {
+			for j := range scores {
+				if docs[j].Language == doc.Language {
+					scores[j] += languageWeight
+				}
+			}
+
+			// The documents of the same language which share no word all
+			// score the same, so only the newest of them can be kept.
+			added := 0
+			for _, j := range languages[doc.Language] {
+				if added == limit {
+					break
+				}
+				if _, ok := scores[j]; ok || j == i {
+					continue
+				}
+				scores[j] = languageWeight
+				added++
+			}
+		}
+
+		candidates := make([]candidate, 0, len(scores))
+		for j, score := range scores {
+			candidates = append(candidates, candidate{id: docs[j].ID, score: score})
+		}
+
+		// Newer documents come first among the ones as related.
+		sort.Slice(candidates, func(a, b int) bool {
+			if candidates[a].score != candidates[b].score {
+				return candidates[a].score > candidates[b].score
+			}
+			return candidates[a].id > candidates[b].id
+		})
+
+		for _, c := range candidates[:min(limit, len(candidates))] {
+			related[doc.ID] = append(related[doc.ID], c.id)
+		}
+	}
+
+	return related
+}
+
+type posting struct {
+	doc    int
+	weight float64
+}
+
+type candidate struct {
+	id    int
+	score float64
+}
+
+// queryWords returns the words of a vector which weigh the most, up to
+// maxQueryWords of them.
+func queryWords(vector map[string]float64) []string {
+	words := make([]string, 0, len(vector))
+	for word := range vector {
+		words = append(words, word)
+	}
+
+	sort.Slice(words, func(a, b int) bool {
+		if vector[words[a]] != vector[words[b]] {
+			return vector[words[a]] > vector[words[b]]
+		}
+		return words[a] < words[b]
+	})
+
+	return words[:min(maxQueryWords, len(words))]
+}
+
+// vectorize returns the TF-IDF vector of each document, normalized to a
+// length of 1 so that the similarity of two documents is the dot product of
+// their vectors.
+func vectorize(docs []Document) []map[string]float64 {
+	counts := make([]map[string]int, len(docs))
+	frequencies := make(map[string]int)
+
+	for i, doc := range docs {
+		counts[i] = make(map[string]int)
+		for _, word := range tokenize(doc.Text) {
+			if counts[i][word] == 0 {
+				frequencies[word]++
+			}
+			counts[i][word]++
+		}
+	}
+
+	vectors := make([]map[string]float64, len(docs))
+
+	for i := range docs {
+		vector := make(map[string]float64)
+		var norm float64
+
+		for word, count := range counts[i] {
+			df := frequencies[word]
+			// Words found in a single document can't relate it to another.
+			if df < 2 || float64(df) > maxDocumentFrequency*float64(len(docs)) {
+				continue
+			}
+
+			weight := (1 + math.Log(float64(count))) * math.Log(float64(len(docs))/float64(df))
+			vector[word] = weight
+			norm += weight * weight
+		}
+
+		norm = math.Sqrt(norm)
+		for word := range vector {
+			vector[word] /= norm
+		}
+
+		vectors[i] = vector
+	}
+
+	return vectors
+}
+
+// tokenize splits a text into lower case words of at least two letters,
+// digits or underscores. Identifiers in camel case (like parseLineRange) are
+// split into their words too, and kept whole as well.
+func tokenize(text string) []string {
+	var words []string
+
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_'
+	})
+
+	for _, field := range fields {
+		parts := splitCamelCase(field)
+		if len(parts) > 1 {
+			parts = append(parts, field)
+		}
+
+		for _, part := range parts {
+			if len([]rune(part)) >= 2 {
+				words = append(words, strings.ToLower(part))
+			}
+		}
+	}
+
+	return words
+}
+
+// splitCamelCase splits an identifier before each upper case letter which
+// follows a lower case one.
+func splitCamelCase(s string) []string {
+	var parts []string
+	start := 0
+	runes := []rune(s)
+
+	for i := 1; i < len(runes); i++ {
+		if unicode.IsUpper(runes[i]) && unicode.IsLower(runes[i-1]) {
+			parts = append(parts, string(runes[start:i]))
+			start = i
+		}
+	}
+
+	return append(parts, string(runes[start:]))
+}
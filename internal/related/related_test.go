@@ -0,0 +1,61 @@
+package related
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/juliflorezg/lets-go/internal/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("func parseLineRange(s string) (int, error) { return 0, nil }")
+	want := []string{"func", "parse", "line", "range", "parselinerange", "string", "int", "error", "return", "nil"}
+
+	assert.Equal(t, slices.Equal(got, want), true)
+}
+
+func TestCompute(t *testing.T) {
+	docs := []Document{
+		{ID: 1, Language: "sql", Text: "SELECT id, title FROM snippets WHERE expires > UTC_TIMESTAMP()"},
+		{ID: 2, Language: "go", Text: "rows, err := db.Query(\"SELECT id, title FROM snippets\")"},
+		{ID: 3, Language: "python", Text: "print('hello world')"},
+		{ID: 4, Language: "python", Text: "for name in names: print(name)"},
+		{ID: 5, Language: "shell", Text: "echo hello world"},
+		{ID: 6, Language: "css", Text: "body { color: red; }"},
+	}
+
+	related := Compute(docs, 2)
+
+	tests := []struct {
+		name string
+		id   int
+		want []int
+	}{
+		{name: "Shared words", id: 1, want: []int{2}},
+		{name: "More shared words first", id: 3, want: []int{5, 4}},
+		{name: "Shared language", id: 4, want: []int{3}},
+		{name: "Nothing in common", id: 6, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, slices.Equal(related[tt.id], tt.want), true)
+		})
+	}
+}
+
+func TestComputeSameLanguage(t *testing.T) {
+	// None of the documents share a word, so the newest ones of the same
+	// language are related to each other.
+	var docs []Document
+	for i, word := range []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot"} {
+		docs = append(docs, Document{ID: i + 1, Language: "go", Text: word})
+	}
+	docs = append(docs, Document{ID: 7, Language: "python", Text: "golf"})
+
+	related := Compute(docs, 2)
+
+	assert.Equal(t, slices.Equal(related[1], []int{6, 5}), true)
+	assert.Equal(t, slices.Equal(related[6], []int{5, 4}), true)
+	assert.Equal(t, len(related[7]), 0)
+}
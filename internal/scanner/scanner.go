@@ -0,0 +1,201 @@
+// Package scanner looks for secrets, like API keys or private keys, in the
+// content of snippets before they're published.
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Rule describes a kind of secret. Pattern is matched against the content
+// line by line. If MinEntropy is set, a match only counts when the Shannon
+// entropy (in bits per character) of the secret is at least that high, which
+// tells random-looking keys apart from placeholders like "changeme". The
+// secret is the last capture group of Pattern, or the whole match if it has
+// no groups.
+type Rule struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Pattern     *regexp.Regexp `json:"-"`
+	MinEntropy  float64        `json:"min_entropy,omitempty"`
+}
+
+// Finding is a match of a rule in a content. Rule and Description come from
+// the rule, Line is the 1-based number of the line it was found on, and
+// Excerpt is the matched text with most of the secret masked, so that it can
+// be shown back to the user (or logged) without leaking it again.
+type Finding struct {
+	Rule        string
+	Description string
+	Line        int
+	Excerpt     string
+}
+
+// Scanner scans contents against a set of rules.
+type Scanner struct {
+	rules []Rule
+}
+
+// New returns a Scanner using the given rules.
+func New(rules []Rule) *Scanner {
+	return &Scanner{rules: rules}
+}
+
+// DefaultRules returns the rules used when no rules file is configured.
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Name:        "aws-access-key-id",
+			Description: "AWS access key ID",
+			Pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		},
+		{
+			Name:        "aws-secret-access-key",
+			Description: "AWS secret access key",
+			Pattern:     regexp.MustCompile(`(?i)aws_?secret_?access_?key\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})`),
+			MinEntropy:  4,
+		},
+		{
+			Name:        "private-key",
+			Description: "Private key",
+			Pattern:     regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )?PRIVATE KEY(?: BLOCK)?-----`),
+		},
+		{
+			Name:        "jwt",
+			Description: "JSON Web Token",
+			Pattern:     regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`),
+		},
+		{
+			Name:        "database-url",
+			Description: "Database URL with a password",
+			Pattern:     regexp.MustCompile(`\b(?:postgres(?:ql)?|mysql|mongodb(?:\+srv)?|redis|amqps?)://[^\s:/@]+:([^\s/@]+)@`),
+		},
+		{
+			Name:        "mysql-dsn",
+			Description: "MySQL data source name with a password",
+			Pattern:     regexp.MustCompile(`\b[A-Za-z0-9_.-]+:([^\s:/]+)@(?:tcp\([^)\s]*\))?/[A-Za-z0-9_]+`),
+		},
+		{
+			Name:        "github-token",
+			Description: "GitHub token",
+			Pattern:     regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+		},
+		{
+			Name:        "slack-token",
+			Description: "Slack token",
+			Pattern:     regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+		},
+		{
+			Name:        "generic-secret",
+			Description: "Password, secret or API key assignment",
+			Pattern:     regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret|token|passwd|password)\b["']?\s*[:=]\s*["']?([^\s"']{12,})`),
+			MinEntropy:  3.5,
+		},
+	}
+}
+
+// ruleFile is the format of a rules file, as read by LoadRules.
+type ruleFile struct {
+	Rules []struct {
+		Rule
+		Pattern string `json:"pattern"`
+	} `json:"rules"`
+}
+
+// LoadRules reads rules from a JSON file of the form:
+//
+//	{"rules": [
+//	  {"name": "...", "description": "...", "pattern": "...", "min_entropy": 3.5}
+//	]}
+//
+// The rules of the file replace the default ones entirely.
+func LoadRules(path string) ([]Rule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f ruleFile
+	err = json.Unmarshal(b, &f)
+	if err != nil {
+		return nil, fmt.Errorf("scanner: %s: %w", path, err)
+	}
+
+	rules := make([]Rule, 0, len(f.Rules))
+
+	for _, r := range f.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("scanner: %s: rule without a name", path)
+		}
+
+		r.Rule.Pattern, err = regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("scanner: %s: rule %q: %w", path, r.Name, err)
+		}
+
+		rules = append(rules, r.Rule)
+	}
+
+	return rules, nil
+}
+
+// Scan returns every secret found in content, in the order they appear.
+func (s *Scanner) Scan(content string) []Finding {
+	var findings []Finding
+
+	for i, line := range strings.Split(content, "\n") {
+		for _, rule := range s.rules {
+			for _, match := range rule.Pattern.FindAllStringSubmatch(line, -1) {
+				secret := match[len(match)-1]
+
+				if rule.MinEntropy > 0 && Entropy(secret) < rule.MinEntropy {
+					continue
+				}
+
+				findings = append(findings, Finding{
+					Rule:        rule.Name,
+					Description: rule.Description,
+					Line:        i + 1,
+					Excerpt:     strings.Replace(match[0], secret, mask(secret), 1),
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// Entropy returns the Shannon entropy of s, in bits per character.
+func Entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+
+	var entropy float64
+	for _, c := range counts {
+		p := float64(c) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
+
+// mask hides all but the first 4 characters of a secret.
+func mask(secret string) string {
+	runes := []rune(secret)
+	if len(runes) <= 4 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:4]) + strings.Repeat("*", len(runes)-4)
+}
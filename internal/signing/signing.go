@@ -0,0 +1,131 @@
+// Package signing makes tokens which can be handed out (for example in the
+// links sent by email) and later checked to have been made by the
+// application, without storing them anywhere. A token holds a value, the
+// time it expires and an HMAC-SHA256 of both, keyed with a secret key and
+// the purpose of the token, so that a token made for one purpose can't be
+// used for another.
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeySize is the size of the signing keys, in bytes.
+const KeySize = 32
+
+// EnvVar is the environment variable the signing key is read from, as a hex
+// string.
+const EnvVar = "SNIPPETBOX_SIGNING_KEY"
+
+var (
+	// ErrInvalidToken is returned for tokens which weren't made by the
+	// signer, or for another purpose.
+	ErrInvalidToken = errors.New("signing: invalid token")
+
+	// ErrExpiredToken is returned for valid tokens which have expired.
+	ErrExpiredToken = errors.New("signing: expired token")
+)
+
+var encoding = base64.RawURLEncoding
+
+// Signer makes and checks tokens.
+type Signer struct {
+	key []byte
+}
+
+// New returns a signer using the given key, which must be KeySize bytes
+// long.
+func New(key []byte) (*Signer, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("signing: key must be %d bytes long", KeySize)
+	}
+	return &Signer{key: key}, nil
+}
+
+// Random returns a signer using a random key. Its tokens can't be checked
+// anymore once the application restarts.
+func Random() (*Signer, error) {
+	key := make([]byte, KeySize)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	return New(key)
+}
+
+// FromEnv returns a signer using the key in the EnvVar environment
+// variable, or nil if it isn't set.
+func FromEnv() (*Signer, error) {
+	s := os.Getenv(EnvVar)
+	if s == "" {
+		return nil, nil
+	}
+
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("signing: invalid key in $%s: %w", EnvVar, err)
+	}
+
+	return New(key)
+}
+
+// Sign returns a token holding value for the given purpose, valid until
+// expires. Tokens are URL safe.
+func (s *Signer) Sign(purpose, value string, expires time.Time) string {
+	payload := encoding.EncodeToString([]byte(strconv.FormatInt(expires.Unix(), 10) + "." + value))
+	return payload + "." + encoding.EncodeToString(s.mac(purpose, payload))
+}
+
+// Verify checks a token made for the given purpose and returns the value it
+// holds. ErrExpiredToken is only returned for tokens which are valid
+// otherwise.
+func (s *Signer) Verify(purpose, token string, now time.Time) (string, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+
+	mac, err := encoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(purpose, payload)) {
+		return "", ErrInvalidToken
+	}
+
+	decoded, err := encoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	expires, value, ok := strings.Cut(string(decoded), ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	if !now.Before(time.Unix(unix, 0)) {
+		return "", ErrExpiredToken
+	}
+
+	return value, nil
+}
+
+func (s *Signer) mac(purpose, payload string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
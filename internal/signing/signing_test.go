@@ -0,0 +1,104 @@
+package signing
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/assert"
+)
+
+func TestSignVerify(t *testing.T) {
+	s, err := New(bytes.Repeat([]byte{1}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(bytes.Repeat([]byte{2}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	token := s.Sign("verify-email", "1:alice@example.com", now.Add(time.Hour))
+
+	// The value of another token along with the signature of this one.
+	otherPayload, _, _ := strings.Cut(s.Sign("verify-email", "2:alice@example.com", now.Add(time.Hour)), ".")
+	_, signature, _ := strings.Cut(token, ".")
+
+	tests := []struct {
+		name      string
+		signer    *Signer
+		purpose   string
+		token     string
+		now       time.Time
+		wantValue string
+		wantErr   error
+	}{
+		{
+			name:      "Valid",
+			signer:    s,
+			purpose:   "verify-email",
+			token:     token,
+			now:       now,
+			wantValue: "1:alice@example.com",
+		},
+		{
+			name:    "Expired",
+			signer:  s,
+			purpose: "verify-email",
+			token:   token,
+			now:     now.Add(time.Hour),
+			wantErr: ErrExpiredToken,
+		},
+		{
+			name:    "Other purpose",
+			signer:  s,
+			purpose: "reset-password",
+			token:   token,
+			now:     now,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "Other key",
+			signer:  other,
+			purpose: "verify-email",
+			token:   token,
+			now:     now,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "Tampered value",
+			signer:  s,
+			purpose: "verify-email",
+			token:   otherPayload + "." + signature,
+			now:     now,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "Malformed",
+			signer:  s,
+			purpose: "verify-email",
+			token:   "not-a-token",
+			now:     now,
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.signer.Verify(tt.purpose, tt.token, tt.now)
+
+			assert.Equal(t, value, tt.wantValue)
+			assert.Equal(t, errors.Is(err, tt.wantErr), true)
+		})
+	}
+
+	assert.Equal(t, strings.ContainsAny(token, "+/=@:"), false)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New([]byte("too short"))
+	assert.Equal(t, err != nil, true)
+}
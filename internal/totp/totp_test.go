@@ -0,0 +1,90 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/assert"
+)
+
+// rfcSecret is the SHA-1 secret of the test vectors of RFC 6238,
+// "12345678901234567890", base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// The codes of RFC 6238 have 8 digits, of which these are the last 6.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		assert.NilError(t, err)
+		assert.Equal(t, code, tt.want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "Current step", code: code(step), wantStep: step, wantOK: true},
+		{name: "Previous step", code: code(step - 1), wantStep: step - 1, wantOK: true},
+		{name: "Next step", code: code(step + 1), wantStep: step + 1, wantOK: true},
+		{name: "Too old", code: code(step - 2)},
+		{name: "Spaces", code: code(step)[:3] + " " + code(step)[3:], wantStep: step, wantOK: true},
+		{name: "Already used", code: code(step), lastStep: step},
+		{name: "Later step used", code: code(step - 1), lastStep: step},
+		{name: "Wrong code", code: "000000"},
+		{name: "Too short", code: "12345"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now, tt.lastStep)
+
+			assert.Equal(t, ok, tt.wantOK)
+			assert.Equal(t, step, tt.wantStep)
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	secret, err := NewSecret()
+	assert.NilError(t, err)
+	assert.Equal(t, len(secret), 32)
+
+	_, err = Code(secret, 1)
+	assert.NilError(t, err)
+}
+
+func TestURL(t *testing.T) {
+	u := URL("Snippetbox", "alice@example.com", rfcSecret)
+
+	assert.Equal(t, strings.HasPrefix(u, "otpauth://totp/Snippetbox:alice@example.com?"), true)
+	assert.StringContains(t, u, "secret="+rfcSecret)
+	assert.StringContains(t, u, "issuer=Snippetbox")
+}
@@ -0,0 +1,167 @@
+package webauthn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The subset of CBOR (RFC 8949) authenticators encode their data with:
+// integers, byte and text strings, arrays, maps and the simple values, all
+// with definite lengths. Floats, tags and indefinite lengths aren't
+// supported.
+
+// maxCBORDepth is how deeply arrays and maps can be nested, which is far
+// more than WebAuthn ever needs.
+const maxCBORDepth = 16
+
+var errCBOR = errors.New("webauthn: invalid CBOR")
+
+// decodeCBOR decodes the CBOR item at the start of data, and returns it
+// along with the bytes after it. Integers are returned as int64, byte
+// strings as []byte, text strings as string, arrays as []any and maps as
+// map[any]any, with int64 or string keys.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (any, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, fmt.Errorf("%w: nested too deeply", errCBOR)
+	}
+
+	major, arg, data, err := decodeCBORHead(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer out of range", errCBOR)
+		}
+		return int64(arg), data, nil
+
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer out of range", errCBOR)
+		}
+		return -1 - int64(arg), data, nil
+
+	case 2, 3:
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: truncated string", errCBOR)
+		}
+		b := data[:arg]
+		if major == 3 {
+			return string(b), data[arg:], nil
+		}
+		return append([]byte(nil), b...), data[arg:], nil
+
+	case 4:
+		// Every item takes at least a byte, which bounds the size of
+		// the slice before anything is decoded.
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: truncated array", errCBOR)
+		}
+
+		items := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item any
+			item, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+
+	case 5:
+		if arg > uint64(len(data))/2 {
+			return nil, nil, fmt.Errorf("%w: truncated map", errCBOR)
+		}
+
+		m := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value any
+			key, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key", errCBOR)
+			}
+			if _, ok := m[key]; ok {
+				return nil, nil, fmt.Errorf("%w: duplicate map key", errCBOR)
+			}
+
+			value, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[key] = value
+		}
+		return m, data, nil
+
+	case 7:
+		switch arg {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22:
+			return nil, data, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("%w: unsupported item", errCBOR)
+}
+
+// decodeCBORHead decodes the major type and argument of the item at the
+// start of data.
+func decodeCBORHead(data []byte) (byte, uint64, []byte, error) {
+	if len(data) == 0 {
+		return 0, 0, nil, fmt.Errorf("%w: unexpected end of data", errCBOR)
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	// Floats share their encoding with the simple values, and aren't
+	// supported.
+	if major == 7 && info > 23 {
+		return 0, 0, nil, fmt.Errorf("%w: unsupported item", errCBOR)
+	}
+
+	var size int
+
+	switch {
+	case info < 24:
+		return major, uint64(info), data, nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, nil, fmt.Errorf("%w: indefinite lengths aren't supported", errCBOR)
+	}
+
+	if len(data) < size {
+		return 0, 0, nil, fmt.Errorf("%w: unexpected end of data", errCBOR)
+	}
+
+	var arg uint64
+	for _, b := range data[:size] {
+		arg = arg<<8 | uint64(b)
+	}
+
+	return major, arg, data[size:], nil
+}
@@ -0,0 +1,123 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// The COSE (RFC 9052) algorithms passkeys can use.
+const (
+	AlgES256 = -7
+	AlgRS256 = -257
+)
+
+// The labels and values of the COSE_Key parameters used by ES256 and RS256
+// keys (RFC 9053 and RFC 8230).
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseEC2Crv = -1
+	coseEC2X   = -2
+	coseEC2Y   = -3
+
+	coseCrvP256 = 1
+
+	coseRSAN = -1
+	coseRSAE = -2
+)
+
+// minRSABits is the size of the smallest RSA keys accepted.
+const minRSABits = 2048
+
+// parsePublicKey parses a CBOR encoded COSE_Key, and returns it as an
+// *ecdsa.PublicKey for ES256 or an *rsa.PublicKey for RS256.
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	v, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing data after public key", ErrInvalidResponse)
+	}
+
+	key, ok := v.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: public key isn't a map", ErrInvalidResponse)
+	}
+
+	kty, _ := key[int64(coseKty)].(int64)
+	alg, _ := key[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := key[int64(coseEC2Crv)].(int64)
+		x, _ := key[int64(coseEC2X)].([]byte)
+		y, _ := key[int64(coseEC2Y)].([]byte)
+
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: invalid ES256 key", ErrInvalidResponse)
+		}
+
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("%w: invalid ES256 key", ErrInvalidResponse)
+		}
+		return pub, nil
+
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := key[int64(coseRSAN)].([]byte)
+		e, _ := key[int64(coseRSAE)].([]byte)
+
+		if len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: invalid RS256 key", ErrInvalidResponse)
+		}
+
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if pub.N.BitLen() < minRSABits || pub.E < 3 || pub.E%2 == 0 {
+			return nil, fmt.Errorf("%w: invalid RS256 key", ErrInvalidResponse)
+		}
+		return pub, nil
+	}
+
+	return nil, fmt.Errorf("%w: key type %d with algorithm %d", ErrUnsupportedKey, kty, alg)
+}
+
+// verifySignature checks a signature of the key of a credential over the
+// given data.
+func verifySignature(publicKey []byte, data, signature []byte) error {
+	pub, err := parsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(data)
+
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return ErrInvalidSignature
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) != nil {
+			return ErrInvalidSignature
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,418 @@
+// Package webauthn implements the relying party side of Web Authentication
+// (https://www.w3.org/TR/webauthn-2/), for logging in with passkeys: the
+// registration ceremony, where the browser creates a credential with an
+// authenticator and sends its public key, and the authentication ceremony,
+// where the authenticator signs a challenge with its private key.
+//
+// Only what passkeys need is supported: ES256 and RS256 keys, the "none"
+// attestation format (no attestation is asked for, so the make and model of
+// authenticators aren't checked), and user verification is always required.
+// The options of both ceremonies are built here, and passed as JSON to
+// navigator.credentials.create() and get() by the browser, with their binary
+// fields base64url encoded.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ChallengeSize is the size of the challenges, in bytes.
+const ChallengeSize = 32
+
+// Timeout is how long browsers wait for users to use their authenticator.
+const Timeout = 5 * time.Minute
+
+// maxCredentialIDSize is the size of the largest credential IDs, as set by
+// the specification.
+const maxCredentialIDSize = 1023
+
+// The flags of authenticator data.
+const (
+	flagUserPresent          = 0x01
+	flagUserVerified         = 0x04
+	flagAttestedCredentials  = 0x40
+	flagExtensionsIncluded   = 0x80
+	authenticatorDataMinSize = 37
+)
+
+var (
+	// ErrInvalidResponse is returned for responses which are malformed or
+	// weren't made for the challenge, origin or relying party expected.
+	ErrInvalidResponse = errors.New("webauthn: invalid response")
+
+	// ErrInvalidSignature is returned for assertions whose signature doesn't
+	// match the public key of the credential.
+	ErrInvalidSignature = errors.New("webauthn: invalid signature")
+
+	// ErrUnsupportedKey is returned for credentials with a key of another
+	// algorithm than ES256 and RS256.
+	ErrUnsupportedKey = errors.New("webauthn: unsupported key")
+
+	// ErrClonedAuthenticator is returned for assertions whose signature
+	// counter isn't greater than the one stored, which means the private
+	// key is being used by two authenticators.
+	ErrClonedAuthenticator = errors.New("webauthn: signature counter went backwards")
+)
+
+var encoding = base64.RawURLEncoding
+
+// RelyingParty is the site users log in to. Credentials are bound to its ID,
+// which is the host name of its origin.
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// New returns the relying party for the given origin, such as
+// "https://snippetbox.example.com".
+func New(name, origin string) (*RelyingParty, error) {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Hostname() == "" || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("webauthn: invalid origin %q", origin)
+	}
+
+	return &RelyingParty{
+		ID:     u.Hostname(),
+		Name:   name,
+		Origin: u.Scheme + "://" + u.Host,
+	}, nil
+}
+
+// NewChallenge returns a random challenge, base64url encoded. It should be
+// stored until the response comes back, and only be used once.
+func NewChallenge() (string, error) {
+	b := make([]byte, ChallengeSize)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// User is the account a credential is created for. ID is the user handle,
+// which authenticators return when logging in: it shouldn't hold any
+// personal information.
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// Credential is a registered credential: the public key of an
+// authenticator, CBOR encoded as a COSE_Key, and the last value of its
+// signature counter.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+// CredentialDescriptor identifies a credential in the options of the
+// ceremonies.
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// CredentialParameters is a type of credential the relying party accepts.
+type CredentialParameters struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// CreationOptions are the options of navigator.credentials.create().
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []CredentialParameters `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey        string `json:"residentKey"`
+		RequireResidentKey bool   `json:"requireResidentKey"`
+		UserVerification   string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// RequestOptions are the options of navigator.credentials.get().
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int                    `json:"timeout"`
+	UserVerification string                 `json:"userVerification"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+}
+
+// CreationOptions returns the options to create a credential for the given
+// user. The credentials they already registered are excluded, so that an
+// authenticator isn't registered twice. Passkeys are discoverable
+// credentials, which can be used without entering a user name first.
+func (rp *RelyingParty) CreationOptions(challenge string, user User, exclude [][]byte) CreationOptions {
+	var opts CreationOptions
+
+	opts.Challenge = challenge
+	opts.RP.ID = rp.ID
+	opts.RP.Name = rp.Name
+	opts.User.ID = encoding.EncodeToString(user.ID)
+	opts.User.Name = user.Name
+	opts.User.DisplayName = user.DisplayName
+	opts.Timeout = int(Timeout.Milliseconds())
+	opts.Attestation = "none"
+
+	for _, alg := range []int{AlgES256, AlgRS256} {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, CredentialParameters{Type: "public-key", Alg: alg})
+	}
+
+	opts.ExcludeCredentials = descriptors(exclude)
+
+	opts.AuthenticatorSelection.ResidentKey = "required"
+	opts.AuthenticatorSelection.RequireResidentKey = true
+	opts.AuthenticatorSelection.UserVerification = "required"
+
+	return opts
+}
+
+// RequestOptions returns the options to log in with a credential. With no
+// allowed credentials, users pick one of the passkeys they have for the
+// relying party.
+func (rp *RelyingParty) RequestOptions(challenge string, allow [][]byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          int(Timeout.Milliseconds()),
+		UserVerification: "required",
+		AllowCredentials: descriptors(allow),
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	list := []CredentialDescriptor{}
+	for _, id := range ids {
+		list = append(list, CredentialDescriptor{Type: "public-key", ID: encoding.EncodeToString(id)})
+	}
+	return list
+}
+
+// Attestation is the response of the authenticator to
+// navigator.credentials.create().
+type Attestation struct {
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// Assertion is the response of the authenticator to
+// navigator.credentials.get(). UserHandle is the ID of the user the
+// credential was created for, if the authenticator returned it.
+type Assertion struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
+
+// Register verifies the response to the creation options made with the
+// given challenge, and returns the credential to store.
+func (rp *RelyingParty) Register(challenge string, a Attestation) (Credential, error) {
+	err := rp.checkClientData(a.ClientDataJSON, "webauthn.create", challenge)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	v, rest, err := decodeCBOR(a.AttestationObject)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+
+	object, ok := v.(map[any]any)
+	if !ok || len(rest) != 0 {
+		return Credential{}, fmt.Errorf("%w: invalid attestation object", ErrInvalidResponse)
+	}
+
+	format, _ := object["fmt"].(string)
+	statement, _ := object["attStmt"].(map[any]any)
+	authData, _ := object["authData"].([]byte)
+
+	if format != "none" || statement == nil || len(statement) != 0 {
+		return Credential{}, fmt.Errorf("%w: unsupported attestation format %q", ErrInvalidResponse, format)
+	}
+
+	data, err := rp.parseAuthenticatorData(authData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if data.credentialID == nil {
+		return Credential{}, fmt.Errorf("%w: no attested credential data", ErrInvalidResponse)
+	}
+
+	_, err = parsePublicKey(data.publicKey)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		ID:        data.credentialID,
+		PublicKey: data.publicKey,
+		SignCount: data.signCount,
+	}, nil
+}
+
+// Verify verifies the response to the request options made with the given
+// challenge, for the credential it was made with, and returns the new value
+// of the signature counter of the credential to store.
+func (rp *RelyingParty) Verify(challenge string, cred Credential, a Assertion) (uint32, error) {
+	if !bytes.Equal(a.CredentialID, cred.ID) {
+		return 0, fmt.Errorf("%w: wrong credential", ErrInvalidResponse)
+	}
+
+	err := rp.checkClientData(a.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := rp.parseAuthenticatorData(a.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(a.ClientDataJSON)
+	signed := append(append([]byte(nil), a.AuthenticatorData...), clientDataHash[:]...)
+
+	err = verifySignature(cred.PublicKey, signed, a.Signature)
+	if err != nil {
+		return 0, err
+	}
+
+	// Authenticators which don't have a counter always return 0. The others
+	// increase it with every signature.
+	if (data.signCount != 0 || cred.SignCount != 0) && data.signCount <= cred.SignCount {
+		return 0, ErrClonedAuthenticator
+	}
+
+	return data.signCount, nil
+}
+
+// checkClientData checks the data the browser passed to the authenticator:
+// the type of ceremony, the challenge and the origin of the page.
+func (rp *RelyingParty) checkClientData(clientDataJSON []byte, ceremony, challenge string) error {
+	var clientData struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}
+
+	err := json.Unmarshal(clientDataJSON, &clientData)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+
+	switch {
+	case clientData.Type != ceremony:
+		return fmt.Errorf("%w: type %q", ErrInvalidResponse, clientData.Type)
+	case challenge == "" || subtle.ConstantTimeCompare([]byte(clientData.Challenge), []byte(challenge)) != 1:
+		return fmt.Errorf("%w: wrong challenge", ErrInvalidResponse)
+	case clientData.Origin != rp.Origin:
+		return fmt.Errorf("%w: origin %q", ErrInvalidResponse, clientData.Origin)
+	case clientData.CrossOrigin:
+		return fmt.Errorf("%w: cross-origin request", ErrInvalidResponse)
+	}
+
+	return nil
+}
+
+// authenticatorData holds the fields of authenticator data. credentialID and
+// publicKey are only set when registering.
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData parses authenticator data, and checks that it was
+// made for the relying party with the user present and verified.
+func (rp *RelyingParty) parseAuthenticatorData(b []byte) (authenticatorData, error) {
+	var data authenticatorData
+
+	if len(b) < authenticatorDataMinSize {
+		return data, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(b[:32], rpIDHash[:]) != 1 {
+		return data, fmt.Errorf("%w: wrong relying party", ErrInvalidResponse)
+	}
+
+	data.flags = b[32]
+	data.signCount = binary.BigEndian.Uint32(b[33:37])
+	rest := b[37:]
+
+	if data.flags&flagUserPresent == 0 {
+		return data, fmt.Errorf("%w: user not present", ErrInvalidResponse)
+	}
+	if data.flags&flagUserVerified == 0 {
+		return data, fmt.Errorf("%w: user not verified", ErrInvalidResponse)
+	}
+
+	if data.flags&flagAttestedCredentials != 0 {
+		// The AAGUID of the authenticator, then the length of the
+		// credential ID.
+		if len(rest) < 18 {
+			return data, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+		}
+
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+
+		if n == 0 || n > maxCredentialIDSize || n > len(rest) {
+			return data, fmt.Errorf("%w: invalid credential ID", ErrInvalidResponse)
+		}
+		data.credentialID = append([]byte(nil), rest[:n]...)
+		rest = rest[n:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return data, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+		}
+		data.publicKey = append([]byte(nil), rest[:len(rest)-len(after)]...)
+		rest = after
+	}
+
+	if data.flags&flagExtensionsIncluded != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return data, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+		}
+		rest = after
+	}
+
+	if len(rest) != 0 {
+		return data, fmt.Errorf("%w: trailing data after authenticator data", ErrInvalidResponse)
+	}
+
+	return data, nil
+}
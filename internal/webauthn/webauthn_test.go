@@ -0,0 +1,294 @@
+package webauthn
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/juliflorezg/lets-go/internal/assert"
+	"github.com/juliflorezg/lets-go/internal/webauthn/webauthntest"
+)
+
+const testOrigin = "https://snippetbox.example.com"
+
+func newTestAuthenticator(t *testing.T, rp *RelyingParty, alg int) *webauthntest.Authenticator {
+	a, err := webauthntest.New(rp.ID, rp.Origin, alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func newTestChallenge(t *testing.T) string {
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+// register registers the credential of an authenticator, and fails the test
+// if it doesn't work.
+func register(t *testing.T, rp *RelyingParty, a *webauthntest.Authenticator) Credential {
+	challenge := newTestChallenge(t)
+	att := a.Create(challenge, []byte("user-1"))
+
+	cred, err := rp.Register(challenge, Attestation(att))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cred
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		origin     string
+		wantID     string
+		wantOrigin string
+		wantErr    bool
+	}{
+		{origin: "https://snippetbox.example.com", wantID: "snippetbox.example.com", wantOrigin: "https://snippetbox.example.com"},
+		{origin: "https://localhost:4000/", wantID: "localhost", wantOrigin: "https://localhost:4000"},
+		{origin: "snippetbox.example.com", wantErr: true},
+		{origin: "https://snippetbox.example.com/app", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			rp, err := New("Snippetbox", tt.origin)
+			if tt.wantErr {
+				assert.Equal(t, err != nil, true)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, rp.ID, tt.wantID)
+			assert.Equal(t, rp.Origin, tt.wantOrigin)
+		})
+	}
+}
+
+func TestCeremonies(t *testing.T) {
+	rp, err := New("Snippetbox", testOrigin)
+	assert.NilError(t, err)
+
+	for _, alg := range []int{AlgES256, AlgRS256} {
+		a := newTestAuthenticator(t, rp, alg)
+
+		cred := register(t, rp, a)
+		assert.Equal(t, string(cred.ID), string(a.CredentialID))
+		assert.Equal(t, cred.SignCount, uint32(0))
+
+		for i := 1; i <= 2; i++ {
+			challenge := newTestChallenge(t)
+
+			assertion, err := a.Get(challenge)
+			assert.NilError(t, err)
+
+			count, err := rp.Verify(challenge, cred, Assertion(assertion))
+			assert.NilError(t, err)
+			assert.Equal(t, count, uint32(i))
+
+			cred.SignCount = count
+		}
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	rp, err := New("Snippetbox", testOrigin)
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name   string
+		setup  func(a *webauthntest.Authenticator)
+		tamper func(challenge *string, att *webauthntest.Attestation)
+	}{
+		{
+			name: "Wrong challenge",
+			tamper: func(challenge *string, att *webauthntest.Attestation) {
+				*challenge = newTestChallenge(t)
+			},
+		},
+		{
+			name: "No challenge",
+			tamper: func(challenge *string, att *webauthntest.Attestation) {
+				*challenge = ""
+			},
+		},
+		{
+			name:  "Wrong origin",
+			setup: func(a *webauthntest.Authenticator) { a.Origin = "https://evil.example.com" },
+		},
+		{
+			name:  "Wrong relying party",
+			setup: func(a *webauthntest.Authenticator) { a.RPID = "evil.example.com" },
+		},
+		{
+			name:  "User not verified",
+			setup: func(a *webauthntest.Authenticator) { a.UserVerified = false },
+		},
+		{
+			name: "Truncated attestation object",
+			tamper: func(challenge *string, att *webauthntest.Attestation) {
+				att.AttestationObject = att.AttestationObject[:len(att.AttestationObject)-10]
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAuthenticator(t, rp, AlgES256)
+			if tt.setup != nil {
+				tt.setup(a)
+			}
+
+			challenge := newTestChallenge(t)
+			att := a.Create(challenge, []byte("user-1"))
+			if tt.tamper != nil {
+				tt.tamper(&challenge, &att)
+			}
+
+			_, err := rp.Register(challenge, Attestation(att))
+			assert.Equal(t, errors.Is(err, ErrInvalidResponse), true)
+		})
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	rp, err := New("Snippetbox", testOrigin)
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name    string
+		modify  func(a *webauthntest.Authenticator, cred *Credential)
+		wantErr error
+	}{
+		{
+			name: "Wrong origin",
+			modify: func(a *webauthntest.Authenticator, cred *Credential) {
+				a.Origin = "https://evil.example.com"
+			},
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name: "Wrong relying party",
+			modify: func(a *webauthntest.Authenticator, cred *Credential) {
+				a.RPID = "evil.example.com"
+			},
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name: "User not verified",
+			modify: func(a *webauthntest.Authenticator, cred *Credential) {
+				a.UserVerified = false
+			},
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name: "Counter went backwards",
+			modify: func(a *webauthntest.Authenticator, cred *Credential) {
+				cred.SignCount = 5
+				a.SignCount = 3
+			},
+			wantErr: ErrClonedAuthenticator,
+		},
+		{
+			name: "Other credential",
+			modify: func(a *webauthntest.Authenticator, cred *Credential) {
+				other := newTestAuthenticator(t, rp, AlgES256)
+				*cred = register(t, rp, other)
+			},
+			wantErr: ErrInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAuthenticator(t, rp, AlgES256)
+			cred := register(t, rp, a)
+
+			tt.modify(a, &cred)
+
+			challenge := newTestChallenge(t)
+			sent, err := a.Get(challenge)
+			assert.NilError(t, err)
+
+			_, err = rp.Verify(challenge, cred, Assertion(sent))
+			assert.Equal(t, errors.Is(err, tt.wantErr), true)
+		})
+	}
+
+	t.Run("Tampered data", func(t *testing.T) {
+		a := newTestAuthenticator(t, rp, AlgES256)
+		cred := register(t, rp, a)
+
+		challenge := newTestChallenge(t)
+		assertion, err := a.Get(challenge)
+		assert.NilError(t, err)
+
+		// Raise the signature counter without the authenticator.
+		assertion.AuthenticatorData[36]++
+
+		_, err = rp.Verify(challenge, cred, Assertion(assertion))
+		assert.Equal(t, errors.Is(err, ErrInvalidSignature), true)
+	})
+
+	t.Run("Replayed challenge", func(t *testing.T) {
+		a := newTestAuthenticator(t, rp, AlgES256)
+		cred := register(t, rp, a)
+
+		assertion, err := a.Get(newTestChallenge(t))
+		assert.NilError(t, err)
+
+		_, err = rp.Verify(newTestChallenge(t), cred, Assertion(assertion))
+		assert.Equal(t, errors.Is(err, ErrInvalidResponse), true)
+	})
+
+	t.Run("Registration response", func(t *testing.T) {
+		a := newTestAuthenticator(t, rp, AlgES256)
+		cred := register(t, rp, a)
+
+		challenge := newTestChallenge(t)
+		assertion, err := a.Get(challenge)
+		assert.NilError(t, err)
+
+		assertion.ClientDataJSON = a.Create(challenge, []byte("user-1")).ClientDataJSON
+
+		_, err = rp.Verify(challenge, cred, Assertion(assertion))
+		assert.Equal(t, errors.Is(err, ErrInvalidResponse), true)
+	})
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    any
+		wantErr bool
+	}{
+		{name: "Small integer", data: []byte{0x17}, want: int64(23)},
+		{name: "Integer", data: []byte{0x19, 0x01, 0x00}, want: int64(256)},
+		{name: "Negative integer", data: []byte{0x38, 0x63}, want: int64(-100)},
+		{name: "Text", data: []byte{0x63, 'f', 'm', 't'}, want: "fmt"},
+		{name: "True", data: []byte{0xf5}, want: true},
+		{name: "Truncated string", data: []byte{0x45, 0x01}, wantErr: true},
+		{name: "Indefinite length", data: []byte{0x5f, 0x41, 0x01, 0xff}, wantErr: true},
+		{name: "Float", data: []byte{0xf9, 0x3c, 0x00}, wantErr: true},
+		{name: "Duplicate key", data: []byte{0xa2, 0x01, 0x01, 0x01, 0x02}, wantErr: true},
+		{name: "Huge array", data: []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, wantErr: true},
+		{name: "Nested too deeply", data: []byte{0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x00}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, rest, err := decodeCBOR(tt.data)
+			if tt.wantErr {
+				assert.Equal(t, errors.Is(err, errCBOR), true)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, v, tt.want)
+			assert.Equal(t, len(rest), 0)
+		})
+	}
+}
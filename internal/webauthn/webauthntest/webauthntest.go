@@ -0,0 +1,239 @@
+// Package webauthntest provides a software authenticator, which does what
+// browsers and authenticators do in the WebAuthn ceremonies, for tests.
+package webauthntest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+)
+
+// The COSE algorithms of the keys authenticators can have.
+const (
+	ES256 = -7
+	RS256 = -257
+)
+
+// Authenticator holds a single credential, for a relying party. Its fields
+// can be changed to make it misbehave: Origin is the one of the page the
+// browser says it's on, and SignCount is the signature counter, which is
+// increased before every signature.
+type Authenticator struct {
+	RPID         string
+	Origin       string
+	CredentialID []byte
+	UserHandle   []byte
+	SignCount    uint32
+
+	// UserVerified is whether the user is verified (with a PIN or a
+	// biometric) when they use the authenticator. It's true by default.
+	UserVerified bool
+
+	alg int
+	key crypto.Signer
+}
+
+// New returns an authenticator with a new ES256 or RS256 credential for the
+// given relying party ID, used from pages of the given origin.
+func New(rpID, origin string, alg int) (*Authenticator, error) {
+	var key crypto.Signer
+	var err error
+
+	switch alg {
+	case RS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		alg = ES256
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authenticator{
+		RPID:         rpID,
+		Origin:       origin,
+		CredentialID: id,
+		UserVerified: true,
+		alg:          alg,
+		key:          key,
+	}, nil
+}
+
+// Attestation is the response of navigator.credentials.create().
+type Attestation struct {
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// Assertion is the response of navigator.credentials.get().
+type Assertion struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
+
+// Create registers the credential of the authenticator for the given user
+// handle, with a challenge of the creation options (base64url encoded, as in
+// the options).
+func (a *Authenticator) Create(challenge string, userHandle []byte) Attestation {
+	a.UserHandle = userHandle
+
+	authData := a.authenticatorData(0x40)
+
+	var cred []byte
+	cred = append(cred, make([]byte, 16)...) // AAGUID
+	cred = binary.BigEndian.AppendUint16(cred, uint16(len(a.CredentialID)))
+	cred = append(cred, a.CredentialID...)
+	cred = append(cred, a.publicKey()...)
+
+	authData = append(authData, cred...)
+
+	object := cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(authData),
+	)
+
+	return Attestation{
+		ClientDataJSON:    a.clientData("webauthn.create", challenge),
+		AttestationObject: object,
+	}
+}
+
+// Get signs a challenge of the request options (base64url encoded, as in
+// the options) with the credential of the authenticator.
+func (a *Authenticator) Get(challenge string) (Assertion, error) {
+	a.SignCount++
+
+	authData := a.authenticatorData(0)
+	clientData := a.clientData("webauthn.get", challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+
+	var opts crypto.SignerOpts = crypto.SHA256
+	signature, err := a.key.Sign(rand.Reader, digest[:], opts)
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	return Assertion{
+		CredentialID:      a.CredentialID,
+		ClientDataJSON:    clientData,
+		AuthenticatorData: authData,
+		Signature:         signature,
+		UserHandle:        a.UserHandle,
+	}, nil
+}
+
+func (a *Authenticator) clientData(ceremony, challenge string) []byte {
+	js, _ := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return js
+}
+
+// authenticatorData returns the authenticator data of the relying party,
+// with the user present, and the given flags.
+func (a *Authenticator) authenticatorData(flags byte) []byte {
+	flags |= 0x01
+	if a.UserVerified {
+		flags |= 0x04
+	}
+
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.SignCount)
+
+	return data
+}
+
+// publicKey returns the public key of the credential as a COSE_Key.
+func (a *Authenticator) publicKey() []byte {
+	switch pub := a.key.Public().(type) {
+	case *rsa.PublicKey:
+		return cborMap(
+			cborInt(1), cborInt(3),
+			cborInt(3), cborInt(RS256),
+			cborInt(-1), cborBytes(pub.N.Bytes()),
+			cborInt(-2), cborBytes(big.NewInt(int64(pub.E)).Bytes()),
+		)
+	case *ecdsa.PublicKey:
+		return cborMap(
+			cborInt(1), cborInt(2),
+			cborInt(3), cborInt(ES256),
+			cborInt(-1), cborInt(1),
+			cborInt(-2), cborBytes(pub.X.FillBytes(make([]byte, 32))),
+			cborInt(-3), cborBytes(pub.Y.FillBytes(make([]byte, 32))),
+		)
+	}
+	return nil
+}
+
+// EncodeToString base64url encodes b, the way browsers pass binary data to
+// the pages of the relying party.
+func EncodeToString(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// The CBOR encoding of the items authenticators return.
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+	}
+}
+
+func cborInt(n int64) []byte {
+	if n < 0 {
+		return cborHead(1, uint64(-1-n))
+	}
+	return cborHead(0, uint64(n))
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, uint64(len(b))), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, uint64(len(s))), s...)
+}
+
+// cborMap encodes a map from its keys and values, in order.
+func cborMap(items ...[]byte) []byte {
+	m := cborHead(5, uint64(len(items)/2))
+	for _, item := range items {
+		m = append(m, item...)
+	}
+	return m
+}
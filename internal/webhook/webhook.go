@@ -0,0 +1,160 @@
+// Package webhook sends the events of snippets to the URLs registered by
+// their owners. Every request is signed with the secret of the webhook, so
+// that receivers can check it comes from Snippetbox: the signature is the
+// HMAC-SHA256 of the body, sent as "sha256=<hex>" in the SignatureHeader.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// The headers sent with every delivery.
+const (
+	SignatureHeader = "X-Snippetbox-Signature"
+	EventHeader     = "X-Snippetbox-Event"
+	DeliveryHeader  = "X-Snippetbox-Delivery"
+)
+
+// The events webhooks can subscribe to.
+const (
+	EventSnippetCreated = "snippet.created"
+	EventSnippetUpdated = "snippet.updated"
+	EventSnippetDeleted = "snippet.deleted"
+)
+
+// Events lists the events webhooks can subscribe to, in the order they
+// should be offered to users.
+var Events = []string{EventSnippetCreated, EventSnippetUpdated, EventSnippetDeleted}
+
+// MaxAttempts is the number of times a delivery is attempted before giving
+// up. With the delays of Backoff, the last attempt comes about an hour after
+// the first.
+const MaxAttempts = 8
+
+// firstRetry is the delay before the second attempt of a delivery.
+const firstRetry = 30 * time.Second
+
+// ErrPrivateAddress is returned when a webhook URL resolves to an address of
+// the local network, which the client of NewClient refuses to connect to.
+var ErrPrivateAddress = errors.New("webhook: private network addresses are not allowed")
+
+// Backoff returns how long to wait after the given failed attempt (starting
+// from 1) before trying again. The delay doubles after every attempt.
+func Backoff(attempt int) time.Duration {
+	return firstRetry << (max(attempt, 1) - 1)
+}
+
+// NewSecret returns a random secret to sign the requests of a webhook with.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature of a body, as sent in the SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of body, in constant
+// time.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Request is a delivery of an event to a webhook.
+type Request struct {
+	DeliveryID int
+	Event      string
+	URL        string
+	Secret     string
+	Body       []byte
+}
+
+// Send posts the body of a request to its URL and returns the status code of
+// the response. Any response but a 2xx one is an error, as is a request which
+// gets no response at all (in which case the status code is 0).
+func Send(ctx context.Context, client *http.Client, r Request) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(r.Body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Snippetbox-Webhook")
+	req.Header.Set(EventHeader, r.Event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(r.DeliveryID))
+	req.Header.Set(SignatureHeader, Sign(r.Secret, r.Body))
+
+	rs, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rs.Body.Close()
+
+	// Read (some of) the body so that the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(rs.Body, 64<<10))
+
+	if rs.StatusCode < 200 || rs.StatusCode > 299 {
+		return rs.StatusCode, fmt.Errorf("webhook: unexpected status %d", rs.StatusCode)
+	}
+
+	return rs.StatusCode, nil
+}
+
+// NewClient returns a client for Send which gives up on requests after the
+// given timeout, doesn't follow redirects and refuses to connect to loopback
+// and private network addresses, so that webhooks can't be used to reach
+// the services next to the application.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// The address is checked once resolved, right before connecting, so
+		// that a host name can't resolve to a public address when it's
+		// checked and to a private one when it's used.
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+				return ErrPrivateAddress
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/juliflorezg/lets-go/internal/assert"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"snippet.created"}`)
+
+	signature := Sign("secret", body)
+
+	assert.Equal(t, signature, "sha256=067ca9dc5f4a28861688510200f89aa0162bf0001bb6e910f7113e8142a1b630")
+	assert.Equal(t, Verify("secret", body, signature), true)
+	assert.Equal(t, Verify("other secret", body, signature), false)
+	assert.Equal(t, Verify("secret", []byte(`{"event":"snippet.deleted"}`), signature), false)
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 30 * time.Second},
+		{attempt: 2, want: time.Minute},
+		{attempt: 3, want: 2 * time.Minute},
+		{attempt: 7, want: 32 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, Backoff(tt.attempt), tt.want)
+	}
+}
+
+func TestSend(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	status := http.StatusNoContent
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	req := Request{
+		DeliveryID: 7,
+		Event:      EventSnippetCreated,
+		URL:        receiver.URL,
+		Secret:     "secret",
+		Body:       []byte(`{"event":"snippet.created"}`),
+	}
+
+	t.Run("Delivered", func(t *testing.T) {
+		code, err := Send(context.Background(), receiver.Client(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, code, http.StatusNoContent)
+		assert.Equal(t, got.Header.Get("Content-Type"), "application/json")
+		assert.Equal(t, got.Header.Get(EventHeader), EventSnippetCreated)
+		assert.Equal(t, got.Header.Get(DeliveryHeader), "7")
+		assert.Equal(t, string(gotBody), string(req.Body))
+		assert.Equal(t, Verify("secret", gotBody, got.Header.Get(SignatureHeader)), true)
+	})
+
+	t.Run("Error response", func(t *testing.T) {
+		status = http.StatusInternalServerError
+
+		code, err := Send(context.Background(), receiver.Client(), req)
+
+		assert.Equal(t, code, http.StatusInternalServerError)
+		assert.Equal(t, err != nil, true)
+	})
+
+	t.Run("Private address", func(t *testing.T) {
+		code, err := Send(context.Background(), NewClient(time.Second), req)
+
+		assert.Equal(t, code, 0)
+		assert.Equal(t, errors.Is(err, ErrPrivateAddress), true)
+	})
+}
@@ -0,0 +1,141 @@
+// Snippets can be encrypted in the browser before they're sent, so that the
+// server only ever stores a ciphertext. The key is random and only kept in
+// the fragment of the link to the snippet (#key=...), which browsers never
+// send to servers.
+//
+// The ciphertext is the base64 encoding of a 12 byte nonce followed by the
+// AES-GCM encryption of the content, and the key is the base64url encoding
+// of a 256 bit AES key.
+
+var encodeBase64 = function (bytes) {
+	var binary = "";
+	for (var i = 0; i < bytes.length; i++) {
+		binary += String.fromCharCode(bytes[i]);
+	}
+	return btoa(binary);
+};
+
+var decodeBase64 = function (text) {
+	var binary = atob(text);
+	var bytes = new Uint8Array(binary.length);
+	for (var i = 0; i < binary.length; i++) {
+		bytes[i] = binary.charCodeAt(i);
+	}
+	return bytes;
+};
+
+var encodeKey = function (bytes) {
+	return encodeBase64(bytes).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+};
+
+var decodeKey = function (text) {
+	return decodeBase64(text.replace(/-/g, "+").replace(/_/g, "/"));
+};
+
+// keyFromLocation returns the key in the fragment of the current URL, or null
+// if there's none.
+var keyFromLocation = function () {
+	var match = /^#key=([A-Za-z0-9_-]+)$/.exec(window.location.hash);
+	if (!match) {
+		return Promise.resolve(null);
+	}
+	if (!window.crypto || !crypto.subtle) {
+		return Promise.reject(new Error("Web Crypto is not available"));
+	}
+	return crypto.subtle.importKey("raw", decodeKey(match[1]), "AES-GCM", false, ["decrypt"]);
+};
+
+var encryptContent = function (content) {
+	return crypto.subtle.generateKey({ name: "AES-GCM", length: 256 }, true, ["encrypt"]).then(function (key) {
+		var nonce = crypto.getRandomValues(new Uint8Array(12));
+		var plaintext = new TextEncoder().encode(content);
+
+		return Promise.all([
+			crypto.subtle.encrypt({ name: "AES-GCM", iv: nonce }, key, plaintext),
+			crypto.subtle.exportKey("raw", key),
+		]).then(function (results) {
+			var sealed = new Uint8Array(results[0]);
+			var ciphertext = new Uint8Array(nonce.length + sealed.length);
+			ciphertext.set(nonce);
+			ciphertext.set(sealed, nonce.length);
+
+			return {
+				ciphertext: encodeBase64(ciphertext),
+				key: encodeKey(new Uint8Array(results[1])),
+			};
+		});
+	});
+};
+
+var decryptContent = function (key, ciphertext) {
+	var bytes = decodeBase64(ciphertext);
+	var nonce = bytes.subarray(0, 12);
+
+	return crypto.subtle.decrypt({ name: "AES-GCM", iv: nonce }, key, bytes.subarray(12)).then(function (plaintext) {
+		return new TextDecoder().decode(plaintext);
+	});
+};
+
+// On the create form, the content is replaced with its ciphertext right
+// before the form is sent. The key is added to the fragment of the form's
+// action: the server redirects to the new snippet without a fragment, so the
+// browser keeps this one and the author lands on the full link.
+var encryptCheckbox = document.querySelector("form [name=client_encrypted]");
+if (encryptCheckbox) {
+	var encryptForm = encryptCheckbox.form;
+	var plainContent = encryptForm.elements["content"];
+
+	if (!window.crypto || !crypto.subtle) {
+		// Web Crypto is only available on secure (HTTPS) pages.
+		encryptCheckbox.checked = false;
+		encryptCheckbox.disabled = true;
+	}
+
+	// When the form comes back with errors, the content is still encrypted
+	// with the key from the previous attempt, which is in the URL.
+	if (encryptCheckbox.checked && plainContent.value) {
+		keyFromLocation().then(function (key) {
+			if (!key) {
+				plainContent.value = "";
+				return;
+			}
+			return decryptContent(key, plainContent.value).then(function (plaintext) {
+				plainContent.value = plaintext;
+			});
+		}).catch(function () {
+			plainContent.value = "";
+		});
+	}
+
+	encryptForm.addEventListener("submit", function (event) {
+		if (!encryptCheckbox.checked) {
+			return;
+		}
+		event.preventDefault();
+
+		encryptContent(plainContent.value).then(function (result) {
+			plainContent.readOnly = true;
+			plainContent.value = result.ciphertext;
+			encryptForm.action = encryptForm.getAttribute("action").split("#")[0] + "#key=" + result.key;
+			// submit() doesn't fire the submit event again.
+			encryptForm.submit();
+		});
+	});
+}
+
+// On the view page, the content is decrypted with the key from the URL.
+var encryptedSnippet = document.querySelector("[data-ciphertext]");
+if (encryptedSnippet) {
+	var encryptedCode = encryptedSnippet.querySelector("code");
+
+	keyFromLocation().then(function (key) {
+		if (!key) {
+			return;
+		}
+		return decryptContent(key, encryptedSnippet.getAttribute("data-ciphertext")).then(function (plaintext) {
+			encryptedCode.textContent = plaintext;
+		});
+	}).catch(function () {
+		encryptedCode.textContent = "This snippet can't be decrypted with the key in this link. Make sure the link is complete.";
+	});
+}
@@ -5,4 +5,177 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-} 
\ No newline at end of file
+} 
+
+// Forms within an element with a data-autosave attribute are saved as drafts,
+// by posting them to the URL in that attribute every few seconds while they
+// keep changing. The server answers with the ID of the draft, which is sent
+// back with the following saves so the same draft gets updated.
+var autosave = document.querySelector("[data-autosave]");
+var autosaveForm = autosave && autosave.querySelector("form");
+if (autosaveForm) {
+	var autosaveStatus = autosaveForm.querySelector(".autosave-status");
+	var autosaveDirty = false;
+	var autosaveBusy = false;
+
+	autosaveForm.addEventListener("input", function () {
+		autosaveDirty = true;
+	});
+
+	// Contents which are going to be encrypted in the browser (see
+	// encrypted.js) must never be sent in plain text, drafts included.
+	var autosaveEncrypted = autosaveForm.elements["client_encrypted"];
+
+	setInterval(function () {
+		if (!autosaveDirty || autosaveBusy || (autosaveEncrypted && autosaveEncrypted.checked)) {
+			return;
+		}
+		autosaveDirty = false;
+		autosaveBusy = true;
+
+		fetch(autosave.getAttribute("data-autosave"), {
+			method: "POST",
+			credentials: "same-origin",
+			body: new URLSearchParams(new FormData(autosaveForm)),
+		}).then(function (response) {
+			if (response.status === 204) {
+				return null;
+			}
+			if (!response.ok) {
+				throw new Error(response.statusText);
+			}
+			return response.json();
+		}).then(function (draft) {
+			if (draft) {
+				autosaveForm.elements["draft_id"].value = draft.id;
+				autosaveStatus.textContent = "Draft saved at " + new Date().toLocaleTimeString();
+			}
+		}).catch(function () {
+			autosaveDirty = true;
+			autosaveStatus.textContent = "Draft could not be saved";
+		}).finally(function () {
+			autosaveBusy = false;
+		});
+	}, 5000);
+}
+
+// The lines of a snippet can be linked to with a fragment like #L10, or #L10-L20
+// for a range of lines. The linked lines are highlighted and scrolled to.
+// Clicking a line number links to that line, and shift-clicking another one
+// then extends the link to the range between both.
+var codeLines = document.querySelector("pre.lines");
+if (codeLines) {
+	var firstLine = null;
+
+	var parseLines = function (hash) {
+		var match = /^#L(\d+)(?:-L(\d+))?$/.exec(hash);
+		if (!match) {
+			return null;
+		}
+		var first = parseInt(match[1], 10);
+		var last = match[2] ? parseInt(match[2], 10) : first;
+		return first <= last ? [first, last] : [last, first];
+	};
+
+	var highlightLines = function (scroll) {
+		var range = parseLines(window.location.hash);
+		var lines = codeLines.querySelectorAll(".line");
+		for (var i = 0; i < lines.length; i++) {
+			var number = i + 1;
+			lines[i].classList.toggle("highlighted", range !== null && number >= range[0] && number <= range[1]);
+		}
+		if (range && scroll) {
+			var line = document.getElementById("L" + range[0]);
+			if (line) {
+				line.scrollIntoView({ block: "center" });
+			}
+		}
+		firstLine = range && range[0];
+	};
+
+	codeLines.addEventListener("click", function (event) {
+		var number = event.target.getAttribute("data-line");
+		if (!event.target.classList.contains("line-number") || !event.target.hash) {
+			return;
+		}
+		event.preventDefault();
+
+		var hash = "#L" + number;
+		if (event.shiftKey && firstLine !== null && firstLine != number) {
+			var first = Math.min(firstLine, number);
+			var last = Math.max(firstLine, number);
+			hash = "#L" + first + "-L" + last;
+		}
+		history.replaceState(null, "", hash);
+		highlightLines(false);
+	});
+
+	window.addEventListener("hashchange", function () {
+		highlightLines(true);
+	});
+	highlightLines(true);
+}
+
+// Pages with a data-live attribute are kept up to date with the events
+// streamed from the URL in that attribute. Browsers reconnect by themselves
+// when the stream is closed.
+var liveLatest = document.querySelector("tbody[data-live]");
+if (liveLatest && window.EventSource) {
+	new EventSource(liveLatest.getAttribute("data-live")).addEventListener("snippet", function (event) {
+		var snippet = JSON.parse(event.data);
+		if (liveLatest.querySelector('a[href="/snippet/view/' + snippet.id + '"]')) {
+			return;
+		}
+
+		var row = document.createElement("tr");
+
+		var title = document.createElement("td");
+		var link = document.createElement("a");
+		link.href = "/snippet/view/" + snippet.id;
+		link.textContent = snippet.title;
+		title.appendChild(link);
+
+		var created = document.createElement("td");
+		created.textContent = snippet.created;
+
+		var id = document.createElement("td");
+		id.textContent = "#" + snippet.id;
+
+		row.append(title, created, id);
+		liveLatest.insertBefore(row, liveLatest.firstChild);
+
+		// The home page shows the 10 latest snippets.
+		while (liveLatest.rows.length > 10) {
+			liveLatest.deleteRow(-1);
+		}
+	});
+}
+
+var liveSnippet = document.querySelector(".snippet[data-live]");
+if (liveSnippet && codeLines && window.EventSource) {
+	new EventSource(liveSnippet.getAttribute("data-live")).addEventListener("update", function (event) {
+		var snippet = JSON.parse(event.data);
+
+		liveSnippet.querySelector(".metadata strong").textContent = snippet.title;
+		liveSnippet.querySelector(".metadata .language").textContent = snippet.language;
+
+		// Rebuild the lines the way view.tmpl.html renders them.
+		var code = document.createElement("code");
+		snippet.lines.forEach(function (text, i) {
+			var line = document.createElement("span");
+			line.className = "line";
+			line.id = "L" + (i + 1);
+
+			var number = document.createElement("a");
+			number.className = "line-number";
+			number.href = "#L" + (i + 1);
+			number.setAttribute("data-line", i + 1);
+
+			line.append(number, text);
+			code.append(line, "\n");
+		});
+		codeLines.replaceChildren(code);
+
+		highlightLines(false);
+	});
+}
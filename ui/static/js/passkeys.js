@@ -0,0 +1,87 @@
+// Passkeys are registered and used through the WebAuthn API of the browser.
+// The options of the ceremony are in the page, as JSON with their binary
+// fields base64url encoded, and the response of the authenticator is sent
+// back in the hidden fields of a regular form, base64url encoded too.
+
+var encodeBase64URL = function (buffer) {
+	var bytes = new Uint8Array(buffer);
+	var binary = "";
+	for (var i = 0; i < bytes.length; i++) {
+		binary += String.fromCharCode(bytes[i]);
+	}
+	return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+};
+
+var decodeBase64URL = function (text) {
+	var binary = atob(text.replace(/-/g, "+").replace(/_/g, "/"));
+	var bytes = new Uint8Array(binary.length);
+	for (var i = 0; i < binary.length; i++) {
+		bytes[i] = binary.charCodeAt(i);
+	}
+	return bytes;
+};
+
+var passkeyOptions = function () {
+	var options = JSON.parse(document.getElementById("passkey-options").textContent);
+	options.challenge = decodeBase64URL(options.challenge);
+
+	if (options.user) {
+		options.user.id = decodeBase64URL(options.user.id);
+	}
+	(options.excludeCredentials || options.allowCredentials || []).forEach(function (cred) {
+		cred.id = decodeBase64URL(cred.id);
+	});
+
+	return options;
+};
+
+// passkeyForm calls ceremony with the options in the page when form is
+// submitted, then fills in its fields with the response and sends it.
+var passkeyForm = function (form, ceremony, fields) {
+	var error = form.querySelector(".passkey-error");
+
+	if (!window.PublicKeyCredential) {
+		error.textContent = "Your browser doesn't support passkeys.";
+		form.querySelector("[type=submit]").disabled = true;
+		return;
+	}
+
+	form.addEventListener("submit", function (event) {
+		event.preventDefault();
+		error.textContent = "";
+
+		ceremony({ publicKey: passkeyOptions() }).then(function (credential) {
+			var values = fields(credential);
+			for (var name in values) {
+				form.elements[name].value = values[name] ? encodeBase64URL(values[name]) : "";
+			}
+			// submit() doesn't fire the submit event again.
+			form.submit();
+		}).catch(function () {
+			error.textContent = "The passkey wasn't used. Please try again.";
+		});
+	});
+};
+
+var registerForm = document.getElementById("passkey-register");
+if (registerForm) {
+	passkeyForm(registerForm, navigator.credentials.create.bind(navigator.credentials), function (credential) {
+		return {
+			client_data_json: credential.response.clientDataJSON,
+			attestation_object: credential.response.attestationObject,
+		};
+	});
+}
+
+var loginForm = document.getElementById("passkey-login");
+if (loginForm) {
+	passkeyForm(loginForm, navigator.credentials.get.bind(navigator.credentials), function (credential) {
+		return {
+			credential_id: credential.rawId,
+			client_data_json: credential.response.clientDataJSON,
+			authenticator_data: credential.response.authenticatorData,
+			signature: credential.response.signature,
+			user_handle: credential.response.userHandle,
+		};
+	});
+}